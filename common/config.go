@@ -3,11 +3,13 @@ package common
 import (
 	"flag"
 	"fmt"
+	"math/big"
 	"os"
 	"time"
 
 	"github.com/BurntSushi/toml"
 
+	"github.com/ethereum/go-ethereum/accounts"
 	geth_common "github.com/ethereum/go-ethereum/common"
 )
 
@@ -38,31 +40,7 @@ func LoadConfig() (*Config, error) {
 
 	// Apply default values
 	config := Config{
-		NetworkId:               configToml["network_id"].(int64),
-		RpcEndpoint:             configToml["rpc_endpoint"].(string),
-		ProxyPort:               configToml["proxy_port"].(string),
-		ERC20PermitTokenName:    configToml["erc20_permit_token_name"].(string),
-		ERC20PermitTokenAddress: geth_common.HexToAddress(configToml["erc20_permit_token_address"].(string)),
-		DeadlineMinimum:         configToml["deadline_minimum"].(int64),
-
-		Signer: SignerConfig{
-			Enable:           configToml["signer"].(map[string]interface{})["enable"].(bool),
-			KeystoreFilePath: configToml["signer"].(map[string]interface{})["keystore_file_path"].(string),
-			Password:         configToml["signer"].(map[string]interface{})["password"].(string),
-			GasPrice:         uint64(configToml["signer"].(map[string]interface{})["gas_price"].(int64)),
-			GasLimit:         uint64(configToml["signer"].(map[string]interface{})["gas_limit"].(int64)),
-			SenderInterval:   time.Duration(configToml["signer"].(map[string]interface{})["sender_interval"].(int64)),
-			SenderBulkSize:   int(configToml["signer"].(map[string]interface{})["sender_bulk_size"].(int64)),
-		},
-
-		Keeper: KeeperConfig{
-			Enable:                 configToml["keeper"].(map[string]interface{})["enable"].(bool),
-			InstanceId:             configToml["keeper"].(map[string]interface{})["instance_id"].(string),
-			InitialSyncBlockNumber: configToml["keeper"].(map[string]interface{})["initial_sync_block_number"].(int64),
-			BlockBatchLimit:        configToml["keeper"].(map[string]interface{})["block_batch_limit"].(int64),
-			SyncingInterval:        time.Duration(configToml["keeper"].(map[string]interface{})["syncing_interval"].(int64)),
-			LatestInterval:         time.Duration(configToml["keeper"].(map[string]interface{})["latest_interval"].(int64)),
-		},
+		ProxyPort: configToml["proxy_port"].(string),
 
 		Db: DatabaseConnection{
 			Host:     configToml["db"].(map[string]interface{})["host"].(string),
@@ -75,5 +53,814 @@ func LoadConfig() (*Config, error) {
 		LogDebug: configToml["log_debug"].(bool),
 	}
 
+	// Chains
+	config.Chains, err = loadChains(configToml)
+	if err != nil {
+		return nil, err
+	}
+
+	// Priority classes
+	config.ApiKeys, err = loadApiKeys(configToml)
+	if err != nil {
+		return nil, err
+	}
+
+	// Admin methods
+	config.AdminApiKeys, err = loadAdminApiKeys(configToml)
+	if err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
+
+func loadChains(configToml map[string]interface{}) ([]ChainConfig, error) {
+	// Single chain config, keep for backward compatible
+	if _, ok := configToml["chains"]; !ok {
+		chain, err := loadChain(configToml)
+		if err != nil {
+			return nil, err
+		}
+		return []ChainConfig{chain}, nil
+	}
+
+	chainsToml, ok := configToml["chains"].([]map[string]interface{})
+	if !ok || len(chainsToml) == 0 {
+		return nil, fmt.Errorf("invalid chains config")
+	}
+
+	chains := make([]ChainConfig, 0, len(chainsToml))
+	for i, chainToml := range chainsToml {
+		chain, err := loadChain(chainToml)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chains[%d]: %w", i, err)
+		}
+
+		// Check duplicate chain
+		for _, c := range chains {
+			if c.NetworkId == chain.NetworkId {
+				return nil, fmt.Errorf("duplicate chain network_id %d", chain.NetworkId)
+			}
+		}
+		chains = append(chains, chain)
+	}
+
+	return chains, nil
+}
+
+func loadChain(chainToml map[string]interface{}) (ChainConfig, error) {
+	networkId, ok := chainToml["network_id"].(int64)
+	if !ok {
+		return ChainConfig{}, fmt.Errorf("invalid network_id")
+	}
+	rpcEndpoint, ok := chainToml["rpc_endpoint"].(string)
+	if !ok {
+		return ChainConfig{}, fmt.Errorf("invalid rpc_endpoint")
+	}
+
+	chain := ChainConfig{
+		NetworkId:   networkId,
+		RpcEndpoint: rpcEndpoint,
+
+		Signer: SignerConfig{
+			Enable:         chainToml["signer"].(map[string]interface{})["enable"].(bool),
+			GasPrice:       uint64(chainToml["signer"].(map[string]interface{})["gas_price"].(int64)),
+			GasLimit:       uint64(chainToml["signer"].(map[string]interface{})["gas_limit"].(int64)),
+			SenderInterval: time.Duration(chainToml["signer"].(map[string]interface{})["sender_interval"].(int64)),
+			SenderBulkSize: int(chainToml["signer"].(map[string]interface{})["sender_bulk_size"].(int64)),
+		},
+
+		Keeper: KeeperConfig{
+			Enable:                 chainToml["keeper"].(map[string]interface{})["enable"].(bool),
+			InstanceId:             chainToml["keeper"].(map[string]interface{})["instance_id"].(string),
+			InitialSyncBlockNumber: chainToml["keeper"].(map[string]interface{})["initial_sync_block_number"].(int64),
+			BlockBatchLimit:        chainToml["keeper"].(map[string]interface{})["block_batch_limit"].(int64),
+			SyncingInterval:        time.Duration(chainToml["keeper"].(map[string]interface{})["syncing_interval"].(int64)),
+			LatestInterval:         time.Duration(chainToml["keeper"].(map[string]interface{})["latest_interval"].(int64)),
+		},
+	}
+
+	// Signer accounts
+	err := loadSignerAccounts(chainToml["signer"].(map[string]interface{}), &chain.Signer)
+	if err != nil {
+		return ChainConfig{}, err
+	}
+
+	// EIP-1559 fees
+	err = loadSignerFees(chainToml["signer"].(map[string]interface{}), &chain.Signer)
+	if err != nil {
+		return ChainConfig{}, err
+	}
+
+	// Replacement of stuck transactions
+	err = loadSignerReplacement(chainToml["signer"].(map[string]interface{}), &chain.Signer)
+	if err != nil {
+		return ChainConfig{}, err
+	}
+
+	// Gas balance monitor
+	err = loadSignerBalance(chainToml["signer"].(map[string]interface{}), &chain.Signer)
+	if err != nil {
+		return ChainConfig{}, err
+	}
+
+	// Retry of failed transactions
+	err = loadSignerRetry(chainToml["signer"].(map[string]interface{}), &chain.Signer)
+	if err != nil {
+		return ChainConfig{}, err
+	}
+
+	// Gas estimate
+	err = loadSignerGas(chainToml["signer"].(map[string]interface{}), &chain.Signer)
+	if err != nil {
+		return ChainConfig{}, err
+	}
+
+	// Fee policy
+	err = loadSignerFeePolicy(chainToml["signer"].(map[string]interface{}), &chain.Signer)
+	if err != nil {
+		return ChainConfig{}, err
+	}
+
+	// Batching
+	err = loadSignerBatch(chainToml["signer"].(map[string]interface{}), &chain.Signer)
+	if err != nil {
+		return ChainConfig{}, err
+	}
+
+	// Tokens
+	tokens, err := loadTokens(chainToml)
+	if err != nil {
+		return ChainConfig{}, err
+	}
+	chain.Tokens = tokens
+
+	// ERC-6492 validator, optional
+	if _, ok := chainToml["erc6492_validator"]; ok {
+		validator, ok := chainToml["erc6492_validator"].(string)
+		if !ok || !geth_common.IsHexAddress(validator) {
+			return ChainConfig{}, fmt.Errorf("invalid erc6492_validator")
+		}
+		chain.ERC6492Validator = geth_common.HexToAddress(validator)
+	}
+
+	// EIP-712 domain check, default warn
+	chain.DomainCheck = DomainCheckWarn
+	if _, ok := chainToml["domain_check"]; ok {
+		domainCheck, ok := chainToml["domain_check"].(string)
+		if !ok || (domainCheck != DomainCheckStrict && domainCheck != DomainCheckWarn && domainCheck != DomainCheckOff) {
+			return ChainConfig{}, fmt.Errorf("invalid domain_check")
+		}
+		chain.DomainCheck = domainCheck
+	}
+
+	return chain, nil
+}
+
+func loadTokens(configToml map[string]interface{}) ([]TokenConfig, error) {
+	// Single token config, keep for backward compatible
+	if _, ok := configToml["tokens"]; !ok {
+		if _, ok := configToml["erc20_permit_token_address"].(string); !ok {
+			return nil, fmt.Errorf("missing tokens config")
+		}
+
+		return []TokenConfig{
+			{
+				Name:            configToml["erc20_permit_token_name"].(string),
+				Version:         "1",
+				Address:         geth_common.HexToAddress(configToml["erc20_permit_token_address"].(string)),
+				DeadlineMinimum: configToml["deadline_minimum"].(int64),
+				Mode:            TokenModeTransferWithPermit,
+			},
+		}, nil
+	}
+
+	tokensToml, ok := configToml["tokens"].([]map[string]interface{})
+	if !ok || len(tokensToml) == 0 {
+		return nil, fmt.Errorf("invalid tokens config")
+	}
+
+	var err error
+	tokens := make([]TokenConfig, 0, len(tokensToml))
+	for i, tokenToml := range tokensToml {
+		name, ok := tokenToml["name"].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid tokens[%d].name", i)
+		}
+		address, ok := tokenToml["address"].(string)
+		if !ok || !geth_common.IsHexAddress(address) {
+			return nil, fmt.Errorf("invalid tokens[%d].address", i)
+		}
+		deadlineMinimum, ok := tokenToml["deadline_minimum"].(int64)
+		if !ok {
+			return nil, fmt.Errorf("invalid tokens[%d].deadline_minimum", i)
+		}
+
+		// Optional values
+		version, ok := tokenToml["version"].(string)
+		if !ok {
+			version = "1"
+		}
+		abiFilePath, _ := tokenToml["abi_file_path"].(string)
+		mode, ok := tokenToml["mode"].(string)
+		if !ok {
+			mode = TokenModeTransferWithPermit
+		}
+		if mode != TokenModeTransferWithPermit && mode != TokenModeEIP2612 && mode != TokenModeEIP3009 && mode != TokenModePermit2 && mode != TokenModeCustom {
+			return nil, fmt.Errorf("invalid tokens[%d].mode %s", i, mode)
+		}
+		forwarder := Address0x0
+		if _, ok := tokenToml["forwarder"]; ok {
+			forwarderAddress, ok := tokenToml["forwarder"].(string)
+			if !ok || !geth_common.IsHexAddress(forwarderAddress) {
+				return nil, fmt.Errorf("invalid tokens[%d].forwarder", i)
+			}
+			forwarder = geth_common.HexToAddress(forwarderAddress)
+		}
+		permit2 := Address0x0
+		if mode == TokenModePermit2 {
+			permit2 = Permit2Address
+			if _, ok := tokenToml["permit2"]; ok {
+				permit2Address, ok := tokenToml["permit2"].(string)
+				if !ok || !geth_common.IsHexAddress(permit2Address) {
+					return nil, fmt.Errorf("invalid tokens[%d].permit2", i)
+				}
+				permit2 = geth_common.HexToAddress(permit2Address)
+			}
+		}
+
+		var customPermit *CustomPermitConfig
+		if mode == TokenModeCustom {
+			if abiFilePath == "" {
+				return nil, fmt.Errorf("invalid tokens[%d].abi_file_path, required by custom mode", i)
+			}
+			customPermit, err = loadCustomPermit(tokenToml)
+			if err != nil {
+				return nil, fmt.Errorf("invalid tokens[%d].permit: %w", i, err)
+			}
+		}
+
+		validBeforeMinimum := int64(0)
+		if mode == TokenModeEIP3009 {
+			validBeforeMinimum = DefaultValidBeforeMinimum
+			if _, ok := tokenToml["valid_before_minimum"]; ok {
+				validBeforeMinimum, ok = tokenToml["valid_before_minimum"].(int64)
+				if !ok || validBeforeMinimum < 0 {
+					return nil, fmt.Errorf("invalid tokens[%d].valid_before_minimum", i)
+				}
+			}
+		}
+
+		var feePriority []*big.Int
+		if _, ok := tokenToml["fee_priority"]; ok {
+			if customPermit == nil || !customPermit.HasField("fee") {
+				return nil, fmt.Errorf("invalid tokens[%d].fee_priority, requires a custom permit fee field", i)
+			}
+			feePriority, err = loadFeePriority(tokenToml["fee_priority"])
+			if err != nil {
+				return nil, fmt.Errorf("invalid tokens[%d].fee_priority: %w", i, err)
+			}
+		}
+
+		token := TokenConfig{
+			Name:               name,
+			Version:            version,
+			Address:            geth_common.HexToAddress(address),
+			DeadlineMinimum:    deadlineMinimum,
+			AbiFilePath:        abiFilePath,
+			ValidBeforeMinimum: validBeforeMinimum,
+			Mode:               mode,
+			Forwarder:          forwarder,
+			Permit2:            permit2,
+			CustomPermit:       customPermit,
+			FeePriority:        feePriority,
+		}
+
+		// Check duplicate token
+		for _, t := range tokens {
+			if t.Address == token.Address {
+				return nil, fmt.Errorf("duplicate token address %s", token.Address.Hex())
+			}
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+// loadFeePriority reads ascending fee thresholds as integers or decimal strings
+func loadFeePriority(value interface{}) ([]*big.Int, error) {
+	thresholdsToml, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid thresholds")
+	}
+	thresholds := make([]*big.Int, 0, len(thresholdsToml))
+	for j, thresholdToml := range thresholdsToml {
+		threshold := new(big.Int)
+		switch v := thresholdToml.(type) {
+		case int64:
+			threshold.SetInt64(v)
+		case string:
+			if _, ok := threshold.SetString(v, 10); !ok {
+				return nil, fmt.Errorf("invalid thresholds[%d]", j)
+			}
+		default:
+			return nil, fmt.Errorf("invalid thresholds[%d]", j)
+		}
+		if threshold.Sign() <= 0 || (j > 0 && threshold.Cmp(thresholds[j-1]) <= 0) {
+			return nil, fmt.Errorf("thresholds[%d] must be positive and ascending", j)
+		}
+		thresholds = append(thresholds, threshold)
+	}
+	return thresholds, nil
+}
+
+// loadApiKeys reads the priority class of each API key
+func loadApiKeys(configToml map[string]interface{}) (map[string]int64, error) {
+	apiKeys := make(map[string]int64)
+	if _, ok := configToml["api_keys"]; !ok {
+		return apiKeys, nil
+	}
+	apiKeysToml, ok := configToml["api_keys"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid api_keys")
+	}
+	for apiKey, priorityToml := range apiKeysToml {
+		priority, ok := priorityToml.(int64)
+		if !ok || apiKey == "" || priority < 0 {
+			return nil, fmt.Errorf("invalid api_keys.%s, priority class must be a non-negative integer", apiKey)
+		}
+		apiKeys[apiKey] = priority
+	}
+	return apiKeys, nil
+}
+
+// loadAdminApiKeys reads the API keys allowed to call admin_ methods
+func loadAdminApiKeys(configToml map[string]interface{}) (map[string]bool, error) {
+	adminApiKeys := make(map[string]bool)
+	if _, ok := configToml["admin_api_keys"]; !ok {
+		return adminApiKeys, nil
+	}
+	adminApiKeysToml, ok := configToml["admin_api_keys"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid admin_api_keys")
+	}
+	for _, value := range adminApiKeysToml {
+		apiKey, ok := value.(string)
+		if !ok || apiKey == "" {
+			return nil, fmt.Errorf("invalid admin_api_keys")
+		}
+		adminApiKeys[apiKey] = true
+	}
+	return adminApiKeys, nil
+}
+
+func loadCustomPermit(tokenToml map[string]interface{}) (*CustomPermitConfig, error) {
+	permitToml, ok := tokenToml["permit"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("missing permit config")
+	}
+
+	primaryType, ok := permitToml["primary_type"].(string)
+	if !ok || primaryType == "" || primaryType == "EIP712Domain" {
+		return nil, fmt.Errorf("invalid primary_type")
+	}
+	function, ok := permitToml["function"].(string)
+	if !ok || function == "" {
+		return nil, fmt.Errorf("invalid function")
+	}
+
+	// Fields
+	// Array of tables or array of inline tables
+	fieldsToml, ok := permitToml["fields"].([]map[string]interface{})
+	if fieldsInline, isInline := permitToml["fields"].([]interface{}); isInline {
+		ok = true
+		for _, fieldInline := range fieldsInline {
+			fieldToml, isTable := fieldInline.(map[string]interface{})
+			if !isTable {
+				return nil, fmt.Errorf("invalid fields")
+			}
+			fieldsToml = append(fieldsToml, fieldToml)
+		}
+	}
+	if !ok || len(fieldsToml) == 0 {
+		return nil, fmt.Errorf("invalid fields")
+	}
+	fields := make([]PermitField, 0, len(fieldsToml))
+	types := make(map[string]string)
+	for j, fieldToml := range fieldsToml {
+		name, ok := fieldToml["name"].(string)
+		if !ok || name == "" || CustomPermitSignatureArguments[name] {
+			return nil, fmt.Errorf("invalid fields[%d].name", j)
+		}
+		fieldType, ok := fieldToml["type"].(string)
+		if !ok || !CustomPermitFieldTypes[fieldType] {
+			return nil, fmt.Errorf("invalid fields[%d].type", j)
+		}
+		if _, ok := types[name]; ok {
+			return nil, fmt.Errorf("duplicate field %s", name)
+		}
+		types[name] = fieldType
+		fields = append(fields, PermitField{Name: name, Type: fieldType})
+	}
+	for name, fieldType := range CustomPermitRequiredFields {
+		if types[name] != fieldType {
+			return nil, fmt.Errorf("missing field %s %s", fieldType, name)
+		}
+	}
+
+	// Function arguments
+	argumentsToml, ok := permitToml["arguments"].([]interface{})
+	if !ok || len(argumentsToml) == 0 {
+		return nil, fmt.Errorf("invalid arguments")
+	}
+	arguments := make([]string, 0, len(argumentsToml))
+	for j, argumentToml := range argumentsToml {
+		argument, ok := argumentToml.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid arguments[%d]", j)
+		}
+		if _, ok := types[argument]; !ok && !CustomPermitSignatureArguments[argument] {
+			return nil, fmt.Errorf("unknown argument %s", argument)
+		}
+		arguments = append(arguments, argument)
+	}
+
+	return &CustomPermitConfig{
+		PrimaryType: primaryType,
+		Fields:      fields,
+		Function:    function,
+		Arguments:   arguments,
+	}, nil
+}
+
+func loadSignerAccounts(signerToml map[string]interface{}, signer *SignerConfig) error {
+	// Default values
+	signer.Backend = SignerBackendLocal
+	signer.DerivationPath = DefaultDerivationPath
+	signer.Assignment = AssignmentOwner
+
+	// Remote signer backend
+	if _, ok := signerToml["backend"]; ok {
+		backend, ok := signerToml["backend"].(string)
+		if !ok || (backend != SignerBackendLocal && backend != SignerBackendClef && backend != SignerBackendWeb3Signer) {
+			return fmt.Errorf("invalid signer.backend")
+		}
+		signer.Backend = backend
+	}
+	if _, ok := signerToml["backend_endpoint"]; ok {
+		endpoint, ok := signerToml["backend_endpoint"].(string)
+		if !ok || endpoint == "" {
+			return fmt.Errorf("invalid signer.backend_endpoint")
+		}
+		signer.BackendEndpoint = endpoint
+	}
+	if _, ok := signerToml["backend_accounts"]; ok {
+		backendAccounts, ok := signerToml["backend_accounts"].([]interface{})
+		if !ok {
+			return fmt.Errorf("invalid signer.backend_accounts")
+		}
+		for _, value := range backendAccounts {
+			address, ok := value.(string)
+			if !ok || !geth_common.IsHexAddress(address) {
+				return fmt.Errorf("invalid signer.backend_accounts")
+			}
+			signer.BackendAccounts = append(signer.BackendAccounts, geth_common.HexToAddress(address))
+		}
+	}
+	if signer.Backend != SignerBackendLocal {
+		if signer.BackendEndpoint == "" {
+			return fmt.Errorf("invalid signer, backend %s requires backend_endpoint", signer.Backend)
+		}
+		return loadSignerAssignment(signerToml, signer)
+	}
+
+	if _, ok := signerToml["keystore_file_path"]; ok {
+		keystoreFilePath, ok := signerToml["keystore_file_path"].(string)
+		if !ok {
+			return fmt.Errorf("invalid signer.keystore_file_path")
+		}
+		signer.KeystoreFilePath = keystoreFilePath
+		signer.KeystoreFilePaths = append(signer.KeystoreFilePaths, keystoreFilePath)
+	}
+	if _, ok := signerToml["keystore_file_paths"]; ok {
+		keystoreFilePaths, ok := signerToml["keystore_file_paths"].([]interface{})
+		if !ok {
+			return fmt.Errorf("invalid signer.keystore_file_paths")
+		}
+		for _, value := range keystoreFilePaths {
+			keystoreFilePath, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("invalid signer.keystore_file_paths")
+			}
+			signer.KeystoreFilePaths = append(signer.KeystoreFilePaths, keystoreFilePath)
+		}
+	}
+	if _, ok := signerToml["password"]; ok {
+		password, ok := signerToml["password"].(string)
+		if !ok {
+			return fmt.Errorf("invalid signer.password")
+		}
+		signer.Password = password
+	}
+
+	// HD wallet accounts
+	if _, ok := signerToml["mnemonic"]; ok {
+		mnemonic, ok := signerToml["mnemonic"].(string)
+		if !ok {
+			return fmt.Errorf("invalid signer.mnemonic")
+		}
+		if err := ValidateMnemonic(mnemonic); err != nil {
+			return fmt.Errorf("invalid signer.mnemonic, %v", err)
+		}
+		signer.Mnemonic = mnemonic
+		signer.DerivationCount = 1
+	}
+	if _, ok := signerToml["mnemonic_passphrase"]; ok {
+		passphrase, ok := signerToml["mnemonic_passphrase"].(string)
+		if !ok {
+			return fmt.Errorf("invalid signer.mnemonic_passphrase")
+		}
+		signer.MnemonicPassphrase = passphrase
+	}
+	if _, ok := signerToml["derivation_path"]; ok {
+		derivationPath, ok := signerToml["derivation_path"].(string)
+		if !ok {
+			return fmt.Errorf("invalid signer.derivation_path")
+		}
+		if _, err := accounts.ParseDerivationPath(derivationPath); err != nil {
+			return fmt.Errorf("invalid signer.derivation_path: %v", err)
+		}
+		signer.DerivationPath = derivationPath
+	}
+	if _, ok := signerToml["derivation_start"]; ok {
+		start, ok := signerToml["derivation_start"].(int64)
+		if !ok || start < 0 || start >= 0x80000000 {
+			return fmt.Errorf("invalid signer.derivation_start")
+		}
+		signer.DerivationStart = uint32(start)
+	}
+	if _, ok := signerToml["derivation_count"]; ok {
+		count, ok := signerToml["derivation_count"].(int64)
+		if !ok || count < 1 || count > 1000 || signer.Mnemonic == "" {
+			return fmt.Errorf("invalid signer.derivation_count, require mnemonic and 1 to 1000")
+		}
+		signer.DerivationCount = uint32(count)
+	}
+
+	if signer.Enable && len(signer.KeystoreFilePaths) == 0 && signer.Mnemonic == "" {
+		return fmt.Errorf("invalid signer, require keystore_file_path, keystore_file_paths or mnemonic")
+	}
+
+	return loadSignerAssignment(signerToml, signer)
+}
+
+func loadSignerAssignment(signerToml map[string]interface{}, signer *SignerConfig) error {
+	if _, ok := signerToml["assignment"]; ok {
+		assignment, ok := signerToml["assignment"].(string)
+		if !ok || (assignment != AssignmentOwner && assignment != AssignmentLeastLoaded) {
+			return fmt.Errorf("invalid signer.assignment")
+		}
+		signer.Assignment = assignment
+	}
+
+	return nil
+}
+
+// loadSignerFees loads the legacy gas price or the EIP-1559 fee estimation and caps
+func loadSignerFees(signerToml map[string]interface{}, signer *SignerConfig) error {
+	// Default values
+	signer.TxType = TxTypeLegacy
+	signer.FeeHistoryBlocks = 10
+	signer.PriorityFeePercentile = 50
+	signer.BaseFeeMultiplier = 2
+
+	if _, ok := signerToml["tx_type"]; ok {
+		txType, ok := signerToml["tx_type"].(string)
+		if !ok || (txType != TxTypeLegacy && txType != TxTypeDynamicFee) {
+			return fmt.Errorf("invalid signer.tx_type")
+		}
+		signer.TxType = txType
+	}
+	if _, ok := signerToml["fee_history_blocks"]; ok {
+		blocks, ok := signerToml["fee_history_blocks"].(int64)
+		if !ok || blocks < 1 || blocks > 1024 {
+			return fmt.Errorf("invalid signer.fee_history_blocks")
+		}
+		signer.FeeHistoryBlocks = uint64(blocks)
+	}
+	if _, ok := signerToml["priority_fee_percentile"]; ok {
+		percentile, ok := loadFloat(signerToml["priority_fee_percentile"])
+		if !ok || percentile < 0 || percentile > 100 {
+			return fmt.Errorf("invalid signer.priority_fee_percentile")
+		}
+		signer.PriorityFeePercentile = percentile
+	}
+	if _, ok := signerToml["base_fee_multiplier"]; ok {
+		multiplier, ok := loadFloat(signerToml["base_fee_multiplier"])
+		if !ok || multiplier < 1 {
+			return fmt.Errorf("invalid signer.base_fee_multiplier")
+		}
+		signer.BaseFeeMultiplier = multiplier
+	}
+	if _, ok := signerToml["max_priority_fee"]; ok {
+		maxPriorityFee, ok := signerToml["max_priority_fee"].(int64)
+		if !ok || maxPriorityFee < 0 {
+			return fmt.Errorf("invalid signer.max_priority_fee")
+		}
+		signer.MaxPriorityFee = uint64(maxPriorityFee)
+	}
+	if _, ok := signerToml["max_fee"]; ok {
+		maxFee, ok := signerToml["max_fee"].(int64)
+		if !ok || maxFee < 0 {
+			return fmt.Errorf("invalid signer.max_fee")
+		}
+		signer.MaxFee = uint64(maxFee)
+	}
+	if _, ok := signerToml["max_gas_price"]; ok {
+		maxGasPrice, ok := signerToml["max_gas_price"].(int64)
+		if !ok || maxGasPrice < 0 {
+			return fmt.Errorf("invalid signer.max_gas_price")
+		}
+		signer.MaxGasPrice = uint64(maxGasPrice)
+	}
+
+	return nil
+}
+
+// loadSignerReplacement loads the replacement of stuck transactions with bumped fees
+func loadSignerReplacement(signerToml map[string]interface{}, signer *SignerConfig) error {
+	// Default values
+	signer.ReplaceAfter = 300000
+	signer.FeeBumpPercent = 15
+
+	if _, ok := signerToml["replace_after"]; ok {
+		replaceAfter, ok := signerToml["replace_after"].(int64)
+		if !ok || replaceAfter < 0 {
+			return fmt.Errorf("invalid signer.replace_after")
+		}
+		signer.ReplaceAfter = time.Duration(replaceAfter)
+	}
+	if _, ok := signerToml["fee_bump_percent"]; ok {
+		feeBumpPercent, ok := signerToml["fee_bump_percent"].(int64)
+		if !ok || feeBumpPercent < 10 {
+			return fmt.Errorf("invalid signer.fee_bump_percent, minimum 10")
+		}
+		signer.FeeBumpPercent = uint64(feeBumpPercent)
+	}
+
+	return nil
+}
+
+// loadSignerBalance loads the gas balance monitor of the signer accounts
+func loadSignerBalance(signerToml map[string]interface{}, signer *SignerConfig) error {
+	// Default values
+	signer.BalanceCheckInterval = 60000
+	signer.BalanceWarningTxs = 50
+	signer.BalanceMinTxs = 1
+
+	if _, ok := signerToml["balance_check_interval"]; ok {
+		interval, ok := signerToml["balance_check_interval"].(int64)
+		if !ok || interval < 0 {
+			return fmt.Errorf("invalid signer.balance_check_interval")
+		}
+		signer.BalanceCheckInterval = time.Duration(interval)
+	}
+	if _, ok := signerToml["balance_min_txs"]; ok {
+		minTxs, ok := signerToml["balance_min_txs"].(int64)
+		if !ok || minTxs < 0 {
+			return fmt.Errorf("invalid signer.balance_min_txs")
+		}
+		signer.BalanceMinTxs = minTxs
+	}
+	if _, ok := signerToml["balance_warning_txs"]; ok {
+		warningTxs, ok := signerToml["balance_warning_txs"].(int64)
+		if !ok || warningTxs < 0 {
+			return fmt.Errorf("invalid signer.balance_warning_txs")
+		}
+		signer.BalanceWarningTxs = warningTxs
+	}
+	if signer.BalanceWarningTxs < signer.BalanceMinTxs {
+		return fmt.Errorf("invalid signer.balance_warning_txs, minimum balance_min_txs")
+	}
+
+	return nil
+}
+
+// loadSignerRetry loads the retry of failed transactions with backoff
+func loadSignerRetry(signerToml map[string]interface{}, signer *SignerConfig) error {
+	// Default values
+	signer.RetryInterval = 30000
+	signer.RetryBackoff = 60000
+	signer.RetryMaxAttempts = 3
+
+	if _, ok := signerToml["retry_interval"]; ok {
+		interval, ok := signerToml["retry_interval"].(int64)
+		if !ok || interval < 0 {
+			return fmt.Errorf("invalid signer.retry_interval")
+		}
+		signer.RetryInterval = time.Duration(interval)
+	}
+	if _, ok := signerToml["retry_backoff"]; ok {
+		backoff, ok := signerToml["retry_backoff"].(int64)
+		if !ok || backoff < 0 {
+			return fmt.Errorf("invalid signer.retry_backoff")
+		}
+		signer.RetryBackoff = time.Duration(backoff)
+	}
+	if _, ok := signerToml["retry_max_attempts"]; ok {
+		maxAttempts, ok := signerToml["retry_max_attempts"].(int64)
+		if !ok || maxAttempts < 0 {
+			return fmt.Errorf("invalid signer.retry_max_attempts")
+		}
+		signer.RetryMaxAttempts = maxAttempts
+	}
+
+	return nil
+}
+
+// loadSignerGas loads the safety multiplier of gas estimates, 0 uses the fixed gas_limit
+func loadSignerGas(signerToml map[string]interface{}, signer *SignerConfig) error {
+	// Default values
+	signer.GasEstimateMultiplier = 1.2
+
+	if _, ok := signerToml["gas_estimate_multiplier"]; ok {
+		multiplier, ok := loadFloat(signerToml["gas_estimate_multiplier"])
+		if !ok || (multiplier != 0 && multiplier < 1) {
+			return fmt.Errorf("invalid signer.gas_estimate_multiplier")
+		}
+		signer.GasEstimateMultiplier = multiplier
+	}
+
+	return nil
+}
+
+// loadFloat reads a toml integer or float
+func loadFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// loadSignerFeePolicy loads the fee ceiling, target and emergency budget of deferring sends, disabled by default
+func loadSignerFeePolicy(signerToml map[string]interface{}, signer *SignerConfig) error {
+	// Default values
+	signer.FeeUrgentWindow = 600000
+
+	if _, ok := signerToml["fee_ceiling"]; ok {
+		feeCeiling, ok := signerToml["fee_ceiling"].(int64)
+		if !ok || feeCeiling < 0 {
+			return fmt.Errorf("invalid signer.fee_ceiling")
+		}
+		signer.FeeCeiling = uint64(feeCeiling)
+	}
+	if _, ok := signerToml["fee_target"]; ok {
+		feeTarget, ok := signerToml["fee_target"].(int64)
+		if !ok || feeTarget < 0 || (signer.FeeCeiling > 0 && uint64(feeTarget) > signer.FeeCeiling) {
+			return fmt.Errorf("invalid signer.fee_target, maximum fee_ceiling")
+		}
+		signer.FeeTarget = uint64(feeTarget)
+	}
+	if _, ok := signerToml["fee_urgent_window"]; ok {
+		urgentWindow, ok := signerToml["fee_urgent_window"].(int64)
+		if !ok || urgentWindow < 0 {
+			return fmt.Errorf("invalid signer.fee_urgent_window")
+		}
+		signer.FeeUrgentWindow = time.Duration(urgentWindow)
+	}
+	if _, ok := signerToml["fee_emergency_budget"]; ok {
+		emergencyBudget, ok := signerToml["fee_emergency_budget"].(int64)
+		if !ok || emergencyBudget < 0 {
+			return fmt.Errorf("invalid signer.fee_emergency_budget")
+		}
+		signer.FeeEmergencyBudget = uint64(emergencyBudget)
+	}
+
+	return nil
+}
+
+// loadSignerBatch loads the batch executor of single-call permits, Multicall3 by default
+func loadSignerBatch(signerToml map[string]interface{}, signer *SignerConfig) error {
+	signer.BatchExecutor = Multicall3Address
+
+	if _, ok := signerToml["batch_size"]; ok {
+		batchSize, ok := signerToml["batch_size"].(int64)
+		if !ok || batchSize < 0 || batchSize > 100 {
+			return fmt.Errorf("invalid signer.batch_size, maximum 100")
+		}
+		signer.BatchSize = int(batchSize)
+	}
+	if _, ok := signerToml["batch_executor"]; ok {
+		batchExecutor, ok := signerToml["batch_executor"].(string)
+		if !ok || !geth_common.IsHexAddress(batchExecutor) {
+			return fmt.Errorf("invalid signer.batch_executor")
+		}
+		signer.BatchExecutor = geth_common.HexToAddress(batchExecutor)
+	}
+
+	return nil
+}
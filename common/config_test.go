@@ -0,0 +1,500 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/toml"
+
+	geth_common "github.com/ethereum/go-ethereum/common"
+)
+
+func TestLoadTokens(t *testing.T) {
+	configData := `
+[[tokens]]
+name = "TokenA"
+address = "0x1234567890123456789012345678901234567890"
+deadline_minimum = 3600
+
+[[tokens]]
+name = "TokenB"
+version = "2"
+address = "0x0987654321098765432109876543210987654321"
+deadline_minimum = 7200
+abi_file_path = "./token_b.json"
+`
+	var configToml map[string]interface{}
+	if _, err := toml.Decode(configData, &configToml); err != nil {
+		t.Fatalf("Decode config returned error: %v", err)
+	}
+
+	tokens, err := loadTokens(configToml)
+	if err != nil {
+		t.Fatalf("loadTokens returned error: %v", err)
+	}
+	if len(tokens) != 2 {
+		t.Fatalf("loadTokens returned wrong length: expected 2, got %d", len(tokens))
+	}
+	if tokens[0].Version != "1" {
+		t.Errorf("loadTokens returned wrong default version: expected 1, got %v", tokens[0].Version)
+	}
+	if tokens[1].Address != geth_common.HexToAddress("0x0987654321098765432109876543210987654321") || tokens[1].Version != "2" || tokens[1].AbiFilePath != "./token_b.json" {
+		t.Errorf("loadTokens returned wrong token: %+v", tokens[1])
+	}
+}
+
+func TestLoadTokensLegacy(t *testing.T) {
+	configToml := map[string]interface{}{
+		"erc20_permit_token_name":    "Test",
+		"erc20_permit_token_address": "0x1234567890123456789012345678901234567890",
+		"deadline_minimum":           int64(3600),
+	}
+
+	tokens, err := loadTokens(configToml)
+	if err != nil {
+		t.Fatalf("loadTokens returned error: %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].Name != "Test" || tokens[0].DeadlineMinimum != 3600 {
+		t.Errorf("loadTokens returned wrong tokens: %+v", tokens)
+	}
+}
+
+func TestLoadTokensValidBeforeMinimum(t *testing.T) {
+	token := map[string]interface{}{
+		"name":             "Test",
+		"address":          "0x1234567890123456789012345678901234567890",
+		"deadline_minimum": int64(7776000),
+		"mode":             TokenModeEIP3009,
+	}
+	tokens, err := loadTokens(map[string]interface{}{"tokens": []map[string]interface{}{token}})
+	if err != nil {
+		t.Fatalf("loadTokens returned error: %v", err)
+	}
+	if tokens[0].ValidBeforeMinimum != DefaultValidBeforeMinimum {
+		t.Errorf("loadTokens returned valid_before_minimum %d, expected default", tokens[0].ValidBeforeMinimum)
+	}
+
+	token["valid_before_minimum"] = int64(60)
+	tokens, err = loadTokens(map[string]interface{}{"tokens": []map[string]interface{}{token}})
+	if err != nil {
+		t.Fatalf("loadTokens returned error: %v", err)
+	}
+	if tokens[0].ValidBeforeMinimum != 60 {
+		t.Errorf("loadTokens returned valid_before_minimum %d, expected 60", tokens[0].ValidBeforeMinimum)
+	}
+}
+
+func TestLoadTokensDuplicate(t *testing.T) {
+	token := map[string]interface{}{
+		"name":             "Test",
+		"address":          "0x1234567890123456789012345678901234567890",
+		"deadline_minimum": int64(3600),
+	}
+	configToml := map[string]interface{}{
+		"tokens": []map[string]interface{}{token, token},
+	}
+
+	if _, err := loadTokens(configToml); err == nil {
+		t.Errorf("loadTokens expected duplicate token error")
+	}
+}
+
+func TestLoadChains(t *testing.T) {
+	configData := `
+[[chains]]
+network_id = 1
+rpc_endpoint = "http://localhost:8545"
+domain_check = "strict"
+
+[[chains.tokens]]
+name = "TokenA"
+address = "0x1234567890123456789012345678901234567890"
+deadline_minimum = 3600
+
+[chains.signer]
+enable = true
+keystore_file_path = "./.keystore"
+password = "password"
+gas_price = 1
+gas_limit = 2
+sender_interval = 3
+sender_bulk_size = 4
+
+[chains.keeper]
+enable = false
+instance_id = "a"
+initial_sync_block_number = 5
+block_batch_limit = 6
+syncing_interval = 7
+latest_interval = 8
+
+[[chains]]
+network_id = 11155111
+rpc_endpoint = "http://localhost:8546"
+erc6492_validator = "0x0987654321098765432109876543210987654321"
+
+[[chains.tokens]]
+name = "TokenA"
+address = "0x1234567890123456789012345678901234567890"
+deadline_minimum = 3600
+
+[chains.signer]
+enable = false
+keystore_file_path = "./.keystore-sepolia"
+password = "password"
+gas_price = 1
+gas_limit = 2
+sender_interval = 3
+sender_bulk_size = 4
+
+[chains.keeper]
+enable = true
+instance_id = "b"
+initial_sync_block_number = 5
+block_batch_limit = 6
+syncing_interval = 7
+latest_interval = 8
+`
+	var configToml map[string]interface{}
+	if _, err := toml.Decode(configData, &configToml); err != nil {
+		t.Fatalf("Decode config returned error: %v", err)
+	}
+
+	chains, err := loadChains(configToml)
+	if err != nil {
+		t.Fatalf("loadChains returned error: %v", err)
+	}
+	if len(chains) != 2 {
+		t.Fatalf("loadChains returned wrong length: expected 2, got %d", len(chains))
+	}
+	if chains[0].NetworkId != 1 || !chains[0].Signer.Enable || chains[0].Keeper.InstanceId != "a" || chains[0].DomainCheck != DomainCheckStrict {
+		t.Errorf("loadChains returned wrong chain: %+v", chains[0])
+	}
+	if chains[1].NetworkId != 11155111 || chains[1].Signer.KeystoreFilePath != "./.keystore-sepolia" || len(chains[1].Tokens) != 1 || chains[1].DomainCheck != DomainCheckWarn || chains[1].ERC6492Validator != geth_common.HexToAddress("0x0987654321098765432109876543210987654321") {
+		t.Errorf("loadChains returned wrong chain: %+v", chains[1])
+	}
+
+	config := Config{Chains: chains}
+	if chain, ok := config.GetChain(11155111); !ok || chain.RpcEndpoint != "http://localhost:8546" {
+		t.Errorf("GetChain returned wrong chain: %+v", chain)
+	}
+	if _, ok := config.GetChain(5); ok {
+		t.Errorf("GetChain expected unknown chain")
+	}
+}
+
+func TestLoadTokensCustom(t *testing.T) {
+	configData := `
+[[tokens]]
+name = "TokenV2"
+version = "2"
+address = "0x1234567890123456789012345678901234567890"
+deadline_minimum = 3600
+abi_file_path = "./token_v2.json"
+mode = "custom"
+fee_priority = [1000, "1000000000000000000000"]
+
+[tokens.permit]
+primary_type = "PermitWithFee"
+fields = [
+	{ name = "owner", type = "address" },
+	{ name = "receiver", type = "address" },
+	{ name = "value", type = "uint256" },
+	{ name = "fee", type = "uint256" },
+	{ name = "nonce", type = "uint256" },
+	{ name = "deadline", type = "uint256" },
+]
+function = "transferWithPermitAndFee"
+arguments = ["owner", "receiver", "value", "fee", "deadline", "v", "r", "s"]
+`
+	var configToml map[string]interface{}
+	if _, err := toml.Decode(configData, &configToml); err != nil {
+		t.Fatalf("Decode config returned error: %v", err)
+	}
+
+	tokens, err := loadTokens(configToml)
+	if err != nil {
+		t.Fatalf("loadTokens returned error: %v", err)
+	}
+	permit := tokens[0].CustomPermit
+	if permit == nil || permit.PrimaryType != "PermitWithFee" || len(permit.Fields) != 6 || permit.Function != "transferWithPermitAndFee" || len(permit.Arguments) != 8 {
+		t.Fatalf("loadTokens returned wrong custom permit: %+v", permit)
+	}
+	if !permit.HasField("fee") || tokens[0].SignatureBytes() {
+		t.Errorf("loadTokens returned wrong custom permit fields: %+v", permit)
+	}
+	if len(tokens[0].FeePriority) != 2 || tokens[0].FeePriority[1].String() != "1000000000000000000000" {
+		t.Errorf("loadTokens returned wrong fee_priority: %v", tokens[0].FeePriority)
+	}
+
+	// Fee thresholds not ascending
+	configToml["tokens"].([]map[string]interface{})[0]["fee_priority"] = []interface{}{int64(1000), int64(10)}
+	if _, err := loadTokens(configToml); err == nil {
+		t.Errorf("loadTokens expected invalid fee_priority error")
+	}
+	delete(configToml["tokens"].([]map[string]interface{})[0], "fee_priority")
+
+	// Unknown argument
+	configToml["tokens"].([]map[string]interface{})[0]["permit"].(map[string]interface{})["arguments"] = []interface{}{"owner", "amount"}
+	if _, err := loadTokens(configToml); err == nil {
+		t.Errorf("loadTokens expected unknown argument error")
+	}
+
+	// Missing required field
+	configToml["tokens"].([]map[string]interface{})[0]["permit"].(map[string]interface{})["fields"] = []map[string]interface{}{{"name": "owner", "type": "address"}}
+	if _, err := loadTokens(configToml); err == nil {
+		t.Errorf("loadTokens expected missing field error")
+	}
+}
+
+func TestLoadApiKeys(t *testing.T) {
+	apiKeys, err := loadApiKeys(map[string]interface{}{"api_keys": map[string]interface{}{"partner": int64(2)}})
+	if err != nil {
+		t.Fatalf("loadApiKeys returned error: %v", err)
+	}
+	config := Config{ApiKeys: apiKeys}
+	if config.ApiKeyPriority("partner") != 2 || config.ApiKeyPriority("unknown") != 0 || config.ApiKeyPriority("") != 0 {
+		t.Errorf("ApiKeyPriority returned wrong priority: %v", apiKeys)
+	}
+
+	if _, err := loadApiKeys(map[string]interface{}{"api_keys": map[string]interface{}{"partner": "high"}}); err == nil {
+		t.Errorf("loadApiKeys expected invalid priority error")
+	}
+}
+
+func TestLoadAdminApiKeys(t *testing.T) {
+	adminApiKeys, err := loadAdminApiKeys(map[string]interface{}{"admin_api_keys": []interface{}{"operator"}})
+	if err != nil {
+		t.Fatalf("loadAdminApiKeys returned error: %v", err)
+	}
+	config := Config{AdminApiKeys: adminApiKeys}
+	if !config.IsAdminApiKey("operator") || config.IsAdminApiKey("partner") || config.IsAdminApiKey("") {
+		t.Errorf("IsAdminApiKey returned wrong result: %v", adminApiKeys)
+	}
+
+	if _, err := loadAdminApiKeys(map[string]interface{}{"admin_api_keys": []interface{}{""}}); err == nil {
+		t.Errorf("loadAdminApiKeys expected invalid key error")
+	}
+}
+
+func TestLoadSignerAccounts(t *testing.T) {
+	signer := SignerConfig{Enable: true}
+	if err := loadSignerAccounts(map[string]interface{}{}, &signer); err == nil {
+		t.Errorf("loadSignerAccounts expected missing account error")
+	}
+
+	signer = SignerConfig{Enable: true}
+	signerToml := map[string]interface{}{
+		"keystore_file_path":  "./.keystore",
+		"keystore_file_paths": []interface{}{"./.keystore-1", "./.keystore-2"},
+		"password":            "password",
+		"mnemonic":            "test test test test test test test test test test test junk",
+		"derivation_start":    int64(2),
+		"derivation_count":    int64(5),
+		"assignment":          "least_loaded",
+	}
+	if err := loadSignerAccounts(signerToml, &signer); err != nil {
+		t.Fatalf("loadSignerAccounts returned error: %v", err)
+	}
+	if len(signer.KeystoreFilePaths) != 3 || signer.KeystoreFilePath != "./.keystore" || signer.DerivationPath != DefaultDerivationPath || signer.DerivationStart != 2 || signer.DerivationCount != 5 || signer.Assignment != AssignmentLeastLoaded {
+		t.Errorf("loadSignerAccounts returned wrong values: %+v", signer)
+	}
+
+	signerToml["derivation_path"] = "m/44'/x"
+	if err := loadSignerAccounts(signerToml, &signer); err == nil {
+		t.Errorf("loadSignerAccounts expected invalid derivation_path error")
+	}
+
+	// Remote backend without local keys
+	signer = SignerConfig{Enable: true}
+	signerToml = map[string]interface{}{
+		"backend":          "clef",
+		"backend_endpoint": "http://localhost:8550",
+		"backend_accounts": []interface{}{"0x1234567890123456789012345678901234567890"},
+	}
+	if err := loadSignerAccounts(signerToml, &signer); err != nil {
+		t.Fatalf("loadSignerAccounts returned error: %v", err)
+	}
+	if signer.Backend != SignerBackendClef || signer.BackendEndpoint != "http://localhost:8550" || len(signer.BackendAccounts) != 1 || signer.Assignment != AssignmentOwner {
+		t.Errorf("loadSignerAccounts returned wrong values: %+v", signer)
+	}
+
+	signer = SignerConfig{Enable: true}
+	delete(signerToml, "backend_endpoint")
+	if err := loadSignerAccounts(signerToml, &signer); err == nil {
+		t.Errorf("loadSignerAccounts expected missing backend_endpoint error")
+	}
+}
+
+func TestLoadSignerFees(t *testing.T) {
+	var signer SignerConfig
+	if err := loadSignerFees(map[string]interface{}{}, &signer); err != nil {
+		t.Fatalf("loadSignerFees returned error: %v", err)
+	}
+	if signer.TxType != TxTypeLegacy || signer.FeeHistoryBlocks != 10 || signer.PriorityFeePercentile != 50 || signer.BaseFeeMultiplier != 2 {
+		t.Errorf("loadSignerFees returned wrong default values: %+v", signer)
+	}
+
+	signerToml := map[string]interface{}{
+		"tx_type":                 "eip1559",
+		"fee_history_blocks":      int64(20),
+		"priority_fee_percentile": 60.5,
+		"base_fee_multiplier":     int64(3),
+		"max_priority_fee":        int64(2000000000),
+		"max_fee":                 int64(100000000000),
+		"max_gas_price":           int64(50000000000),
+	}
+	if err := loadSignerFees(signerToml, &signer); err != nil {
+		t.Fatalf("loadSignerFees returned error: %v", err)
+	}
+	if signer.TxType != TxTypeDynamicFee || signer.FeeHistoryBlocks != 20 || signer.PriorityFeePercentile != 60.5 || signer.BaseFeeMultiplier != 3 || signer.MaxPriorityFee != 2000000000 || signer.MaxFee != 100000000000 || signer.MaxGasPrice != 50000000000 {
+		t.Errorf("loadSignerFees returned wrong values: %+v", signer)
+	}
+
+	signerToml["priority_fee_percentile"] = int64(101)
+	if err := loadSignerFees(signerToml, &signer); err == nil {
+		t.Errorf("loadSignerFees expected invalid percentile error")
+	}
+}
+
+func TestLoadSignerReplacement(t *testing.T) {
+	var signer SignerConfig
+	if err := loadSignerReplacement(map[string]interface{}{}, &signer); err != nil {
+		t.Fatalf("loadSignerReplacement returned error: %v", err)
+	}
+	if signer.ReplaceAfter != 300000 || signer.FeeBumpPercent != 15 {
+		t.Errorf("loadSignerReplacement returned wrong default values: %+v", signer)
+	}
+
+	signerToml := map[string]interface{}{"replace_after": int64(0), "fee_bump_percent": int64(20)}
+	if err := loadSignerReplacement(signerToml, &signer); err != nil {
+		t.Fatalf("loadSignerReplacement returned error: %v", err)
+	}
+	if signer.ReplaceAfter != 0 || signer.FeeBumpPercent != 20 {
+		t.Errorf("loadSignerReplacement returned wrong values: %+v", signer)
+	}
+
+	signerToml["fee_bump_percent"] = int64(5)
+	if err := loadSignerReplacement(signerToml, &signer); err == nil {
+		t.Errorf("loadSignerReplacement expected invalid fee_bump_percent error")
+	}
+}
+
+func TestLoadSignerBalance(t *testing.T) {
+	var signer SignerConfig
+	if err := loadSignerBalance(map[string]interface{}{}, &signer); err != nil {
+		t.Fatalf("loadSignerBalance returned error: %v", err)
+	}
+	if signer.BalanceCheckInterval != 60000 || signer.BalanceWarningTxs != 50 || signer.BalanceMinTxs != 1 {
+		t.Errorf("loadSignerBalance returned wrong default values: %+v", signer)
+	}
+
+	signerToml := map[string]interface{}{"balance_check_interval": int64(30000), "balance_warning_txs": int64(200), "balance_min_txs": int64(10)}
+	if err := loadSignerBalance(signerToml, &signer); err != nil {
+		t.Fatalf("loadSignerBalance returned error: %v", err)
+	}
+	if signer.BalanceCheckInterval != 30000 || signer.BalanceWarningTxs != 200 || signer.BalanceMinTxs != 10 {
+		t.Errorf("loadSignerBalance returned wrong values: %+v", signer)
+	}
+
+	signerToml["balance_warning_txs"] = int64(5)
+	if err := loadSignerBalance(signerToml, &signer); err == nil {
+		t.Errorf("loadSignerBalance expected invalid balance_warning_txs error")
+	}
+}
+
+func TestLoadSignerRetry(t *testing.T) {
+	var signer SignerConfig
+	if err := loadSignerRetry(map[string]interface{}{}, &signer); err != nil {
+		t.Fatalf("loadSignerRetry returned error: %v", err)
+	}
+	if signer.RetryInterval != 30000 || signer.RetryBackoff != 60000 || signer.RetryMaxAttempts != 3 {
+		t.Errorf("loadSignerRetry returned wrong default values: %+v", signer)
+	}
+
+	signerToml := map[string]interface{}{"retry_interval": int64(10000), "retry_backoff": int64(5000), "retry_max_attempts": int64(5)}
+	if err := loadSignerRetry(signerToml, &signer); err != nil {
+		t.Fatalf("loadSignerRetry returned error: %v", err)
+	}
+	if signer.RetryInterval != 10000 || signer.RetryBackoff != 5000 || signer.RetryMaxAttempts != 5 {
+		t.Errorf("loadSignerRetry returned wrong values: %+v", signer)
+	}
+
+	signerToml["retry_max_attempts"] = int64(-1)
+	if err := loadSignerRetry(signerToml, &signer); err == nil {
+		t.Errorf("loadSignerRetry expected invalid retry_max_attempts error")
+	}
+}
+
+func TestLoadSignerGas(t *testing.T) {
+	var signer SignerConfig
+	if err := loadSignerGas(map[string]interface{}{}, &signer); err != nil {
+		t.Fatalf("loadSignerGas returned error: %v", err)
+	}
+	if signer.GasEstimateMultiplier != 1.2 {
+		t.Errorf("loadSignerGas returned wrong default values: %+v", signer)
+	}
+
+	signerToml := map[string]interface{}{"gas_estimate_multiplier": 1.5}
+	if err := loadSignerGas(signerToml, &signer); err != nil || signer.GasEstimateMultiplier != 1.5 {
+		t.Errorf("loadSignerGas returned wrong values: %+v, %v", signer, err)
+	}
+
+	signerToml["gas_estimate_multiplier"] = 0.5
+	if err := loadSignerGas(signerToml, &signer); err == nil {
+		t.Errorf("loadSignerGas expected invalid gas_estimate_multiplier error")
+	}
+}
+
+func TestLoadSignerFeePolicy(t *testing.T) {
+	var signer SignerConfig
+	if err := loadSignerFeePolicy(map[string]interface{}{}, &signer); err != nil {
+		t.Fatalf("loadSignerFeePolicy returned error: %v", err)
+	}
+	if signer.FeeCeiling != 0 || signer.FeeTarget != 0 || signer.FeeUrgentWindow != 600000 || signer.FeeEmergencyBudget != 0 {
+		t.Errorf("loadSignerFeePolicy returned wrong default values: %+v", signer)
+	}
+
+	signerToml := map[string]interface{}{
+		"fee_ceiling":          int64(100000000000),
+		"fee_target":           int64(30000000000),
+		"fee_urgent_window":    int64(300000),
+		"fee_emergency_budget": int64(1000000000000000000),
+	}
+	if err := loadSignerFeePolicy(signerToml, &signer); err != nil {
+		t.Fatalf("loadSignerFeePolicy returned error: %v", err)
+	}
+	if signer.FeeCeiling != 100000000000 || signer.FeeTarget != 30000000000 || signer.FeeUrgentWindow != 300000 || signer.FeeEmergencyBudget != 1000000000000000000 {
+		t.Errorf("loadSignerFeePolicy returned wrong values: %+v", signer)
+	}
+
+	signerToml["fee_target"] = int64(200000000000)
+	if err := loadSignerFeePolicy(signerToml, &signer); err == nil {
+		t.Errorf("loadSignerFeePolicy expected invalid fee_target error")
+	}
+}
+
+func TestLoadSignerBatch(t *testing.T) {
+	var signer SignerConfig
+	if err := loadSignerBatch(map[string]interface{}{}, &signer); err != nil {
+		t.Fatalf("loadSignerBatch returned error: %v", err)
+	}
+	if signer.BatchSize != 0 || signer.BatchExecutor != Multicall3Address {
+		t.Errorf("loadSignerBatch returned wrong default values: %+v", signer)
+	}
+
+	signerToml := map[string]interface{}{
+		"batch_size":     int64(20),
+		"batch_executor": "0x1234567890123456789012345678901234567890",
+	}
+	if err := loadSignerBatch(signerToml, &signer); err != nil {
+		t.Fatalf("loadSignerBatch returned error: %v", err)
+	}
+	if signer.BatchSize != 20 || signer.BatchExecutor != geth_common.HexToAddress("0x1234567890123456789012345678901234567890") {
+		t.Errorf("loadSignerBatch returned wrong values: %+v", signer)
+	}
+
+	signerToml["batch_size"] = int64(101)
+	if err := loadSignerBatch(signerToml, &signer); err == nil {
+		t.Errorf("loadSignerBatch expected invalid batch_size error")
+	}
+}
@@ -2,6 +2,7 @@ package common
 
 import (
 	"fmt"
+	"math/big"
 
 	geth_common "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/math"
@@ -9,29 +10,229 @@ import (
 	"github.com/ethereum/go-ethereum/signer/core/apitypes"
 )
 
+var eip712DomainType = []apitypes.Type{
+	{
+		Name: "name",
+		Type: "string",
+	},
+	{
+		Name: "version",
+		Type: "string",
+	},
+	{
+		Name: "chainId",
+		Type: "uint256",
+	},
+	{
+		Name: "verifyingContract",
+		Type: "address",
+	},
+}
+
+// MakeTypedData makes the typed data signed for a permit of the token mode
+func MakeTypedData(mode string, domain Domain, values PermitType) *apitypes.TypedData {
+	switch mode {
+	case TokenModeEIP2612:
+		return MakeEIP2612TypedData(domain, values)
+	case TokenModeEIP3009:
+		return MakeEIP3009TypedData(domain, values)
+	case TokenModePermit2:
+		return MakePermit2TypedData(domain, values)
+	default:
+		return MakePermitTypedData(domain, values)
+	}
+}
+
+// MakeTokenTypedData makes the typed data signed for a permit of the token, including custom permit types
+func MakeTokenTypedData(token *TokenConfig, domain Domain, values PermitType) *apitypes.TypedData {
+	if token.Mode == TokenModeCustom {
+		return MakeCustomTypedData(token.CustomPermit, domain, values)
+	}
+	return MakeTypedData(token.Mode, domain, values)
+}
+
+// DomainSeparator returns the EIP-712 domain separator of the token mode, as returned by DOMAIN_SEPARATOR()
+func DomainSeparator(mode string, domain Domain) ([]byte, error) {
+	typedData := MakeTypedData(mode, domain, PermitType{})
+	return typedData.HashStruct("EIP712Domain", typedData.Domain.Map())
+}
+
+// VerifySignature recovers the signer of Permit(owner, receiver, value, nonce, deadline)
 func VerifySignature(domain Domain, values PermitType, signature []byte) (geth_common.Address, error) {
-	// EIP-2098; pull the v from the top bit of s and clear it
-	if len(signature) != 65 {
-		return Address0x0, fmt.Errorf("invalid signature length: %d", len(signature))
+	return recoverTypedDataSigner(MakePermitTypedData(domain, values), signature)
+}
+
+// VerifyEIP2612Signature recovers the signer of standard EIP-2612 Permit(owner, spender, value, nonce, deadline)
+func VerifyEIP2612Signature(domain Domain, values PermitType, signature []byte) (geth_common.Address, error) {
+	return recoverTypedDataSigner(MakeEIP2612TypedData(domain, values), signature)
+}
+
+// VerifyEIP3009Signature recovers the signer of EIP-3009 TransferWithAuthorization(from, to, value, validAfter, validBefore, nonce)
+func VerifyEIP3009Signature(domain Domain, values PermitType, signature []byte) (geth_common.Address, error) {
+	return recoverTypedDataSigner(MakeEIP3009TypedData(domain, values), signature)
+}
+
+// VerifyPermit2Signature recovers the signer of Permit2 PermitTransferFrom(TokenPermissions permitted, spender, nonce, deadline)
+// domain is Permit2 with name, chainId, verifyingContract and without version
+func VerifyPermit2Signature(domain Domain, values PermitType, signature []byte) (geth_common.Address, error) {
+	return recoverTypedDataSigner(MakePermit2TypedData(domain, values), signature)
+}
+
+// VerifyCustomSignature recovers the signer of a custom permit type loaded from config
+func VerifyCustomSignature(permit *CustomPermitConfig, domain Domain, values PermitType, signature []byte) (geth_common.Address, error) {
+	return recoverTypedDataSigner(MakeCustomTypedData(permit, domain, values), signature)
+}
+
+// MakePermitTypedData makes the typed data of Permit(owner, receiver, value, nonce, deadline)
+func MakePermitTypedData(domain Domain, values PermitType) *apitypes.TypedData {
+	// Make permit type values
+	var typedData = &apitypes.TypedData{
+		Domain:      makeTypedDataDomain(domain),
+		PrimaryType: "Permit",
+		Message: apitypes.TypedDataMessage{
+			"owner":    values.Owner.Hex(),
+			"receiver": values.Receiver.Hex(),
+			"value":    values.Value,
+			"nonce":    values.Nonce,
+			"deadline": values.Deadline,
+		},
+		Types: apitypes.Types{
+			"EIP712Domain": eip712DomainType,
+			"Permit": {
+				{
+					Name: "owner",
+					Type: "address",
+				},
+				{
+					Name: "receiver",
+					Type: "address",
+				},
+				{
+					Name: "value",
+					Type: "uint256",
+				},
+				{
+					Name: "nonce",
+					Type: "uint256",
+				},
+				{
+					Name: "deadline",
+					Type: "uint256",
+				},
+			},
+		},
 	}
 
-	if signature[64] != 27 && signature[64] != 28 {
-		return Address0x0, fmt.Errorf("invalid recovery id: %d", signature[64])
+	return typedData
+}
+
+// MakeEIP2612TypedData makes the typed data of standard EIP-2612 Permit(owner, spender, value, nonce, deadline)
+func MakeEIP2612TypedData(domain Domain, values PermitType) *apitypes.TypedData {
+	// Make permit type values
+	var typedData = &apitypes.TypedData{
+		Domain:      makeTypedDataDomain(domain),
+		PrimaryType: "Permit",
+		Message: apitypes.TypedDataMessage{
+			"owner":    values.Owner.Hex(),
+			"spender":  values.Spender.Hex(),
+			"value":    values.Value,
+			"nonce":    values.Nonce,
+			"deadline": values.Deadline,
+		},
+		Types: apitypes.Types{
+			"EIP712Domain": eip712DomainType,
+			"Permit": {
+				{
+					Name: "owner",
+					Type: "address",
+				},
+				{
+					Name: "spender",
+					Type: "address",
+				},
+				{
+					Name: "value",
+					Type: "uint256",
+				},
+				{
+					Name: "nonce",
+					Type: "uint256",
+				},
+				{
+					Name: "deadline",
+					Type: "uint256",
+				},
+			},
+		},
+	}
+
+	return typedData
+}
+
+// MakeEIP3009TypedData makes the typed data of EIP-3009 TransferWithAuthorization(from, to, value, validAfter, validBefore, nonce)
+func MakeEIP3009TypedData(domain Domain, values PermitType) *apitypes.TypedData {
+	// Make authorization type values
+	var typedData = &apitypes.TypedData{
+		Domain:      makeTypedDataDomain(domain),
+		PrimaryType: "TransferWithAuthorization",
+		Message: apitypes.TypedDataMessage{
+			"from":        values.Owner.Hex(),
+			"to":          values.Receiver.Hex(),
+			"value":       values.Value,
+			"validAfter":  values.ValidAfter,
+			"validBefore": values.Deadline,
+			"nonce":       geth_common.BigToHash(values.Nonce).Hex(),
+		},
+		Types: apitypes.Types{
+			"EIP712Domain": eip712DomainType,
+			"TransferWithAuthorization": {
+				{
+					Name: "from",
+					Type: "address",
+				},
+				{
+					Name: "to",
+					Type: "address",
+				},
+				{
+					Name: "value",
+					Type: "uint256",
+				},
+				{
+					Name: "validAfter",
+					Type: "uint256",
+				},
+				{
+					Name: "validBefore",
+					Type: "uint256",
+				},
+				{
+					Name: "nonce",
+					Type: "bytes32",
+				},
+			},
+		},
 	}
-	signature[64] -= 27
 
+	return typedData
+}
+
+// MakePermit2TypedData makes the typed data of Permit2 PermitTransferFrom(TokenPermissions permitted, spender, nonce, deadline)
+func MakePermit2TypedData(domain Domain, values PermitType) *apitypes.TypedData {
 	// Make permit type values
 	var typedData = &apitypes.TypedData{
 		Domain: apitypes.TypedDataDomain{
 			Name:              domain.Name,
-			Version:           domain.Version,
 			ChainId:           math.NewHexOrDecimal256(domain.ChainId),
 			VerifyingContract: domain.VerifyingContract.Hex(),
 		},
+		PrimaryType: "PermitTransferFrom",
 		Message: apitypes.TypedDataMessage{
-			"owner":    values.Owner.Hex(),
-			"receiver": values.Receiver.Hex(),
-			"value":    values.Value,
+			"permitted": map[string]interface{}{
+				"token":  values.Token.Hex(),
+				"amount": values.Value,
+			},
+			"spender":  values.Spender.Hex(),
 			"nonce":    values.Nonce,
 			"deadline": values.Deadline,
 		},
@@ -41,10 +242,6 @@ func VerifySignature(domain Domain, values PermitType, signature []byte) (geth_c
 					Name: "name",
 					Type: "string",
 				},
-				{
-					Name: "version",
-					Type: "string",
-				},
 				{
 					Name: "chainId",
 					Type: "uint256",
@@ -54,42 +251,109 @@ func VerifySignature(domain Domain, values PermitType, signature []byte) (geth_c
 					Type: "address",
 				},
 			},
-			"Permit": {
+			"PermitTransferFrom": {
 				{
-					Name: "owner",
-					Type: "address",
+					Name: "permitted",
+					Type: "TokenPermissions",
 				},
 				{
-					Name: "receiver",
+					Name: "spender",
 					Type: "address",
 				},
 				{
-					Name: "value",
+					Name: "nonce",
 					Type: "uint256",
 				},
 				{
-					Name: "nonce",
+					Name: "deadline",
 					Type: "uint256",
 				},
+			},
+			"TokenPermissions": {
 				{
-					Name: "deadline",
+					Name: "token",
+					Type: "address",
+				},
+				{
+					Name: "amount",
 					Type: "uint256",
 				},
 			},
 		},
 	}
 
+	return typedData
+}
+
+func MakeCustomTypedData(permit *CustomPermitConfig, domain Domain, values PermitType) *apitypes.TypedData {
+	// Make permit type values
+	permitType := make([]apitypes.Type, len(permit.Fields))
+	message := apitypes.TypedDataMessage{}
+	for i, field := range permit.Fields {
+		permitType[i] = apitypes.Type{Name: field.Name, Type: field.Type}
+
+		value := values.Fields[field.Name]
+		if address, ok := value.(geth_common.Address); ok {
+			value = address.Hex()
+		}
+		message[field.Name] = value
+	}
+
+	return &apitypes.TypedData{
+		Domain:      makeTypedDataDomain(domain),
+		PrimaryType: permit.PrimaryType,
+		Message:     message,
+		Types: apitypes.Types{
+			"EIP712Domain":     eip712DomainType,
+			permit.PrimaryType: permitType,
+		},
+	}
+}
+
+// Permit2NonceBitmapPosition returns the word position and bit of an unordered Permit2 nonce
+func Permit2NonceBitmapPosition(nonce *big.Int) (*big.Int, uint) {
+	wordPos := new(big.Int).Rsh(nonce, 8)
+	bitPos := uint(new(big.Int).And(nonce, big.NewInt(0xff)).Uint64())
+	return wordPos, bitPos
+}
+
+func makeTypedDataDomain(domain Domain) apitypes.TypedDataDomain {
+	return apitypes.TypedDataDomain{
+		Name:              domain.Name,
+		Version:           domain.Version,
+		ChainId:           math.NewHexOrDecimal256(domain.ChainId),
+		VerifyingContract: domain.VerifyingContract.Hex(),
+	}
+}
+
+// HashTypedData returns the EIP-712 hash to be signed of the typed data
+func HashTypedData(typedData *apitypes.TypedData) ([]byte, error) {
 	// Encodes domain type data
 	encodeTypedData, err := encodeDomainTypeData(typedData)
 	if err != nil {
-		return Address0x0, err
+		return nil, err
 	}
 
 	// Hash encoded
-	messageHash := crypto.Keccak256([]byte(encodeTypedData))
+	return crypto.Keccak256(encodeTypedData), nil
+}
+
+// RecoverSigner recovers the EOA signer of a 65 bytes or EIP-2098 compact signature, signature is not modified
+func RecoverSigner(hash []byte, signature []byte) (geth_common.Address, error) {
+	sig, err := NormalizeSignature(signature, true)
+	if err != nil {
+		return Address0x0, err
+	}
+	if len(sig) != 65 {
+		return Address0x0, fmt.Errorf("invalid signature length: %d", len(sig))
+	}
+	if sig[64] != 27 && sig[64] != 28 {
+		return Address0x0, fmt.Errorf("invalid recovery id: %d", sig[64])
+	}
+	sig[64] -= 27
 
 	// Recover the public key of signer address from the signature
-	signerPublicKey, err := crypto.Ecrecover(messageHash, signature)
+	signerPublicKey, err := crypto.Ecrecover(hash, sig)
 	if err != nil {
 		return Address0x0, err
 	}
@@ -105,13 +369,21 @@ func VerifySignature(domain Domain, values PermitType, signature []byte) (geth_c
 	return signerAddress, nil
 }
 
+func recoverTypedDataSigner(typedData *apitypes.TypedData, signature []byte) (geth_common.Address, error) {
+	hash, err := HashTypedData(typedData)
+	if err != nil {
+		return Address0x0, err
+	}
+	return RecoverSigner(hash, signature)
+}
+
 func encodeDomainTypeData(typedData *apitypes.TypedData) ([]byte, error) {
 	domainSeparator, err := typedData.HashStruct("EIP712Domain", typedData.Domain.Map())
 	if err != nil {
 		return nil, err
 	}
 
-	typedDataHash, err := typedData.HashStruct("Permit", typedData.Message)
+	typedDataHash, err := typedData.HashStruct(typedData.PrimaryType, typedData.Message)
 	if err != nil {
 		return nil, err
 	}
@@ -1,11 +1,15 @@
 package common
 
 import (
+	"crypto/ecdsa"
 	"encoding/hex"
 	"math/big"
 	"testing"
 
 	geth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
 )
 
 func TestVerifySignature(t *testing.T) {
@@ -37,3 +41,287 @@ func TestVerifySignature(t *testing.T) {
 		t.Errorf("VerifySignature returned wrong address: expected %v, got %v", ownerAddress, signerAddress)
 	}
 }
+
+const testPrivateKey = "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+
+// signTypedData signs typed data hashed by go-ethereum apitypes, with v in 27/28
+func signTypedData(t *testing.T, privateKey *ecdsa.PrivateKey, typedData apitypes.TypedData) []byte {
+	hash, _, err := apitypes.TypedDataAndHash(typedData)
+	if err != nil {
+		t.Fatalf("TypedDataAndHash returned error: %v", err)
+	}
+	signature, err := crypto.Sign(hash, privateKey)
+	if err != nil {
+		t.Fatalf("Sign returned error: %v", err)
+	}
+	signature[64] += 27
+	return signature
+}
+
+func TestVerifyEIP2612Signature(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA(testPrivateKey)
+	ownerAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	domain := Domain{
+		Name:              "Test",
+		Version:           "1",
+		ChainId:           1,
+		VerifyingContract: geth_common.HexToAddress("0x1234567890123456789012345678901234567890"),
+	}
+	values := PermitType{
+		Owner:    ownerAddress,
+		Spender:  geth_common.HexToAddress("0x0987654321098765432109876543210987654321"),
+		Value:    big.NewInt(1000000000),
+		Nonce:    big.NewInt(0),
+		Deadline: big.NewInt(1695600000),
+	}
+
+	// Sign with the standard EIP-2612 typed data
+	typedData := apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": eip712DomainType,
+			"Permit": {
+				{Name: "owner", Type: "address"},
+				{Name: "spender", Type: "address"},
+				{Name: "value", Type: "uint256"},
+				{Name: "nonce", Type: "uint256"},
+				{Name: "deadline", Type: "uint256"},
+			},
+		},
+		PrimaryType: "Permit",
+		Domain:      makeTypedDataDomain(domain),
+		Message: apitypes.TypedDataMessage{
+			"owner":    values.Owner.Hex(),
+			"spender":  values.Spender.Hex(),
+			"value":    values.Value.String(),
+			"nonce":    values.Nonce.String(),
+			"deadline": values.Deadline.String(),
+		},
+	}
+	signature := signTypedData(t, privateKey, typedData)
+
+	signerAddress, err := VerifyEIP2612Signature(domain, values, signature)
+	if err != nil {
+		t.Errorf("VerifyEIP2612Signature returned error: %v", err)
+	}
+	if signerAddress != ownerAddress {
+		t.Errorf("VerifyEIP2612Signature returned wrong address: expected %v, got %v", ownerAddress, signerAddress)
+	}
+
+	// Custom Permit type must not recover the owner
+	signerAddress, _ = VerifySignature(domain, values, signature)
+	if signerAddress == ownerAddress {
+		t.Errorf("VerifySignature recovered owner from EIP-2612 signature")
+	}
+}
+
+func TestVerifyEIP3009Signature(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA(testPrivateKey)
+	ownerAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	domain := Domain{
+		Name:              "USD Coin",
+		Version:           "2",
+		ChainId:           1,
+		VerifyingContract: geth_common.HexToAddress("0x1234567890123456789012345678901234567890"),
+	}
+	nonce := geth_common.HexToHash("0x9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08")
+	values := PermitType{
+		Owner:      ownerAddress,
+		Receiver:   geth_common.HexToAddress("0x0987654321098765432109876543210987654321"),
+		Value:      big.NewInt(1000000),
+		Nonce:      nonce.Big(),
+		Deadline:   big.NewInt(1695600000),
+		ValidAfter: big.NewInt(0),
+	}
+
+	// Sign with the EIP-3009 typed data
+	typedData := apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": eip712DomainType,
+			"TransferWithAuthorization": {
+				{Name: "from", Type: "address"},
+				{Name: "to", Type: "address"},
+				{Name: "value", Type: "uint256"},
+				{Name: "validAfter", Type: "uint256"},
+				{Name: "validBefore", Type: "uint256"},
+				{Name: "nonce", Type: "bytes32"},
+			},
+		},
+		PrimaryType: "TransferWithAuthorization",
+		Domain:      makeTypedDataDomain(domain),
+		Message: apitypes.TypedDataMessage{
+			"from":        values.Owner.Hex(),
+			"to":          values.Receiver.Hex(),
+			"value":       "1000000",
+			"validAfter":  "0",
+			"validBefore": "1695600000",
+			"nonce":       nonce.Hex(),
+		},
+	}
+	signature := signTypedData(t, privateKey, typedData)
+
+	signerAddress, err := VerifyEIP3009Signature(domain, values, signature)
+	if err != nil {
+		t.Errorf("VerifyEIP3009Signature returned error: %v", err)
+	}
+	if signerAddress != ownerAddress {
+		t.Errorf("VerifyEIP3009Signature returned wrong address: expected %v, got %v", ownerAddress, signerAddress)
+	}
+}
+
+func TestVerifyPermit2Signature(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA(testPrivateKey)
+	ownerAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	domain := Domain{
+		Name:              "Permit2",
+		ChainId:           1,
+		VerifyingContract: Permit2Address,
+	}
+	values := PermitType{
+		Owner:    ownerAddress,
+		Receiver: geth_common.HexToAddress("0x0987654321098765432109876543210987654321"),
+		Spender:  geth_common.HexToAddress("0x1111111111111111111111111111111111111111"),
+		Token:    geth_common.HexToAddress("0x1234567890123456789012345678901234567890"),
+		Value:    big.NewInt(1000000),
+		Nonce:    big.NewInt(258),
+		Deadline: big.NewInt(1695600000),
+	}
+
+	// Sign with the Permit2 typed data
+	typedData := apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+			"PermitTransferFrom": {
+				{Name: "permitted", Type: "TokenPermissions"},
+				{Name: "spender", Type: "address"},
+				{Name: "nonce", Type: "uint256"},
+				{Name: "deadline", Type: "uint256"},
+			},
+			"TokenPermissions": {
+				{Name: "token", Type: "address"},
+				{Name: "amount", Type: "uint256"},
+			},
+		},
+		PrimaryType: "PermitTransferFrom",
+		Domain: apitypes.TypedDataDomain{
+			Name:              "Permit2",
+			ChainId:           math.NewHexOrDecimal256(1),
+			VerifyingContract: Permit2Address.Hex(),
+		},
+		Message: apitypes.TypedDataMessage{
+			"permitted": map[string]interface{}{
+				"token":  values.Token.Hex(),
+				"amount": "1000000",
+			},
+			"spender":  values.Spender.Hex(),
+			"nonce":    "258",
+			"deadline": "1695600000",
+		},
+	}
+	signature := signTypedData(t, privateKey, typedData)
+
+	signerAddress, err := VerifyPermit2Signature(domain, values, signature)
+	if err != nil {
+		t.Errorf("VerifyPermit2Signature returned error: %v", err)
+	}
+	if signerAddress != ownerAddress {
+		t.Errorf("VerifyPermit2Signature returned wrong address: expected %v, got %v", ownerAddress, signerAddress)
+	}
+}
+
+func TestPermit2NonceBitmapPosition(t *testing.T) {
+	wordPos, bitPos := Permit2NonceBitmapPosition(big.NewInt(258))
+	if wordPos.Cmp(big.NewInt(1)) != 0 || bitPos != 2 {
+		t.Errorf("Permit2NonceBitmapPosition returned wrong position: expected 1/2, got %v/%v", wordPos, bitPos)
+	}
+}
+
+func TestDomainSeparator(t *testing.T) {
+	// USDC on Ethereum mainnet
+	domain := Domain{
+		Name:              "USD Coin",
+		Version:           "2",
+		ChainId:           1,
+		VerifyingContract: geth_common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"),
+	}
+
+	separator, err := DomainSeparator(TokenModeEIP2612, domain)
+	if err != nil {
+		t.Fatalf("DomainSeparator returned error: %v", err)
+	}
+	expected := "06c37168a7db5138defc7866392bb87a741f9b3d104deb5094588ce041cae335"
+	if hex.EncodeToString(separator) != expected {
+		t.Errorf("DomainSeparator returned wrong separator: expected %v, got %x", expected, separator)
+	}
+}
+
+func TestVerifyCustomSignature(t *testing.T) {
+	privateKey, err := crypto.HexToECDSA(testPrivateKey)
+	if err != nil {
+		t.Fatalf("HexToECDSA returned error: %v", err)
+	}
+	ownerAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+
+	domain := Domain{
+		Name:              "Test",
+		Version:           "2",
+		ChainId:           11155111,
+		VerifyingContract: geth_common.HexToAddress("0x1234567890123456789012345678901234567890"),
+	}
+	values := PermitType{
+		Owner:    ownerAddress,
+		Receiver: geth_common.HexToAddress("0x0987654321098765432109876543210987654321"),
+		Value:    big.NewInt(1000),
+		Nonce:    big.NewInt(0),
+		Deadline: big.NewInt(1700000000),
+	}
+	values.Fields = map[string]interface{}{
+		"owner":    values.Owner,
+		"receiver": values.Receiver,
+		"value":    values.Value,
+		"nonce":    values.Nonce,
+		"deadline": values.Deadline,
+	}
+
+	// Custom type of the builtin Permit fields hashes the same
+	permit := &CustomPermitConfig{
+		PrimaryType: "Permit",
+		Fields: []PermitField{
+			{Name: "owner", Type: "address"},
+			{Name: "receiver", Type: "address"},
+			{Name: "value", Type: "uint256"},
+			{Name: "nonce", Type: "uint256"},
+			{Name: "deadline", Type: "uint256"},
+		},
+	}
+	customHash, err := HashTypedData(MakeCustomTypedData(permit, domain, values))
+	if err != nil {
+		t.Fatalf("HashTypedData returned error: %v", err)
+	}
+	permitHash, _ := HashTypedData(MakePermitTypedData(domain, values))
+	if hex.EncodeToString(customHash) != hex.EncodeToString(permitHash) {
+		t.Errorf("MakeCustomTypedData returned wrong hash: expected %x, got %x", permitHash, customHash)
+	}
+
+	// Custom type with fee
+	permit.Fields = append(permit.Fields, PermitField{Name: "fee", Type: "uint256"})
+	values.Fields["fee"] = big.NewInt(10)
+	signature := signTypedData(t, privateKey, *MakeCustomTypedData(permit, domain, values))
+
+	signerAddress, err := VerifyCustomSignature(permit, domain, values, signature)
+	if err != nil {
+		t.Errorf("VerifyCustomSignature returned error: %v", err)
+	}
+	if signerAddress != ownerAddress {
+		t.Errorf("VerifyCustomSignature returned wrong address: expected %v, got %v", ownerAddress, signerAddress)
+	}
+
+	values.Fields["fee"] = big.NewInt(11)
+	signerAddress, _ = VerifyCustomSignature(permit, domain, values, signature)
+	if signerAddress == ownerAddress {
+		t.Errorf("VerifyCustomSignature recovered owner with modified fee")
+	}
+}
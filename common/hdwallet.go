@@ -0,0 +1,110 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// BIP-39 English wordlist
+//
+//go:embed bip39_english.txt
+var bip39English string
+
+var bip39Words = func() map[string]int {
+	words := make(map[string]int)
+	for i, word := range strings.Fields(bip39English) {
+		words[word] = i
+	}
+	return words
+}()
+
+// ValidateMnemonic checks the mnemonic words against the BIP-39 English wordlist and its checksum
+func ValidateMnemonic(mnemonic string) error {
+	words := strings.Fields(mnemonic)
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return fmt.Errorf("mnemonic has %d words, require 12, 15, 18, 21 or 24", len(words))
+	}
+
+	// 11 bits per word, entropy followed by the first entropy bits/32 bits of its sha256
+	bits := new(big.Int)
+	for _, word := range words {
+		index, ok := bip39Words[word]
+		if !ok {
+			return fmt.Errorf("mnemonic word %q is not in the BIP-39 wordlist", word)
+		}
+		bits.Lsh(bits, 11)
+		bits.Or(bits, big.NewInt(int64(index)))
+	}
+	checksumBits := uint(len(words) * 11 / 33)
+	checksum := new(big.Int).And(bits, big.NewInt(1<<checksumBits-1))
+	entropy := new(big.Int).Rsh(bits, checksumBits).FillBytes(make([]byte, checksumBits*4))
+
+	hash := sha256.Sum256(entropy)
+	if uint64(hash[0]>>(8-checksumBits)) != checksum.Uint64() {
+		return fmt.Errorf("invalid mnemonic checksum")
+	}
+	return nil
+}
+
+// MnemonicSeed returns the BIP-39 seed of the mnemonic
+func MnemonicSeed(mnemonic string, passphrase string) []byte {
+	words := strings.Join(strings.Fields(mnemonic), " ")
+	return pbkdf2.Key([]byte(words), []byte("mnemonic"+passphrase), 2048, 64, sha512.New)
+}
+
+// DeriveHDKey derives the BIP-32 private key of the path from the seed
+func DeriveHDKey(seed []byte, path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	curveOrder := crypto.S256().Params().N
+
+	// Master key
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	key := new(big.Int).SetBytes(sum[:32])
+	chainCode := sum[32:]
+	if key.Sign() == 0 || key.Cmp(curveOrder) >= 0 {
+		return nil, fmt.Errorf("invalid master key")
+	}
+
+	for _, index := range path {
+		// Hardened child from the private key, normal child from the compressed public key
+		var data []byte
+		if index >= 0x80000000 {
+			data = append([]byte{0}, key.FillBytes(make([]byte, 32))...)
+		} else {
+			privateKey, err := crypto.ToECDSA(key.FillBytes(make([]byte, 32)))
+			if err != nil {
+				return nil, err
+			}
+			data = crypto.CompressPubkey(&privateKey.PublicKey)
+		}
+		data = binary.BigEndian.AppendUint32(data, index)
+
+		mac := hmac.New(sha512.New, chainCode)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+		tweak := new(big.Int).SetBytes(sum[:32])
+		if tweak.Cmp(curveOrder) >= 0 {
+			return nil, fmt.Errorf("invalid child key %d", index)
+		}
+		key = tweak.Add(tweak, key)
+		key.Mod(key, curveOrder)
+		if key.Sign() == 0 {
+			return nil, fmt.Errorf("invalid child key %d", index)
+		}
+		chainCode = sum[32:]
+	}
+
+	return crypto.ToECDSA(key.FillBytes(make([]byte, 32)))
+}
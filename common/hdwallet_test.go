@@ -0,0 +1,52 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	geth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestDeriveHDKey(t *testing.T) {
+	seed := MnemonicSeed("test test test test test test test test test test test junk", "")
+
+	expected := []string{
+		"0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266",
+		"0x70997970C51812dc3A010C7d01b50e0d17dc79C8",
+	}
+	for i, address := range expected {
+		path, err := accounts.ParseDerivationPath(DefaultDerivationPath)
+		if err != nil {
+			t.Fatalf("ParseDerivationPath returned error: %v", err)
+		}
+		path = append(path, uint32(i))
+
+		key, err := DeriveHDKey(seed, path)
+		if err != nil {
+			t.Fatalf("DeriveHDKey returned error: %v", err)
+		}
+		if crypto.PubkeyToAddress(key.PublicKey) != geth_common.HexToAddress(address) {
+			t.Errorf("DeriveHDKey returned wrong address of index %d: %s", i, crypto.PubkeyToAddress(key.PublicKey).Hex())
+		}
+	}
+}
+
+func TestValidateMnemonic(t *testing.T) {
+	cases := []struct {
+		mnemonic string
+		valid    bool
+	}{
+		{"test test test test test test test test test test test junk", true},
+		{"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", true},
+		{"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art", true},
+		{"test test test test test test test test test test test test", false},  // wrong checksum
+		{"test test test test test test test test test test test junky", false}, // not in the wordlist
+		{"test test test test test test test test test test junk", false},       // 11 words
+	}
+	for _, c := range cases {
+		if err := ValidateMnemonic(c.mnemonic); (err == nil) != c.valid {
+			t.Errorf("ValidateMnemonic returned %v for %q", err, c.mnemonic)
+		}
+	}
+}
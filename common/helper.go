@@ -9,7 +9,7 @@ func ParseEther(wei *big.Int) *big.Float {
 	return new(big.Float).Quo(new(big.Float).SetInt(wei), BigFloatBase18)
 }
 
-func MakeJsonResponseResult(id float64, result string) ([]byte, error) {
+func MakeJsonResponseResult(id float64, result interface{}) ([]byte, error) {
 	response := map[string]interface{}{
 		"jsonrpc": "2.0",
 		"id":      id,
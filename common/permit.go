@@ -0,0 +1,128 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	geth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// permitJSON is the stored form of a verified permit, numbers are decimal strings
+type permitJSON struct {
+	Owner      string            `json:"owner"`
+	Receiver   string            `json:"receiver"`
+	Spender    string            `json:"spender"`
+	Value      string            `json:"value"`
+	Nonce      string            `json:"nonce"`
+	Deadline   string            `json:"deadline"`
+	ValidAfter string            `json:"validAfter,omitempty"`
+	Token      string            `json:"token"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+// EncodePermit encodes the permit values to JSON
+func EncodePermit(values PermitType) ([]byte, error) {
+	permit := permitJSON{
+		Owner:    values.Owner.Hex(),
+		Receiver: values.Receiver.Hex(),
+		Spender:  values.Spender.Hex(),
+		Value:    values.Value.String(),
+		Nonce:    values.Nonce.String(),
+		Deadline: values.Deadline.String(),
+		Token:    values.Token.Hex(),
+	}
+	if values.ValidAfter != nil {
+		permit.ValidAfter = values.ValidAfter.String()
+	}
+
+	// Custom permit fields
+	if values.Fields != nil {
+		permit.Fields = make(map[string]string)
+		for name, value := range values.Fields {
+			switch v := value.(type) {
+			case geth_common.Address:
+				permit.Fields[name] = v.Hex()
+			case *big.Int:
+				permit.Fields[name] = v.String()
+			case geth_common.Hash:
+				permit.Fields[name] = v.Hex()
+			case bool:
+				permit.Fields[name] = strconv.FormatBool(v)
+			case string:
+				permit.Fields[name] = v
+			default:
+				return nil, fmt.Errorf("unsupported value of field %s", name)
+			}
+		}
+	}
+
+	return json.Marshal(permit)
+}
+
+// DecodePermit decodes the JSON permit values of the token
+func DecodePermit(token *TokenConfig, data []byte) (PermitType, error) {
+	var permit permitJSON
+	err := json.Unmarshal(data, &permit)
+	if err != nil {
+		return PermitType{}, err
+	}
+
+	values := PermitType{
+		Owner:    geth_common.HexToAddress(permit.Owner),
+		Receiver: geth_common.HexToAddress(permit.Receiver),
+		Spender:  geth_common.HexToAddress(permit.Spender),
+		Token:    geth_common.HexToAddress(permit.Token),
+	}
+	var ok bool
+	if values.Value, ok = new(big.Int).SetString(permit.Value, 10); !ok {
+		return PermitType{}, fmt.Errorf("invalid permit value")
+	}
+	if values.Nonce, ok = new(big.Int).SetString(permit.Nonce, 10); !ok {
+		return PermitType{}, fmt.Errorf("invalid permit nonce")
+	}
+	if values.Deadline, ok = new(big.Int).SetString(permit.Deadline, 10); !ok {
+		return PermitType{}, fmt.Errorf("invalid permit deadline")
+	}
+	if permit.ValidAfter != "" {
+		if values.ValidAfter, ok = new(big.Int).SetString(permit.ValidAfter, 10); !ok {
+			return PermitType{}, fmt.Errorf("invalid permit validAfter")
+		}
+	}
+
+	// Custom permit fields by the configured types
+	if token.Mode == TokenModeCustom {
+		values.Fields = make(map[string]interface{})
+		for _, field := range token.CustomPermit.Fields {
+			value, ok := permit.Fields[field.Name]
+			if !ok {
+				return PermitType{}, fmt.Errorf("missing permit field %s", field.Name)
+			}
+
+			switch field.Type {
+			case "address":
+				values.Fields[field.Name] = geth_common.HexToAddress(value)
+			case "uint256", "int256":
+				number, ok := new(big.Int).SetString(value, 10)
+				if !ok {
+					return PermitType{}, fmt.Errorf("invalid permit field %s", field.Name)
+				}
+				values.Fields[field.Name] = number
+			case "bytes32":
+				hash, err := hexutil.Decode(value)
+				if err != nil {
+					return PermitType{}, fmt.Errorf("invalid permit field %s", field.Name)
+				}
+				values.Fields[field.Name] = geth_common.BytesToHash(hash)
+			case "bool":
+				values.Fields[field.Name] = value == "true"
+			default:
+				values.Fields[field.Name] = value
+			}
+		}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,52 @@
+package common
+
+import (
+	"math/big"
+	"testing"
+
+	geth_common "github.com/ethereum/go-ethereum/common"
+)
+
+func TestEncodePermit(t *testing.T) {
+	token := &TokenConfig{
+		Mode: TokenModeCustom,
+		CustomPermit: &CustomPermitConfig{
+			Fields: []PermitField{
+				{Name: "owner", Type: "address"},
+				{Name: "fee", Type: "uint256"},
+				{Name: "salt", Type: "bytes32"},
+				{Name: "memo", Type: "string"},
+			},
+		},
+	}
+	values := PermitType{
+		Owner:      geth_common.HexToAddress("0x1234567890123456789012345678901234567890"),
+		Receiver:   geth_common.HexToAddress("0x0987654321098765432109876543210987654321"),
+		Value:      new(big.Int).Lsh(big.NewInt(1), 200),
+		Nonce:      big.NewInt(7),
+		Deadline:   big.NewInt(1700000000),
+		ValidAfter: big.NewInt(1),
+		Fields: map[string]interface{}{
+			"owner": geth_common.HexToAddress("0x1234567890123456789012345678901234567890"),
+			"fee":   big.NewInt(10),
+			"salt":  geth_common.HexToHash("0x01"),
+			"memo":  "hello",
+		},
+	}
+
+	data, err := EncodePermit(values)
+	if err != nil {
+		t.Fatalf("EncodePermit returned error: %v", err)
+	}
+	decoded, err := DecodePermit(token, data)
+	if err != nil {
+		t.Fatalf("DecodePermit returned error: %v", err)
+	}
+
+	if decoded.Owner != values.Owner || decoded.Receiver != values.Receiver || decoded.Value.Cmp(values.Value) != 0 || decoded.Nonce.Cmp(values.Nonce) != 0 || decoded.Deadline.Cmp(values.Deadline) != 0 || decoded.ValidAfter.Cmp(values.ValidAfter) != 0 {
+		t.Errorf("DecodePermit returned wrong values: %+v", decoded)
+	}
+	if decoded.Fields["owner"] != values.Fields["owner"] || decoded.Fields["fee"].(*big.Int).Cmp(big.NewInt(10)) != 0 || decoded.Fields["salt"] != values.Fields["salt"] || decoded.Fields["memo"] != "hello" {
+		t.Errorf("DecodePermit returned wrong fields: %+v", decoded.Fields)
+	}
+}
@@ -0,0 +1,74 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	geth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ERC-1271 isValidSignature(bytes32,bytes) magic value
+var ERC1271MagicValue = []byte{0x16, 0x26, 0xba, 0x7e}
+
+// ERC-6492 counterfactual signature suffix
+var ERC6492MagicSuffix = geth_common.FromHex("0x6492649264926492649264926492649264926492649264926492649264926492")
+
+// NormalizeSignature returns the canonical 65 bytes (r, s, v) form of an EOA signature with v in 27/28.
+// 64 bytes are expanded as EIP-2098 compact (r, vs) when compact is set, otherwise they may be a wallet signature.
+// High-s signatures are rejected, so one permit has one encoding. Other signatures (smart contract wallets) are returned as a copy.
+func NormalizeSignature(signature []byte, compact bool) ([]byte, error) {
+	sig := make([]byte, 65)
+	switch {
+	case len(signature) == 64 && compact:
+		// EIP-2098; pull the v from the top bit of vs and clear it
+		copy(sig, signature)
+		sig[64] = 27 + sig[32]>>7
+		sig[32] &= 0x7f
+	case len(signature) == 65 && (signature[64] == 27 || signature[64] == 28):
+		copy(sig, signature)
+	default:
+		return append([]byte{}, signature...), nil
+	}
+
+	// Reject malleable high-s
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:64])
+	if !crypto.ValidateSignatureValues(sig[64]-27, r, s, true) {
+		return nil, fmt.Errorf("invalid signature values, require low-s")
+	}
+
+	return sig, nil
+}
+
+var erc6492WrapperArguments = func() abi.Arguments {
+	addressType, _ := abi.NewType("address", "", nil)
+	bytesType, _ := abi.NewType("bytes", "", nil)
+	return abi.Arguments{{Type: addressType}, {Type: bytesType}, {Type: bytesType}}
+}()
+
+// IsERC6492Signature checks the signature is wrapped with the ERC-6492 magic suffix
+func IsERC6492Signature(signature []byte) bool {
+	return len(signature) > len(ERC6492MagicSuffix) && bytes.HasSuffix(signature, ERC6492MagicSuffix)
+}
+
+// ParseERC6492Signature unwraps abi.encode(factory, factoryCalldata, signature) ++ magic suffix
+func ParseERC6492Signature(signature []byte) (geth_common.Address, []byte, []byte, error) {
+	values, err := erc6492WrapperArguments.Unpack(signature[:len(signature)-len(ERC6492MagicSuffix)])
+	if err != nil {
+		return Address0x0, nil, nil, err
+	}
+
+	return values[0].(geth_common.Address), values[1].([]byte), values[2].([]byte), nil
+}
+
+// MakeERC6492Signature wraps the signature of an undeployed wallet with its factory call
+func MakeERC6492Signature(factory geth_common.Address, factoryCalldata []byte, signature []byte) ([]byte, error) {
+	wrapped, err := erc6492WrapperArguments.Pack(factory, factoryCalldata, signature)
+	if err != nil {
+		return nil, err
+	}
+	return append(wrapped, ERC6492MagicSuffix...), nil
+}
@@ -0,0 +1,86 @@
+package common
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	geth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestParseERC6492Signature(t *testing.T) {
+	factory := geth_common.HexToAddress("0x1234567890123456789012345678901234567890")
+	factoryCalldata := []byte{0x01, 0x02, 0x03}
+	signature := bytes.Repeat([]byte{0xab}, 65)
+
+	wrapped, err := MakeERC6492Signature(factory, factoryCalldata, signature)
+	if err != nil {
+		t.Fatalf("MakeERC6492Signature returned error: %v", err)
+	}
+	if !IsERC6492Signature(wrapped) {
+		t.Fatalf("IsERC6492Signature returned false for wrapped signature")
+	}
+	if IsERC6492Signature(signature) {
+		t.Errorf("IsERC6492Signature returned true for plain signature")
+	}
+
+	_factory, _factoryCalldata, _signature, err := ParseERC6492Signature(wrapped)
+	if err != nil {
+		t.Fatalf("ParseERC6492Signature returned error: %v", err)
+	}
+	if _factory != factory || !bytes.Equal(_factoryCalldata, factoryCalldata) || !bytes.Equal(_signature, signature) {
+		t.Errorf("ParseERC6492Signature returned wrong values: %v %x %x", _factory, _factoryCalldata, _signature)
+	}
+}
+
+func TestNormalizeSignature(t *testing.T) {
+	privateKey, err := crypto.HexToECDSA(testPrivateKey)
+	if err != nil {
+		t.Fatalf("HexToECDSA returned error: %v", err)
+	}
+	hash := crypto.Keccak256([]byte("permit"))
+	signature, err := crypto.Sign(hash, privateKey)
+	if err != nil {
+		t.Fatalf("Sign returned error: %v", err)
+	}
+	signature[64] += 27
+
+	// 65 bytes low-s is canonical
+	normalized, err := NormalizeSignature(signature, false)
+	if err != nil || !bytes.Equal(normalized, signature) {
+		t.Errorf("NormalizeSignature returned wrong signature: %x, %v", normalized, err)
+	}
+
+	// EIP-2098 compact (r, vs)
+	compact := make([]byte, 64)
+	copy(compact, signature[:64])
+	compact[32] |= (signature[64] - 27) << 7
+	normalized, err = NormalizeSignature(compact, true)
+	if err != nil || !bytes.Equal(normalized, signature) {
+		t.Errorf("NormalizeSignature returned wrong compact signature: %x, %v", normalized, err)
+	}
+
+	// 64 bytes of a wallet are kept when not compact
+	normalized, err = NormalizeSignature(compact, false)
+	if err != nil || !bytes.Equal(normalized, compact) {
+		t.Errorf("NormalizeSignature returned wrong 64 bytes signature: %x, %v", normalized, err)
+	}
+	signerAddress, err := RecoverSigner(hash, compact)
+	if err != nil || signerAddress != crypto.PubkeyToAddress(privateKey.PublicKey) {
+		t.Errorf("RecoverSigner returned wrong address of compact signature: %v, %v", signerAddress, err)
+	}
+
+	// High-s (N - s) with flipped v is rejected
+	highS := make([]byte, 65)
+	copy(highS, signature[:32])
+	s := new(big.Int).Sub(crypto.S256().Params().N, new(big.Int).SetBytes(signature[32:64]))
+	s.FillBytes(highS[32:64])
+	highS[64] = 55 - signature[64]
+	if _, err := NormalizeSignature(highS, false); err == nil {
+		t.Errorf("NormalizeSignature expected high-s error")
+	}
+	if _, err := RecoverSigner(hash, highS); err == nil {
+		t.Errorf("RecoverSigner expected high-s error")
+	}
+}
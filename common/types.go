@@ -17,6 +17,63 @@ var (
 	Address0x0     = geth_common.Address{0x0}
 )
 
+// Token modes
+const (
+	// Custom transferWithPermit(owner, receiver, value, deadline, v, r, s)
+	TokenModeTransferWithPermit = "transfer_with_permit"
+	// Standard EIP-2612 permit(owner, spender, value, deadline, v, r, s) then transferFrom(owner, receiver, value)
+	TokenModeEIP2612 = "eip2612"
+	// EIP-3009 transferWithAuthorization(from, to, value, validAfter, validBefore, nonce, v, r, s)
+	TokenModeEIP3009 = "eip3009"
+	// Uniswap Permit2 permitTransferFrom(permit, transferDetails, owner, signature) for any ERC20 approved to Permit2
+	TokenModePermit2 = "permit2"
+	// EIP-712 type, transfer function and arguments loaded from config
+	TokenModeCustom = "custom"
+)
+
+// EIP-712 field types of custom permits
+var CustomPermitFieldTypes = map[string]bool{
+	"address": true,
+	"uint256": true,
+	"int256":  true,
+	"bytes32": true,
+	"bool":    true,
+	"string":  true,
+}
+
+// Fields every custom permit must have, the relayer tracks pending transfers with them
+var CustomPermitRequiredFields = map[string]string{
+	"owner":    "address",
+	"receiver": "address",
+	"value":    "uint256",
+	"nonce":    "uint256",
+	"deadline": "uint256",
+}
+
+// Function arguments of custom permits taken from the signature
+var CustomPermitSignatureArguments = map[string]bool{
+	"v":         true,
+	"r":         true,
+	"s":         true,
+	"signature": true,
+}
+
+// EIP-712 domain check at startup
+const (
+	// Refuse to start when the domain does not match DOMAIN_SEPARATOR()
+	DomainCheckStrict = "strict"
+	// Log a warning when the domain does not match DOMAIN_SEPARATOR()
+	DomainCheckWarn = "warn"
+	// Use the configured name and version as is
+	DomainCheckOff = "off"
+)
+
+// Canonical Uniswap Permit2 deployment address
+var Permit2Address = geth_common.HexToAddress("0x000000000022D473030F116dDEE9F6B43aC78BA3")
+
+// Canonical Multicall3 deployment address
+var Multicall3Address = geth_common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+
 type DatabaseConnection struct {
 	Host     string
 	Port     int64
@@ -25,6 +82,36 @@ type DatabaseConnection struct {
 	Dbname   string
 }
 
+// Signer transaction types
+const (
+	// Legacy transaction with fixed gas_price, for chains without EIP-1559
+	TxTypeLegacy = "legacy"
+	// EIP-1559 dynamic fee transaction with fees from eth_feeHistory
+	TxTypeDynamicFee = "eip1559"
+)
+
+const (
+	// Permits of one owner always go to the account picked by the owner address hash
+	AssignmentOwner = "owner"
+	// Permits go to the account with the fewest pending txs, sticky per owner while pending
+	AssignmentLeastLoaded = "least_loaded"
+)
+
+const (
+	// Keys unlocked from keystore files or derived from the mnemonic in the relayer process
+	SignerBackendLocal = "local"
+	// Clef account_signTransaction JSON-RPC
+	SignerBackendClef = "clef"
+	// Web3Signer eth1 sign REST API
+	SignerBackendWeb3Signer = "web3signer"
+)
+
+// Default HD derivation path of Ethereum accounts, the account index is appended
+const DefaultDerivationPath = "m/44'/60'/0'/0"
+
+// Default minimum validity of EIP-3009 authorizations in seconds, they are short-lived unlike permit deadlines
+const DefaultValidBeforeMinimum = 600
+
 type SignerConfig struct {
 	Enable           bool
 	KeystoreFilePath string
@@ -33,6 +120,54 @@ type SignerConfig struct {
 	GasLimit         uint64
 	SenderInterval   time.Duration
 	SenderBulkSize   int
+
+	// Account pool
+	Backend            string
+	BackendEndpoint    string
+	BackendAccounts    []geth_common.Address // remote accounts, all accounts of the backend when empty
+	KeystoreFilePaths  []string
+	Mnemonic           string
+	MnemonicPassphrase string
+	DerivationPath     string
+	DerivationStart    uint32
+	DerivationCount    uint32
+	Assignment         string
+
+	// EIP-1559
+	TxType                string
+	FeeHistoryBlocks      uint64
+	PriorityFeePercentile float64
+	BaseFeeMultiplier     float64
+	MaxPriorityFee        uint64 // wei, 0 is no cap
+	MaxFee                uint64 // wei, 0 is no cap
+
+	// Stuck transaction replacement
+	ReplaceAfter   time.Duration // ms since broadcast, 0 is disabled
+	FeeBumpPercent uint64
+	MaxGasPrice    uint64 // wei, legacy replacement cap, 0 is no cap
+
+	// Gas balance monitoring
+	BalanceCheckInterval time.Duration // ms, 0 is disabled
+	BalanceWarningTxs    int64         // warn when the balance pays for fewer txs beyond the queue
+	BalanceMinTxs        int64         // pause new permits when the balance pays for fewer txs beyond the queue
+
+	// Gas estimation
+	GasEstimateMultiplier float64 // safety multiplier of eth_estimateGas bounded by GasLimit, 0 is disabled and GasLimit is used
+
+	// Failed transaction retry
+	RetryInterval    time.Duration // ms, 0 is disabled
+	RetryBackoff     time.Duration // ms before the first retry, doubled after each attempt
+	RetryMaxAttempts int64
+
+	// Fee policy
+	FeeCeiling         uint64        // wei, new permits are held while the network fee is above it, 0 is disabled
+	FeeTarget          uint64        // wei, permits not close to their deadline are held while the network fee is above it, 0 is disabled
+	FeeUrgentWindow    time.Duration // ms before the permit deadline it is close to it
+	FeeEmergencyBudget uint64        // wei above the ceiling paid for permits close to their deadline in 24 hours
+
+	// Batching
+	BatchSize     int // permits of one batch executor call, 0 or 1 is disabled
+	BatchExecutor geth_common.Address
 }
 
 type KeeperConfig struct {
@@ -44,17 +179,109 @@ type KeeperConfig struct {
 	LatestInterval         time.Duration
 }
 
+type PermitField struct {
+	Name string
+	Type string
+}
+
+type CustomPermitConfig struct {
+	PrimaryType string
+	Fields      []PermitField
+	Function    string
+	Arguments   []string // field names, v, r, s or signature
+}
+
+// HasField checks the custom permit type has the field
+func (c *CustomPermitConfig) HasField(name string) bool {
+	for _, field := range c.Fields {
+		if field.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+type TokenConfig struct {
+	Name            string
+	Version         string
+	Address         geth_common.Address
+	DeadlineMinimum int64
+	AbiFilePath     string
+	// Minimum seconds from validAfter, or now, to validBefore of EIP-3009 authorizations
+	ValidBeforeMinimum int64
+	Mode               string
+	Forwarder          geth_common.Address
+	Permit2            geth_common.Address
+	CustomPermit       *CustomPermitConfig
+	FeePriority        []*big.Int // ascending fee field thresholds of custom permits, the priority class is the number reached
+}
+
+// SignatureBytes checks the token relays the signature as bytes instead of (v, r, s)
+func (t *TokenConfig) SignatureBytes() bool {
+	if t.Mode == TokenModePermit2 {
+		return true
+	}
+	if t.Mode == TokenModeCustom {
+		for _, argument := range t.CustomPermit.Arguments {
+			if argument == "signature" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type ChainConfig struct {
+	NetworkId        int64
+	RpcEndpoint      string
+	Tokens           []TokenConfig
+	Signer           SignerConfig
+	Keeper           KeeperConfig
+	ERC6492Validator geth_common.Address // ERC-6492 UniversalSigValidator for undeployed smart wallets
+	DomainCheck      string
+}
+
 type Config struct {
-	NetworkId               int64
-	RpcEndpoint             string
-	ProxyPort               string
-	ERC20PermitTokenName    string
-	ERC20PermitTokenAddress geth_common.Address
-	DeadlineMinimum         int64
-	Signer                  SignerConfig
-	Keeper                  KeeperConfig
-	Db                      DatabaseConnection
-	LogDebug                bool
+	ProxyPort string
+	Chains    []ChainConfig
+	Db        DatabaseConnection
+	LogDebug  bool
+	ApiKeys   map[string]int64 // priority class of requests by X-Api-Key header
+
+	AdminApiKeys map[string]bool // X-Api-Key headers allowed to call admin_ methods
+}
+
+// IsAdminApiKey checks the API key may call admin_ methods
+func (c *Config) IsAdminApiKey(apiKey string) bool {
+	return apiKey != "" && c.AdminApiKeys[apiKey]
+}
+
+// ApiKeyPriority returns the priority class of the API key, 0 for unknown keys
+func (c *Config) ApiKeyPriority(apiKey string) int64 {
+	if apiKey == "" {
+		return 0
+	}
+	return c.ApiKeys[apiKey]
+}
+
+// GetChain returns the configured chain for the given network id
+func (c *Config) GetChain(networkId int64) (*ChainConfig, bool) {
+	for i := range c.Chains {
+		if c.Chains[i].NetworkId == networkId {
+			return &c.Chains[i], true
+		}
+	}
+	return nil, false
+}
+
+// GetToken returns the configured token for the given contract address
+func (c *ChainConfig) GetToken(address geth_common.Address) (*TokenConfig, bool) {
+	for i := range c.Tokens {
+		if c.Tokens[i].Address == address {
+			return &c.Tokens[i], true
+		}
+	}
+	return nil, false
 }
 
 type Domain struct {
@@ -65,11 +292,15 @@ type Domain struct {
 }
 
 type PermitType struct {
-	Owner    geth_common.Address
-	Receiver geth_common.Address
-	Value    *big.Int
-	Nonce    *big.Int
-	Deadline *big.Int
+	Owner      geth_common.Address
+	Receiver   geth_common.Address
+	Spender    geth_common.Address
+	Value      *big.Int
+	Nonce      *big.Int               // EIP-3009 bytes32 nonce as uint256
+	Deadline   *big.Int               // EIP-3009 validBefore
+	ValidAfter *big.Int               // EIP-3009 only
+	Token      geth_common.Address    // Permit2 permitted token
+	Fields     map[string]interface{} // custom permit values by field name
 }
 
 var ERC20PermitTokenABI = `
@@ -110,3 +341,566 @@ var ERC20PermitTokenABI = `
       "type":"function"
    }
 ]`
+
+var ERC20EIP2612TokenABI = `
+[
+   {
+      "constant":false,
+      "inputs":[
+         {
+            "name":"owner",
+            "type":"address"
+         },
+         {
+            "name":"spender",
+            "type":"address"
+         },
+         {
+            "name":"value",
+            "type":"uint256"
+         },
+         {
+            "name":"deadline",
+            "type":"uint256"
+         },
+         {
+            "name":"v",
+            "type":"uint8"
+         },
+         {
+            "name":"r",
+            "type":"bytes32"
+         },
+         {
+            "name":"s",
+            "type":"bytes32"
+         }
+      ],
+      "name":"permit",
+      "type":"function"
+   },
+   {
+      "constant":false,
+      "inputs":[
+         {
+            "name":"from",
+            "type":"address"
+         },
+         {
+            "name":"to",
+            "type":"address"
+         },
+         {
+            "name":"value",
+            "type":"uint256"
+         }
+      ],
+      "name":"transferFrom",
+      "outputs":[
+         {
+            "name":"",
+            "type":"bool"
+         }
+      ],
+      "type":"function"
+   }
+]`
+
+// Forwarder contract calls permit with itself as spender then transferFrom to receiver in one transaction
+var ERC20PermitForwarderABI = `
+[
+   {
+      "constant":false,
+      "inputs":[
+         {
+            "name":"token",
+            "type":"address"
+         },
+         {
+            "name":"owner",
+            "type":"address"
+         },
+         {
+            "name":"receiver",
+            "type":"address"
+         },
+         {
+            "name":"value",
+            "type":"uint256"
+         },
+         {
+            "name":"deadline",
+            "type":"uint256"
+         },
+         {
+            "name":"v",
+            "type":"uint8"
+         },
+         {
+            "name":"r",
+            "type":"bytes32"
+         },
+         {
+            "name":"s",
+            "type":"bytes32"
+         }
+      ],
+      "name":"permitTransferFrom",
+      "type":"function"
+   }
+]`
+
+var ERC20EIP3009TokenABI = `
+[
+   {
+      "constant":false,
+      "inputs":[
+         {
+            "name":"from",
+            "type":"address"
+         },
+         {
+            "name":"to",
+            "type":"address"
+         },
+         {
+            "name":"value",
+            "type":"uint256"
+         },
+         {
+            "name":"validAfter",
+            "type":"uint256"
+         },
+         {
+            "name":"validBefore",
+            "type":"uint256"
+         },
+         {
+            "name":"nonce",
+            "type":"bytes32"
+         },
+         {
+            "name":"v",
+            "type":"uint8"
+         },
+         {
+            "name":"r",
+            "type":"bytes32"
+         },
+         {
+            "name":"s",
+            "type":"bytes32"
+         }
+      ],
+      "name":"transferWithAuthorization",
+      "type":"function"
+   },
+   {
+      "constant":true,
+      "inputs":[
+         {
+            "name":"authorizer",
+            "type":"address"
+         },
+         {
+            "name":"nonce",
+            "type":"bytes32"
+         }
+      ],
+      "name":"authorizationState",
+      "outputs":[
+         {
+            "name":"",
+            "type":"bool"
+         }
+      ],
+      "type":"function"
+   }
+]`
+
+var Permit2ABI = `
+[
+   {
+      "inputs":[
+         {
+            "components":[
+               {
+                  "components":[
+                     {
+                        "name":"token",
+                        "type":"address"
+                     },
+                     {
+                        "name":"amount",
+                        "type":"uint256"
+                     }
+                  ],
+                  "name":"permitted",
+                  "type":"tuple"
+               },
+               {
+                  "name":"nonce",
+                  "type":"uint256"
+               },
+               {
+                  "name":"deadline",
+                  "type":"uint256"
+               }
+            ],
+            "name":"permit",
+            "type":"tuple"
+         },
+         {
+            "components":[
+               {
+                  "name":"to",
+                  "type":"address"
+               },
+               {
+                  "name":"requestedAmount",
+                  "type":"uint256"
+               }
+            ],
+            "name":"transferDetails",
+            "type":"tuple"
+         },
+         {
+            "name":"owner",
+            "type":"address"
+         },
+         {
+            "name":"signature",
+            "type":"bytes"
+         }
+      ],
+      "name":"permitTransferFrom",
+      "outputs":[],
+      "stateMutability":"nonpayable",
+      "type":"function"
+   },
+   {
+      "inputs":[
+         {
+            "name":"owner",
+            "type":"address"
+         },
+         {
+            "name":"wordPos",
+            "type":"uint256"
+         }
+      ],
+      "name":"nonceBitmap",
+      "outputs":[
+         {
+            "name":"",
+            "type":"uint256"
+         }
+      ],
+      "stateMutability":"view",
+      "type":"function"
+   }
+]`
+
+var Multicall3ABI = `
+[
+   {
+      "inputs":[
+         {
+            "components":[
+               {
+                  "name":"target",
+                  "type":"address"
+               },
+               {
+                  "name":"allowFailure",
+                  "type":"bool"
+               },
+               {
+                  "name":"callData",
+                  "type":"bytes"
+               }
+            ],
+            "name":"calls",
+            "type":"tuple[]"
+         }
+      ],
+      "name":"aggregate3",
+      "outputs":[
+         {
+            "components":[
+               {
+                  "name":"success",
+                  "type":"bool"
+               },
+               {
+                  "name":"returnData",
+                  "type":"bytes"
+               }
+            ],
+            "name":"returnData",
+            "type":"tuple[]"
+         }
+      ],
+      "stateMutability":"payable",
+      "type":"function"
+   }
+]
+`
+
+// Custom errors of OpenZeppelin ERC20, ERC20Permit and Uniswap Permit2 to decode revert reasons
+var CommonErrorsABI = `
+[
+   {
+      "inputs":[
+         {
+            "name":"sender",
+            "type":"address"
+         },
+         {
+            "name":"balance",
+            "type":"uint256"
+         },
+         {
+            "name":"needed",
+            "type":"uint256"
+         }
+      ],
+      "name":"ERC20InsufficientBalance",
+      "type":"error"
+   },
+   {
+      "inputs":[
+         {
+            "name":"spender",
+            "type":"address"
+         },
+         {
+            "name":"allowance",
+            "type":"uint256"
+         },
+         {
+            "name":"needed",
+            "type":"uint256"
+         }
+      ],
+      "name":"ERC20InsufficientAllowance",
+      "type":"error"
+   },
+   {
+      "inputs":[
+         {
+            "name":"deadline",
+            "type":"uint256"
+         }
+      ],
+      "name":"ERC2612ExpiredSignature",
+      "type":"error"
+   },
+   {
+      "inputs":[
+         {
+            "name":"signer",
+            "type":"address"
+         },
+         {
+            "name":"owner",
+            "type":"address"
+         }
+      ],
+      "name":"ERC2612InvalidSigner",
+      "type":"error"
+   },
+   {
+      "inputs":[
+         {
+            "name":"account",
+            "type":"address"
+         },
+         {
+            "name":"currentNonce",
+            "type":"uint256"
+         }
+      ],
+      "name":"InvalidAccountNonce",
+      "type":"error"
+   },
+   {
+      "inputs":[],
+      "name":"InvalidNonce",
+      "type":"error"
+   },
+   {
+      "inputs":[
+         {
+            "name":"signatureDeadline",
+            "type":"uint256"
+         }
+      ],
+      "name":"SignatureExpired",
+      "type":"error"
+   },
+   {
+      "inputs":[],
+      "name":"InvalidSignature",
+      "type":"error"
+   },
+   {
+      "inputs":[],
+      "name":"InvalidSigner",
+      "type":"error"
+   },
+   {
+      "inputs":[],
+      "name":"InvalidContractSignature",
+      "type":"error"
+   },
+   {
+      "inputs":[],
+      "name":"InvalidSignatureLength",
+      "type":"error"
+   },
+   {
+      "inputs":[
+         {
+            "name":"maxAmount",
+            "type":"uint256"
+         }
+      ],
+      "name":"InvalidAmount",
+      "type":"error"
+   }
+]
+`
+
+var ERC1271ABI = `
+[
+   {
+      "inputs":[
+         {
+            "name":"hash",
+            "type":"bytes32"
+         },
+         {
+            "name":"signature",
+            "type":"bytes"
+         }
+      ],
+      "name":"isValidSignature",
+      "outputs":[
+         {
+            "name":"magicValue",
+            "type":"bytes4"
+         }
+      ],
+      "stateMutability":"view",
+      "type":"function"
+   }
+]
+`
+
+var ERC6492ValidatorABI = `
+[
+   {
+      "inputs":[
+         {
+            "name":"_signer",
+            "type":"address"
+         },
+         {
+            "name":"_hash",
+            "type":"bytes32"
+         },
+         {
+            "name":"_signature",
+            "type":"bytes"
+         }
+      ],
+      "name":"isValidSig",
+      "outputs":[
+         {
+            "name":"",
+            "type":"bool"
+         }
+      ],
+      "stateMutability":"nonpayable",
+      "type":"function"
+   }
+]
+`
+
+var EIP712DomainABI = `
+[
+   {
+      "inputs":[],
+      "name":"eip712Domain",
+      "outputs":[
+         {
+            "name":"fields",
+            "type":"bytes1"
+         },
+         {
+            "name":"name",
+            "type":"string"
+         },
+         {
+            "name":"version",
+            "type":"string"
+         },
+         {
+            "name":"chainId",
+            "type":"uint256"
+         },
+         {
+            "name":"verifyingContract",
+            "type":"address"
+         },
+         {
+            "name":"salt",
+            "type":"bytes32"
+         },
+         {
+            "name":"extensions",
+            "type":"uint256[]"
+         }
+      ],
+      "stateMutability":"view",
+      "type":"function"
+   },
+   {
+      "inputs":[],
+      "name":"DOMAIN_SEPARATOR",
+      "outputs":[
+         {
+            "name":"",
+            "type":"bytes32"
+         }
+      ],
+      "stateMutability":"view",
+      "type":"function"
+   },
+   {
+      "inputs":[],
+      "name":"name",
+      "outputs":[
+         {
+            "name":"",
+            "type":"string"
+         }
+      ],
+      "stateMutability":"view",
+      "type":"function"
+   },
+   {
+      "inputs":[],
+      "name":"version",
+      "outputs":[
+         {
+            "name":"",
+            "type":"string"
+         }
+      ],
+      "stateMutability":"view",
+      "type":"function"
+   }
+]
+`
@@ -0,0 +1,288 @@
+package core
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"erc20-permit-relayer/common"
+	"erc20-permit-relayer/store"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	geth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/inconshreveable/log15"
+)
+
+// Signer account pool, each account sends its own nonce sequence
+
+type signerAccount struct {
+	address geth_common.Address
+	backend SignerBackend
+	log     log15.Logger
+	mutex   sync.Mutex
+	paused  atomic.Bool // gas balance can not pay for new permits
+
+	gapFills map[uint64]gapFill // self-transfers filling nonce gaps by nonce, guarded by mutex
+}
+
+// gapFill is a self-transfer sent to fill a nonce gap, replaced when it blocks the account
+type gapFill struct {
+	tx   *types.Transaction
+	sent time.Time
+}
+
+// storeAddress returns the lowercase address used in tx_pending and signer_config
+func (a *signerAccount) storeAddress() string {
+	return strings.ToLower(a.address.Hex())
+}
+
+// loadSignerAccounts returns the accounts of the remote signer backend or the local keys
+func loadSignerAccounts(signerConfig common.SignerConfig, log log15.Logger) []*signerAccount {
+	var backends []SignerBackend
+	switch signerConfig.Backend {
+	case common.SignerBackendClef:
+		backends = loadClefBackends(signerConfig, log)
+	case common.SignerBackendWeb3Signer:
+		backends = loadWeb3SignerBackends(signerConfig, log)
+	default:
+		for _, key := range loadLocalKeys(signerConfig, log) {
+			backends = append(backends, newLocalBackend(key))
+		}
+	}
+
+	// Unique accounts in config order
+	var signerAccounts []*signerAccount
+	loaded := make(map[geth_common.Address]bool)
+	for _, backend := range backends {
+		address := backend.Address()
+		if loaded[address] {
+			continue
+		}
+		loaded[address] = true
+
+		log.Info("Unlock account", "address", address, "backend", signerConfig.Backend)
+		signerAccounts = append(signerAccounts, &signerAccount{
+			address:  address,
+			backend:  backend,
+			log:      log.New("account", address),
+			gapFills: make(map[uint64]gapFill),
+		})
+	}
+
+	return signerAccounts
+}
+
+// loadLocalKeys unlocks the keystore files and derives the mnemonic accounts
+func loadLocalKeys(signerConfig common.SignerConfig, log log15.Logger) []*ecdsa.PrivateKey {
+	var keys []*ecdsa.PrivateKey
+
+	for _, keystoreFilePath := range signerConfig.KeystoreFilePaths {
+		// Load the keystore file
+		keystoreJSON, err := os.ReadFile(keystoreFilePath)
+		if err != nil {
+			log.Error("Failed to read keystore file", "path", keystoreFilePath, "msg", err)
+			continue
+		}
+
+		// Unlock the account
+		key, err := keystore.DecryptKey(keystoreJSON, signerConfig.Password)
+		if err != nil {
+			log.Error("Failed to unlock the account", "path", keystoreFilePath, "msg", err)
+			continue
+		}
+		keys = append(keys, key.PrivateKey)
+	}
+
+	if signerConfig.Mnemonic != "" {
+		seed := common.MnemonicSeed(signerConfig.Mnemonic, signerConfig.MnemonicPassphrase)
+		basePath, err := accounts.ParseDerivationPath(signerConfig.DerivationPath)
+		if err != nil {
+			log.Error("Failed to parse derivation path", "msg", err)
+			return keys
+		}
+		for i := uint32(0); i < signerConfig.DerivationCount; i++ {
+			path := append(accounts.DerivationPath{}, basePath...)
+			path = append(path, signerConfig.DerivationStart+i)
+
+			key, err := common.DeriveHDKey(seed, path)
+			if err != nil {
+				log.Error("Failed to derive the account", "path", path.String(), "msg", err)
+				continue
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+func loadClefBackends(signerConfig common.SignerConfig, log log15.Logger) []SignerBackend {
+	ctx := context.Background()
+	dialCtx, cancel := context.WithTimeout(ctx, clefTimeout)
+	defer cancel()
+	client, err := rpc.DialContext(dialCtx, signerConfig.BackendEndpoint)
+	if err != nil {
+		log.Error("Failed to connect clef", "endpoint", signerConfig.BackendEndpoint, "msg", err)
+		return nil
+	}
+
+	addresses := signerConfig.BackendAccounts
+	if len(addresses) == 0 {
+		addresses, err = listClefAccounts(ctx, client)
+		if err != nil {
+			log.Error("Failed to list clef accounts", "msg", err)
+			return nil
+		}
+	}
+
+	backends := make([]SignerBackend, len(addresses))
+	for i, address := range addresses {
+		backends[i] = newClefBackend(client, address)
+	}
+	return backends
+}
+
+func loadWeb3SignerBackends(signerConfig common.SignerConfig, log log15.Logger) []SignerBackend {
+	addresses := signerConfig.BackendAccounts
+	if len(addresses) == 0 {
+		var err error
+		addresses, err = listWeb3SignerAccounts(context.Background(), signerConfig.BackendEndpoint)
+		if err != nil {
+			log.Error("Failed to list web3signer accounts", "endpoint", signerConfig.BackendEndpoint, "msg", err)
+			return nil
+		}
+	}
+
+	backends := make([]SignerBackend, len(addresses))
+	for i, address := range addresses {
+		backends[i] = newWeb3SignerBackend(signerConfig.BackendEndpoint, address)
+	}
+	return backends
+}
+
+// getAccount returns the pool account of the address
+func (s *Signer) getAccount(address geth_common.Address) (*signerAccount, bool) {
+	for _, account := range s.accounts {
+		if account.address == address {
+			return account, true
+		}
+	}
+	return nil, false
+}
+
+// ownerAccount returns the account picked by the owner address hash
+func (s *Signer) ownerAccount(owner geth_common.Address) *signerAccount {
+	hash := crypto.Keccak256(owner.Bytes())
+	index := binary.BigEndian.Uint64(hash[:8]) % uint64(len(s.accounts))
+	return s.accounts[index]
+}
+
+// assignAccount returns the account sending the permit
+func (s *Signer) assignAccount(token *common.TokenConfig, values common.PermitType) (*signerAccount, error) {
+	// Permits approving a relayer account must be sent by it
+	if values.Spender != common.Address0x0 && values.Spender != token.Forwarder {
+		account, ok := s.getAccount(values.Spender)
+		if !ok {
+			return nil, fmt.Errorf("spender %s is not a signer account", values.Spender.Hex())
+		}
+		return account, nil
+	}
+
+	if s.chain.Signer.Assignment != common.AssignmentLeastLoaded {
+		return s.ownerAccount(values.Owner), nil
+	}
+
+	// Keep permits of one owner on one account while pending, in nonce order
+	pendingAccount, err := s.txStore.GetPendingAccount(values.Owner.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if account, ok := s.getAccount(geth_common.HexToAddress(pendingAccount)); ok {
+		return account, nil
+	}
+
+	pendingTxs, err := s.txStore.GetPendingTxsByAccount()
+	if err != nil {
+		return nil, err
+	}
+	// Skip accounts paused by gas balance
+	leastLoaded := s.accounts[0]
+	for _, account := range s.accounts[1:] {
+		if account.paused.Load() {
+			continue
+		}
+		if leastLoaded.paused.Load() || pendingTxs[account.storeAddress()] < pendingTxs[leastLoaded.storeAddress()] {
+			leastLoaded = account
+		}
+	}
+	return leastLoaded, nil
+}
+
+// assignPendingTransactions assigns pending txs of previous versions and of accounts removed from the pool
+func (s *Signer) assignPendingTransactions() error {
+	addresses := make([]string, len(s.accounts))
+	for i, account := range s.accounts {
+		addresses[i] = account.storeAddress()
+	}
+
+	txs, err := s.txStore.GetUnassignedTxPending(addresses)
+	if err != nil {
+		return err
+	}
+
+	for _, tx := range txs {
+		account, err := s.pendingAccount(tx)
+		if err != nil {
+			s.log.Error("Failed to assign pending permit", "permit", tx.PermitHash, "msg", err)
+			continue
+		}
+
+		err = s.txStore.UpdateTxPendingAccount(tx.PermitHash, account.storeAddress())
+		if err != nil {
+			return err
+		}
+		s.log.Info("Assign pending permit", "permit", tx.PermitHash, "account", account.address)
+	}
+
+	return nil
+}
+
+// pendingAccount returns the sender of a signed tx or assigns an unsigned permit
+func (s *Signer) pendingAccount(tx store.Tx) (*signerAccount, error) {
+	if tx.TxHash != "" {
+		signedTx, err := decodeTransaction(tx.TxSigned)
+		if err != nil {
+			return nil, err
+		}
+		sender, err := types.Sender(types.LatestSignerForChainID(big.NewInt(s.chain.NetworkId)), signedTx)
+		if err != nil {
+			return nil, err
+		}
+		account, ok := s.getAccount(sender)
+		if !ok {
+			return nil, fmt.Errorf("sender %s is not a signer account", sender.Hex())
+		}
+		return account, nil
+	}
+
+	token, ok := s.chain.GetToken(geth_common.HexToAddress(tx.Token))
+	if !ok {
+		return nil, fmt.Errorf("unsupported token %s", tx.Token)
+	}
+	values, err := common.DecodePermit(token, tx.Permit)
+	if err != nil {
+		return nil, err
+	}
+	return s.assignAccount(token, values)
+}
@@ -0,0 +1,35 @@
+package core
+
+import (
+	"time"
+
+	"erc20-permit-relayer/common"
+)
+
+// adminSignedTransactions returns the signed pending txs with their raw hex, so operators can rebroadcast them with eth_sendRawTransaction
+func (p *ProcessRequest) adminSignedTransactions(requestBody map[string]interface{}) ([]byte, error) {
+	txs, err := p.txStore.GetAllSignedTxPending()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]interface{}, 0, len(txs))
+	for _, tx := range txs {
+		signedTx := map[string]interface{}{
+			"permitHash":  tx.PermitHash,
+			"account":     tx.Account,
+			"txHash":      tx.TxHash,
+			"txHashes":    tx.TxHashes,
+			"txNonce":     tx.TxNonce,
+			"rawTx":       tx.TxSignedRaw,
+			"rawPermitTx": nil,
+			"timestamp":   tx.Timestamp.UTC().Format(time.RFC3339),
+		}
+		if tx.TxPermitRaw != "" {
+			signedTx["rawPermitTx"] = tx.TxPermitRaw
+		}
+		result = append(result, signedTx)
+	}
+
+	return common.MakeJsonResponseResult(requestBody["id"].(float64), result)
+}
@@ -0,0 +1,196 @@
+package core
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"erc20-permit-relayer/common"
+
+	geth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/mclock"
+)
+
+// EIP-3009 transferWithAuthorization requests
+
+func (p *ProcessRequest) delegateAuthorization(requestBody map[string]interface{}, data map[string]interface{}, apiKey string) ([]byte, error) {
+	// Route token
+	token, err := p.parseToken(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid delegate_authorization params: %v", err)
+	}
+	if token.Mode != common.TokenModeEIP3009 {
+		return nil, fmt.Errorf("invalid delegate_authorization params: token %s not support eip3009, use delegate_permit", token.Address.Hex())
+	}
+
+	// Parse parameters
+	values, signature, err := p.parseDelegateAuthorizationParams(token, data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid delegate_authorization params: %v", err)
+	}
+
+	// Verify authorization signature
+	permitHash, err := p.verifyPermit(token, values, signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid verify authorization with signature: %v", err)
+	}
+
+	// Verify balance, nonce, validity window
+	if err = p.verifyAuthorization(token, values); err != nil {
+		return nil, fmt.Errorf("invalid verify data: %v", err)
+	}
+
+	if p.config.LogDebug {
+		p.log.Debug("Incoming delegate_authorization", "token", token.Address, "from", data["from"], "to", data["to"], "value", data["value"])
+	}
+
+	// Added authorization to tx_pending
+	permitHash, err = p.signer.AddPendingTransaction(token, values, signature, permitHash, p.permitPriority(token, values, apiKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to add pending transaction: %v", err)
+	}
+
+	return common.MakeJsonResponseResult(requestBody["id"].(float64), permitHash.Hex())
+}
+
+func (p *ProcessRequest) parseDelegateAuthorizationParams(token *common.TokenConfig, data map[string]interface{}) (common.PermitType, []byte, error) {
+	if _, ok := data["from"].(string); !ok {
+		return common.PermitType{}, nil, fmt.Errorf("invalid from")
+	}
+	if _, ok := data["to"].(string); !ok {
+		return common.PermitType{}, nil, fmt.Errorf("invalid to")
+	}
+	if _, ok := data["signature"].(string); !ok {
+		return common.PermitType{}, nil, fmt.Errorf("invalid signature")
+	}
+
+	value, err := parseUintParam(data, "value")
+	if err != nil {
+		return common.PermitType{}, nil, err
+	}
+	validAfter, err := parseUintParam(data, "validAfter")
+	if err != nil {
+		return common.PermitType{}, nil, err
+	}
+	validBefore, err := parseUintParam(data, "validBefore")
+	if err != nil {
+		return common.PermitType{}, nil, err
+	}
+
+	// bytes32 nonce
+	nonceHex, ok := data["nonce"].(string)
+	if !ok {
+		return common.PermitType{}, nil, fmt.Errorf("invalid nonce")
+	}
+	nonce, err := hexutil.Decode(nonceHex)
+	if err != nil || len(nonce) != 32 {
+		return common.PermitType{}, nil, fmt.Errorf("invalid nonce, require bytes32")
+	}
+
+	values := common.PermitType{
+		Owner:      geth_common.HexToAddress(data["from"].(string)),
+		Receiver:   geth_common.HexToAddress(data["to"].(string)),
+		Value:      value,
+		Nonce:      new(big.Int).SetBytes(nonce),
+		Deadline:   validBefore,
+		ValidAfter: validAfter,
+	}
+
+	signature, err := parseSignature(token, data)
+	if err != nil {
+		return common.PermitType{}, nil, err
+	}
+
+	return values, signature, nil
+}
+
+func (p *ProcessRequest) verifyAuthorization(token *common.TokenConfig, values common.PermitType) error {
+	// Ensure only one access
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// Check validity window, authorizations not yet valid are queued until validAfter
+	validFrom := time.Now().Unix()
+	if !values.ValidAfter.IsInt64() {
+		return fmt.Errorf("invalid validAfter")
+	}
+	if values.ValidAfter.Int64() > validFrom {
+		validFrom = values.ValidAfter.Int64()
+	}
+	if values.Deadline.Cmp(big.NewInt(validFrom+token.ValidBeforeMinimum)) < 0 {
+		return fmt.Errorf("minimum validBefore is %d seconds after validAfter and now", token.ValidBeforeMinimum)
+	}
+
+	// Check replay with pending txs
+	pending, err := p.txStore.HasTxPendingNonce([]string{token.Address.Hex()}, values.Owner.Hex(), values.Nonce)
+	if err != nil {
+		return err
+	}
+	if pending {
+		return fmt.Errorf("authorization nonce already pending")
+	}
+
+	// Check replay on-chain
+	state, err := p.wrapQueryUint256(token.Address, "0xe94a0102", geth_common.BytesToHash(values.Owner.Bytes()), geth_common.BigToHash(values.Nonce)) // EIP3009.authorizationState(address,bytes32)
+	if err != nil {
+		return err
+	}
+	if state.Sign() != 0 {
+		return fmt.Errorf("authorization nonce already used")
+	}
+
+	// Check balance
+	balance, err := p.wrapQueryERC20BalanceOf(token, values.Owner.Hex())
+	if err != nil {
+		return err
+	}
+	if balance.Cmp(values.Value) < 0 {
+		return fmt.Errorf("insifficient balance")
+	}
+
+	return nil
+}
+
+// queryAuthorizationState overlays authorizationState(authorizer, nonce) with pending txs
+func (p *ProcessRequest) queryAuthorizationState(requestBody map[string]interface{}, token *common.TokenConfig, account string, nonce *big.Int) ([]byte, error) {
+	start := mclock.Now()
+
+	// Check pending txs first
+	pending, err := p.txStore.HasTxPendingNonce([]string{token.Address.Hex()}, account, nonce)
+	if err != nil {
+		return nil, err
+	}
+	if !pending {
+		return p.forwardRequest(requestBody)
+	}
+
+	if p.config.LogDebug {
+		p.log.Debug("Query EIP3009.authorizationState", "token", token.Address, "account", account, "nonce", geth_common.BigToHash(nonce), "pending", pending, "elapsed", geth_common.PrettyDuration(mclock.Now().Sub(start)))
+	}
+
+	id, ok := requestBody["id"].(float64)
+	if !ok {
+		id = 1
+	}
+	return common.MakeJsonResponseResult(id, "0x"+strings.Repeat("0", 63)+"1")
+}
+
+func parseUintParam(data map[string]interface{}, key string) (*big.Int, error) {
+	value := new(big.Int)
+	if _, ok := data[key].(string); ok {
+		if _, ok := value.SetString(data[key].(string), 0); !ok {
+			return nil, fmt.Errorf("invalid %s", key)
+		}
+	} else if _, ok := data[key].(float64); ok {
+		value.SetInt64(int64(data[key].(float64)))
+	} else {
+		return nil, fmt.Errorf("invalid %s", key)
+	}
+
+	if value.Sign() < 0 {
+		return nil, fmt.Errorf("invalid %s", key)
+	}
+	return value, nil
+}
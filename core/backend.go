@@ -0,0 +1,254 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	geth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// SignerBackend signs the transactions of one account, the key may be held out of the relayer process
+type SignerBackend interface {
+	Address() geth_common.Address
+	SignTx(ctx context.Context, tx *types.Transaction, signer types.Signer) (*types.Transaction, error)
+}
+
+// localBackend signs with a key unlocked in the relayer process
+type localBackend struct {
+	privateKey *ecdsa.PrivateKey
+}
+
+func newLocalBackend(privateKey *ecdsa.PrivateKey) *localBackend {
+	return &localBackend{privateKey: privateKey}
+}
+
+func (b *localBackend) Address() geth_common.Address {
+	return crypto.PubkeyToAddress(b.privateKey.PublicKey)
+}
+
+func (b *localBackend) SignTx(ctx context.Context, tx *types.Transaction, signer types.Signer) (*types.Transaction, error) {
+	return types.SignTx(tx, signer, b.privateKey)
+}
+
+// Timeout of each Clef request, an unanswered approval prompt must not block the sender of the account
+const clefTimeout = 10 * time.Second
+
+// clefBackend signs with Clef account_signTransaction JSON-RPC
+type clefBackend struct {
+	client  *rpc.Client
+	address geth_common.Address
+}
+
+func newClefBackend(client *rpc.Client, address geth_common.Address) *clefBackend {
+	return &clefBackend{client: client, address: address}
+}
+
+// listClefAccounts returns the accounts of Clef account_list
+func listClefAccounts(ctx context.Context, client *rpc.Client) ([]geth_common.Address, error) {
+	ctx, cancel := context.WithTimeout(ctx, clefTimeout)
+	defer cancel()
+
+	var addresses []geth_common.Address
+	err := client.CallContext(ctx, &addresses, "account_list")
+	return addresses, err
+}
+
+func (b *clefBackend) Address() geth_common.Address {
+	return b.address
+}
+
+func (b *clefBackend) SignTx(ctx context.Context, tx *types.Transaction, signer types.Signer) (*types.Transaction, error) {
+	to := geth_common.NewMixedcaseAddress(*tx.To())
+	data := hexutil.Bytes(tx.Data())
+	args := apitypes.SendTxArgs{
+		From:    geth_common.NewMixedcaseAddress(b.address),
+		To:      &to,
+		Gas:     hexutil.Uint64(tx.Gas()),
+		Value:   hexutil.Big(*tx.Value()),
+		Nonce:   hexutil.Uint64(tx.Nonce()),
+		Data:    &data,
+		ChainID: (*hexutil.Big)(signer.ChainID()),
+	}
+	if tx.Type() == types.DynamicFeeTxType {
+		args.MaxFeePerGas = (*hexutil.Big)(tx.GasFeeCap())
+		args.MaxPriorityFeePerGas = (*hexutil.Big)(tx.GasTipCap())
+	} else {
+		args.GasPrice = (*hexutil.Big)(tx.GasPrice())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, clefTimeout)
+	defer cancel()
+
+	var result struct {
+		Raw hexutil.Bytes `json:"raw"`
+	}
+	err := b.client.CallContext(ctx, &result, "account_signTransaction", args)
+	if err != nil {
+		return nil, err
+	}
+
+	signedTx := new(types.Transaction)
+	err = signedTx.UnmarshalBinary(result.Raw)
+	if err != nil {
+		return nil, err
+	}
+
+	// Clef may modify the transaction by its rules, only accept the requested one
+	if signer.Hash(signedTx) != signer.Hash(tx) {
+		return nil, fmt.Errorf("clef signed a different transaction %s", signedTx.Hash().Hex())
+	}
+	return signedTransaction(signedTx, signer, b.address)
+}
+
+// Timeout of each Web3Signer request, a hung signer must not block the sender of the account
+const web3SignerTimeout = 10 * time.Second
+
+var web3SignerClient = &http.Client{Timeout: web3SignerTimeout}
+
+// web3SignerBackend signs the transaction hash pre-image with the Web3Signer eth1 sign REST API
+type web3SignerBackend struct {
+	endpoint string
+	address  geth_common.Address
+	client   *http.Client
+}
+
+func newWeb3SignerBackend(endpoint string, address geth_common.Address) *web3SignerBackend {
+	return &web3SignerBackend{endpoint: strings.TrimRight(endpoint, "/"), address: address, client: web3SignerClient}
+}
+
+// listWeb3SignerAccounts returns the accounts of the Web3Signer eth1 public keys
+func listWeb3SignerAccounts(ctx context.Context, endpoint string) ([]geth_common.Address, error) {
+	var publicKeys []string
+	err := web3SignerRequest(ctx, web3SignerClient, http.MethodGet, strings.TrimRight(endpoint, "/")+"/api/v1/eth1/publicKeys", nil, &publicKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := make([]geth_common.Address, 0, len(publicKeys))
+	for _, publicKey := range publicKeys {
+		keyBytes, err := hexutil.Decode(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		// Uncompressed public key with or without the 0x04 prefix
+		if len(keyBytes) == 64 {
+			keyBytes = append([]byte{4}, keyBytes...)
+		}
+		key, err := crypto.UnmarshalPubkey(keyBytes)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, crypto.PubkeyToAddress(*key))
+	}
+	return addresses, nil
+}
+
+func (b *web3SignerBackend) Address() geth_common.Address {
+	return b.address
+}
+
+func (b *web3SignerBackend) SignTx(ctx context.Context, tx *types.Transaction, signer types.Signer) (*types.Transaction, error) {
+	preimage, err := signingPreimage(tx, signer)
+	if err != nil {
+		return nil, err
+	}
+
+	// Web3Signer signs keccak256 of the data
+	var signatureHex string
+	body, _ := json.Marshal(map[string]string{"data": hexutil.Encode(preimage)})
+	err = web3SignerRequest(ctx, b.client, http.MethodPost, b.endpoint+"/api/v1/eth1/sign/"+b.address.Hex(), body, &signatureHex)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := hexutil.Decode(signatureHex)
+	if err != nil || len(signature) != 65 {
+		return nil, fmt.Errorf("invalid web3signer signature %s", signatureHex)
+	}
+	if signature[64] >= 27 {
+		signature[64] -= 27
+	}
+
+	signedTx, err := tx.WithSignature(signer, signature)
+	if err != nil {
+		return nil, err
+	}
+	return signedTransaction(signedTx, signer, b.address)
+}
+
+// web3SignerRequest sends the request, the response is JSON or the plain hex signature
+func web3SignerRequest(ctx context.Context, client *http.Client, method string, url string, body []byte, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("web3signer %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	if signature, ok := result.(*string); ok && !bytes.HasPrefix(bytes.TrimSpace(respBody), []byte(`"`)) {
+		*signature = strings.TrimSpace(string(respBody))
+		return nil
+	}
+	return json.Unmarshal(respBody, result)
+}
+
+// signingPreimage returns the data whose keccak256 is the signing hash of the transaction
+func signingPreimage(tx *types.Transaction, signer types.Signer) ([]byte, error) {
+	var preimage []byte
+	var err error
+	switch tx.Type() {
+	case types.LegacyTxType:
+		preimage, err = rlp.EncodeToBytes([]interface{}{tx.Nonce(), tx.GasPrice(), tx.Gas(), tx.To(), tx.Value(), tx.Data(), signer.ChainID(), uint(0), uint(0)})
+	case types.DynamicFeeTxType:
+		preimage, err = rlp.EncodeToBytes([]interface{}{signer.ChainID(), tx.Nonce(), tx.GasTipCap(), tx.GasFeeCap(), tx.Gas(), tx.To(), tx.Value(), tx.Data(), tx.AccessList()})
+		preimage = append([]byte{types.DynamicFeeTxType}, preimage...)
+	default:
+		return nil, fmt.Errorf("unsupported transaction type %d", tx.Type())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if geth_common.BytesToHash(crypto.Keccak256(preimage)) != signer.Hash(tx) {
+		return nil, fmt.Errorf("signing pre-image not match transaction hash")
+	}
+	return preimage, nil
+}
+
+// signedTransaction checks the remote signature is from the account
+func signedTransaction(tx *types.Transaction, signer types.Signer, address geth_common.Address) (*types.Transaction, error) {
+	sender, err := types.Sender(signer, tx)
+	if err != nil {
+		return nil, err
+	}
+	if sender != address {
+		return nil, fmt.Errorf("signed by %s, require %s", sender.Hex(), address.Hex())
+	}
+	return tx, nil
+}
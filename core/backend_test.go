@@ -0,0 +1,167 @@
+package core
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	geth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+var testChainId = big.NewInt(11155111)
+
+func testTransactions() []*types.Transaction {
+	to := geth_common.HexToAddress("0x1234567890123456789012345678901234567890")
+	return []*types.Transaction{
+		types.NewTransaction(7, to, nil, 100000, big.NewInt(1000000000), []byte{0x01, 0x02}),
+		types.NewTx(&types.DynamicFeeTx{ChainID: testChainId, Nonce: 8, GasTipCap: big.NewInt(1000000000), GasFeeCap: big.NewInt(30000000000), Gas: 100000, To: &to, Data: []byte{0x03}}),
+	}
+}
+
+// checkSignedTransaction checks the signed tx is the unsigned tx from the address
+func checkSignedTransaction(t *testing.T, name string, signer types.Signer, tx *types.Transaction, signedTx *types.Transaction, address geth_common.Address) {
+	sender, err := types.Sender(signer, signedTx)
+	if err != nil || sender != address {
+		t.Errorf("%s returned wrong sender: %s %v", name, sender.Hex(), err)
+	}
+	if signer.Hash(signedTx) != signer.Hash(tx) || signedTx.Type() != tx.Type() {
+		t.Errorf("%s returned different transaction", name)
+	}
+}
+
+func TestLocalBackend(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	backend := newLocalBackend(key)
+	signer := types.NewLondonSigner(testChainId)
+
+	for _, tx := range testTransactions() {
+		signedTx, err := backend.SignTx(context.Background(), tx, signer)
+		if err != nil {
+			t.Fatalf("SignTx returned error: %v", err)
+		}
+		checkSignedTransaction(t, "localBackend.SignTx", signer, tx, signedTx, backend.Address())
+	}
+}
+
+// clefStub serves account_list and account_signTransaction of one key
+type clefStub struct {
+	key *ecdsa.PrivateKey
+}
+
+func (c *clefStub) List() []geth_common.Address {
+	return []geth_common.Address{crypto.PubkeyToAddress(c.key.PublicKey)}
+}
+
+func (c *clefStub) SignTransaction(args apitypes.SendTxArgs) (map[string]interface{}, error) {
+	to := args.To.Address()
+	var tx *types.Transaction
+	if args.MaxFeePerGas != nil {
+		tx = types.NewTx(&types.DynamicFeeTx{ChainID: (*big.Int)(args.ChainID), Nonce: uint64(args.Nonce), GasTipCap: (*big.Int)(args.MaxPriorityFeePerGas), GasFeeCap: (*big.Int)(args.MaxFeePerGas), Gas: uint64(args.Gas), To: &to, Data: *args.Data})
+	} else {
+		tx = types.NewTransaction(uint64(args.Nonce), to, nil, uint64(args.Gas), (*big.Int)(args.GasPrice), *args.Data)
+	}
+	signedTx, err := types.SignTx(tx, types.NewLondonSigner((*big.Int)(args.ChainID)), c.key)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := signedTx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"raw": hexutil.Bytes(raw), "tx": signedTx}, nil
+}
+
+func TestClefBackend(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", &clefStub{key: key}); err != nil {
+		t.Fatalf("RegisterName returned error: %v", err)
+	}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	client, err := rpc.Dial(httpServer.URL)
+	if err != nil {
+		t.Fatalf("Dial returned error: %v", err)
+	}
+	addresses, err := listClefAccounts(context.Background(), client)
+	if err != nil || len(addresses) != 1 || addresses[0] != crypto.PubkeyToAddress(key.PublicKey) {
+		t.Fatalf("listClefAccounts returned wrong accounts: %v %v", addresses, err)
+	}
+
+	backend := newClefBackend(client, addresses[0])
+	for _, signer := range []types.Signer{types.NewEIP155Signer(testChainId), types.NewLondonSigner(testChainId)} {
+		for _, tx := range testTransactions() {
+			if tx.Type() == types.DynamicFeeTxType && signer.Equal(types.NewEIP155Signer(testChainId)) {
+				continue
+			}
+			signedTx, err := backend.SignTx(context.Background(), tx, signer)
+			if err != nil {
+				t.Fatalf("SignTx returned error: %v", err)
+			}
+			checkSignedTransaction(t, "clefBackend.SignTx", signer, tx, signedTx, addresses[0])
+		}
+	}
+
+	// Another account of the same Clef
+	other := newClefBackend(client, geth_common.HexToAddress("0x0987654321098765432109876543210987654321"))
+	if _, err := other.SignTx(context.Background(), testTransactions()[0], types.NewLondonSigner(testChainId)); err == nil {
+		t.Errorf("SignTx expected wrong sender error")
+	}
+}
+
+func TestWeb3SignerBackend(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v1/eth1/publicKeys":
+			json.NewEncoder(w).Encode([]string{hexutil.Encode(crypto.FromECDSAPub(&key.PublicKey))})
+		case r.Method == http.MethodPost && strings.EqualFold(r.URL.Path, "/api/v1/eth1/sign/"+address.Hex()):
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			data, err := hexutil.Decode(body["data"])
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			signature, _ := crypto.Sign(crypto.Keccak256(data), key)
+			signature[64] += 27
+			w.Write([]byte(hexutil.Encode(signature)))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer httpServer.Close()
+
+	addresses, err := listWeb3SignerAccounts(context.Background(), httpServer.URL)
+	if err != nil || len(addresses) != 1 || addresses[0] != address {
+		t.Fatalf("listWeb3SignerAccounts returned wrong accounts: %v %v", addresses, err)
+	}
+
+	backend := newWeb3SignerBackend(httpServer.URL+"/", address)
+	signer := types.NewLondonSigner(testChainId)
+	for _, tx := range testTransactions() {
+		signedTx, err := backend.SignTx(context.Background(), tx, signer)
+		if err != nil {
+			t.Fatalf("SignTx returned error: %v", err)
+		}
+		checkSignedTransaction(t, "web3SignerBackend.SignTx", signer, tx, signedTx, address)
+	}
+
+	// Unknown identifier
+	other := newWeb3SignerBackend(httpServer.URL, geth_common.HexToAddress("0x0987654321098765432109876543210987654321"))
+	if _, err := other.SignTx(context.Background(), testTransactions()[0], signer); err == nil {
+		t.Errorf("SignTx expected not found error")
+	}
+}
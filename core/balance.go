@@ -0,0 +1,85 @@
+package core
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Gas balance monitoring of the signer accounts, new permits of an account are paused while it can not pay for them
+
+func (s *Signer) balanceMonitor(account *signerAccount) {
+	defer s.wg.Done()
+
+	ctx := context.Background()
+	for !s.isClosed {
+		err := s.checkBalance(ctx, account)
+		if err != nil {
+			account.log.Error("Failed to checkBalance", "msg", err)
+		}
+
+		time.Sleep(s.chain.Signer.BalanceCheckInterval * time.Millisecond)
+	}
+}
+
+// checkBalance estimates the txs the account balance pays for at the current fees beyond its queue
+func (s *Signer) checkBalance(ctx context.Context, account *signerAccount) error {
+	balance, err := s.client.BalanceAt(ctx, account.address, nil)
+	if err != nil {
+		return err
+	}
+	fees, err := s.suggestFees(ctx)
+	if err != nil {
+		return err
+	}
+	pendingTxs, err := s.txStore.GetPendingTxsByAccount()
+	if err != nil {
+		return err
+	}
+	queuedTxs := pendingTxs[account.storeAddress()]
+
+	// Max cost of one tx at the bounded gas estimate
+	gas, err := s.balanceTxGas(account)
+	if err != nil {
+		return err
+	}
+	gasPrice := fees.gasPrice
+	if fees.gasFeeCap != nil {
+		gasPrice = fees.gasFeeCap
+	}
+	txCost := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gas))
+	s.updateBalancePause(account, balance, txCost, queuedTxs)
+	return nil
+}
+
+// updateBalancePause pauses new permits of the account when the balance pays for less than balance_min_txs beyond its queue,
+// and resumes them once it does
+func (s *Signer) updateBalancePause(account *signerAccount, balance *big.Int, txCost *big.Int, queuedTxs int64) {
+	payableTxs := int64(math.MaxInt64)
+	if txCost.Sign() > 0 {
+		payable := new(big.Int).Div(balance, txCost)
+		if payable.IsInt64() {
+			payableTxs = payable.Int64()
+		}
+	}
+	spareTxs := payableTxs - queuedTxs
+
+	signerConfig := s.chain.Signer
+	balanceEther := new(big.Float).Quo(new(big.Float).SetInt(balance), big.NewFloat(params.Ether))
+	if spareTxs < signerConfig.BalanceMinTxs {
+		if !account.paused.Swap(true) {
+			account.log.Error("⛽ Insufficient gas balance, pause new permits", "balance", balanceEther.Text('f', 6), "payable", payableTxs, "queued", queuedTxs)
+		}
+		return
+	}
+
+	if account.paused.Swap(false) {
+		account.log.Info("⛽ Gas balance topped up, resume new permits", "balance", balanceEther.Text('f', 6), "payable", payableTxs, "queued", queuedTxs)
+	}
+	if spareTxs < signerConfig.BalanceWarningTxs {
+		account.log.Warn("⛽ Low gas balance", "balance", balanceEther.Text('f', 6), "payable", payableTxs, "queued", queuedTxs)
+	}
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"erc20-permit-relayer/common"
+
+	"github.com/inconshreveable/log15"
+)
+
+func TestUpdateBalancePause(t *testing.T) {
+	s := &Signer{chain: &common.ChainConfig{Signer: common.SignerConfig{BalanceMinTxs: 5, BalanceWarningTxs: 10}}}
+	account := &signerAccount{log: log15.New()}
+	account.log.SetHandler(log15.DiscardHandler())
+	txCost := big.NewInt(1000)
+
+	cases := []struct {
+		balance   int64
+		queuedTxs int64
+		paused    bool
+	}{
+		{7999, 3, true},  // 7 payable, 4 spare below the minimum
+		{8000, 3, false}, // 5 spare at the minimum resumes
+		{8000, 4, true},  // one more queued tx pauses again
+		{8999, 4, true},  // still 4 spare
+		{9000, 4, false}, // 5 spare
+		{9000, 0, false}, // stays resumed
+	}
+	for _, c := range cases {
+		s.updateBalancePause(account, big.NewInt(c.balance), txCost, c.queuedTxs)
+		if account.paused.Load() != c.paused {
+			t.Errorf("updateBalancePause paused %v for balance %d queued %d, expected %v", account.paused.Load(), c.balance, c.queuedTxs, c.paused)
+		}
+	}
+
+	// Zero fees pay for any queue
+	account.paused.Store(true)
+	s.updateBalancePause(account, big.NewInt(0), big.NewInt(0), 100)
+	if account.paused.Load() {
+		t.Errorf("updateBalancePause paused with zero tx cost")
+	}
+}
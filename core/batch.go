@@ -0,0 +1,242 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+
+	"erc20-permit-relayer/common"
+	"erc20-permit-relayer/store"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	geth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// On-chain batching of single-call permits through the Multicall3 aggregate3 batch executor
+
+// Multicall3 structs
+type multicall3Call struct {
+	Target       geth_common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+type multicall3Result struct {
+	Success    bool
+	ReturnData []byte
+}
+
+var transferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+// batchable checks the permit is one call that does not depend on the caller
+func (s *Signer) batchable(tx store.Tx, calls []txCall) bool {
+	if s.chain.Signer.BatchSize < 2 || len(calls) != 1 {
+		return false
+	}
+	token, ok := s.chain.GetToken(geth_common.HexToAddress(tx.Token))
+	if !ok {
+		return false
+	}
+	return token.Mode == common.TokenModeTransferWithPermit || token.Mode == common.TokenModeEIP3009
+}
+
+// signBatchTransaction signs the calls of the permits in one aggregate3 call allowing failure of each call,
+// all permits record the same tx
+func (s *Signer) signBatchTransaction(ctx context.Context, account *signerAccount, txs []store.Tx, calls []txCall, txNonce uint64, fees txFees) (store.Tx, error) {
+	batchCalls := make([]multicall3Call, len(calls))
+	for i, call := range calls {
+		batchCalls[i] = multicall3Call{Target: call.to, AllowFailure: true, CallData: call.data}
+	}
+	data, err := s.multicall3ABI.Pack("aggregate3", batchCalls)
+	if err != nil {
+		return store.Tx{}, err
+	}
+
+	call := txCall{to: s.chain.Signer.BatchExecutor, data: data}
+	var gasEstimate uint64
+	call.gas, gasEstimate = s.estimateGas(ctx, account, call, false)
+	signedTx, err := account.backend.SignTx(ctx, s.newTransaction(txNonce, call, fees), s.txSigner())
+	if err != nil {
+		return store.Tx{}, err
+	}
+	txSigned, err := encodeTransaction(signedTx)
+	if err != nil {
+		return store.Tx{}, err
+	}
+
+	// Update next nonce first, a failed record leaves a nonce gap instead of a reused nonce
+	err = s.txStore.UpdateSignerTxNonce(account.storeAddress(), txNonce+1)
+	if err != nil {
+		return store.Tx{}, err
+	}
+
+	// Record signed tx of each permit
+	for _, tx := range txs {
+		err = s.txStore.UpdateTxPendingSigned(tx.PermitHash, signedTx.Hash().Hex(), txSigned, nil, txNonce, gasEstimate)
+		if err != nil {
+			return store.Tx{}, err
+		}
+	}
+	account.log.Info("📦 Signed batch of permits", "  hash", signedTx.Hash(), "permits", len(txs), "nonce", txNonce)
+
+	tx := txs[0]
+	tx.TxHash = signedTx.Hash().Hex()
+	tx.TxSigned = txSigned
+	tx.TxPermitSigned = nil
+	tx.TxNonce = txNonce
+	tx.GasEstimate = gasEstimate
+	return tx, nil
+}
+
+// processBatchTransaction moves each permit of a mined batch tx to tx_submitted or tx_fail on the outcome of its call
+func (k *Keeper) processBatchTransaction(ctx context.Context, tx *types.Transaction, receipt *types.Receipt) error {
+	txHash := tx.Hash()
+	txs, err := k.txStore.GetBatchTxPending(txHash.Hex())
+	if err != nil {
+		return err
+	}
+	if len(txs) == 0 {
+		return nil
+	}
+
+	// Whole batch reverted
+	if receipt.Status == 0 {
+		reason := k.revertReason(ctx, tx, receipt)
+		for _, _tx := range txs {
+			err = k.txStore.UpdatePermitPendingToFail(_tx, txHash.Hex(), reason, receipt.GasUsed)
+			if err != nil {
+				return err
+			}
+		}
+		k.log.Info("😱 Batch transaction receipt fail", "  hash", txHash, "permits", len(txs), "reason", reason, "msg", "enqueue to retry")
+		return nil
+	}
+
+	calls, err := unpackAggregate3(k.multicall3ABI, tx.Data())
+	if err != nil {
+		return err
+	}
+
+	// Result of each call, replayed before the block
+	results := k.replayAggregate3(ctx, tx, receipt)
+
+	var (
+		usedLogs  = make(map[int]bool)
+		usedCalls = make(map[int]bool)
+		failed    int
+	)
+	for _, _tx := range txs {
+		// Outcome of the call from the aggregate3 return data, from the Transfer logs when it can not be replayed
+		reason := "batch call reverted"
+		success := false
+		index := batchCallIndex(calls, usedCalls, _tx)
+		if index >= 0 && index < len(results) {
+			success = results[index].Success
+			if !success {
+				reason = decodeRevert(results[index].ReturnData, k.errorABIs)
+			}
+		} else {
+			success = transferLogged(receipt.Logs, usedLogs, _tx)
+		}
+
+		if success {
+			err = k.txStore.UpdatePermitPendingToSubmitted(_tx, txHash.Hex(), receipt.GasUsed)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = k.txStore.UpdatePermitPendingToFail(_tx, txHash.Hex(), reason, receipt.GasUsed)
+		if err != nil {
+			return err
+		}
+		k.log.Info("😱 Batch call fail", "  hash", txHash, "permit", _tx.PermitHash, "reason", reason, "msg", "enqueue to retry", "attempts", _tx.RetryCount)
+		failed++
+	}
+
+	k.log.Info("🔗 Finalized batch transaction", "  hash", txHash, "permits", len(txs), "failed", failed)
+	return nil
+}
+
+// replayAggregate3 calls the batch tx at the parent block and returns the result of each call, empty if it fails
+func (k *Keeper) replayAggregate3(ctx context.Context, tx *types.Transaction, receipt *types.Receipt) []multicall3Result {
+	from, err := types.Sender(types.LatestSignerForChainID(big.NewInt(k.chain.NetworkId)), tx)
+	if err != nil {
+		return []multicall3Result{}
+	}
+
+	parentBlock := new(big.Int).Sub(receipt.BlockNumber, big.NewInt(1))
+	output, err := k.client.CallContract(ctx, ethereum.CallMsg{From: from, To: tx.To(), Gas: tx.Gas(), Data: tx.Data()}, parentBlock)
+	if err != nil {
+		k.log.Warn("Failed to replay batch transaction", "hash", tx.Hash(), "msg", err)
+		return []multicall3Result{}
+	}
+
+	values, err := k.multicall3ABI.Unpack("aggregate3", output)
+	if err != nil || len(values) != 1 {
+		return []multicall3Result{}
+	}
+	results, ok := abi.ConvertType(values[0], new([]multicall3Result)).(*[]multicall3Result)
+	if !ok {
+		return []multicall3Result{}
+	}
+	return *results
+}
+
+// unpackAggregate3 decodes the calls of aggregate3 calldata
+func unpackAggregate3(multicall3ABI abi.ABI, data []byte) ([]multicall3Call, error) {
+	method, ok := multicall3ABI.Methods["aggregate3"]
+	if !ok || len(data) < 4 || !bytes.Equal(method.ID, data[:4]) {
+		return nil, fmt.Errorf("not aggregate3 calldata")
+	}
+	values, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, err
+	}
+	calls, ok := abi.ConvertType(values[0], new([]multicall3Call)).(*[]multicall3Call)
+	if !ok {
+		return nil, fmt.Errorf("invalid aggregate3 calls")
+	}
+	return *calls, nil
+}
+
+// transferLogged finds an unused Transfer log of the permit token, owner and receiver up to the value, fee-on-transfer tokens transfer less
+func transferLogged(logs []*types.Log, usedLogs map[int]bool, tx store.Tx) bool {
+	token := geth_common.HexToAddress(tx.Token)
+	from := geth_common.BytesToHash(geth_common.HexToAddress(tx.Payer).Bytes())
+	to := geth_common.BytesToHash(geth_common.HexToAddress(tx.Receiver).Bytes())
+	for i, log := range logs {
+		if usedLogs[i] || log.Address != token || len(log.Topics) != 3 || log.Topics[0] != transferTopic {
+			continue
+		}
+		if log.Topics[1] == from && log.Topics[2] == to && new(big.Int).SetBytes(log.Data).Cmp(tx.Amount) <= 0 {
+			usedLogs[i] = true
+			return true
+		}
+	}
+	return false
+}
+
+// batchCallIndex finds the unused call of the permit, transferWithPermit and transferWithAuthorization start with owner, receiver, value
+func batchCallIndex(calls []multicall3Call, usedCalls map[int]bool, tx store.Tx) int {
+	token := geth_common.HexToAddress(tx.Token)
+	from := geth_common.BytesToHash(geth_common.HexToAddress(tx.Payer).Bytes())
+	to := geth_common.BytesToHash(geth_common.HexToAddress(tx.Receiver).Bytes())
+	value := geth_common.BigToHash(tx.Amount)
+	for i, call := range calls {
+		if usedCalls[i] || call.Target != token || len(call.CallData) < 4+3*32 {
+			continue
+		}
+		args := call.CallData[4:]
+		if geth_common.BytesToHash(args[:32]) == from && geth_common.BytesToHash(args[32:64]) == to && geth_common.BytesToHash(args[64:96]) == value {
+			usedCalls[i] = true
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"erc20-permit-relayer/common"
+	"erc20-permit-relayer/store"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	geth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestBatchCalls(t *testing.T) {
+	multicall3ABI, err := abi.JSON(strings.NewReader(common.Multicall3ABI))
+	if err != nil {
+		t.Fatalf("Parse abi returned error: %v", err)
+	}
+	tokenABI, err := abi.JSON(strings.NewReader(common.ERC20PermitTokenABI))
+	if err != nil {
+		t.Fatalf("Parse abi returned error: %v", err)
+	}
+
+	token := geth_common.HexToAddress("0x1234567890123456789012345678901234567890")
+	owner := geth_common.HexToAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266")
+	receiver := geth_common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8")
+	permits := []store.Tx{
+		{PermitHash: "0x01", Token: token.Hex(), Payer: owner.Hex(), Receiver: receiver.Hex(), Amount: big.NewInt(100)},
+		{PermitHash: "0x02", Token: token.Hex(), Payer: owner.Hex(), Receiver: receiver.Hex(), Amount: big.NewInt(200)},
+	}
+
+	var batchCalls []multicall3Call
+	for _, permit := range permits {
+		data, err := tokenABI.Pack("transferWithPermit", owner, receiver, permit.Amount, big.NewInt(1700000000), uint8(27), [32]byte{}, [32]byte{})
+		if err != nil {
+			t.Fatalf("Pack returned error: %v", err)
+		}
+		batchCalls = append(batchCalls, multicall3Call{Target: token, AllowFailure: true, CallData: data})
+	}
+	data, err := multicall3ABI.Pack("aggregate3", batchCalls)
+	if err != nil {
+		t.Fatalf("Pack aggregate3 returned error: %v", err)
+	}
+
+	calls, err := unpackAggregate3(multicall3ABI, data)
+	if err != nil || len(calls) != 2 || calls[1].Target != token || !calls[1].AllowFailure {
+		t.Fatalf("unpackAggregate3 returned wrong calls: %+v %v", calls, err)
+	}
+
+	// Permits match their calls in any order
+	usedCalls := make(map[int]bool)
+	if index := batchCallIndex(calls, usedCalls, permits[1]); index != 1 {
+		t.Errorf("batchCallIndex returned wrong index: %d", index)
+	}
+	if index := batchCallIndex(calls, usedCalls, permits[0]); index != 0 {
+		t.Errorf("batchCallIndex returned wrong index: %d", index)
+	}
+
+	// Only the first call transferred
+	logs := []*types.Log{{
+		Address: token,
+		Topics:  []geth_common.Hash{transferTopic, geth_common.BytesToHash(owner.Bytes()), geth_common.BytesToHash(receiver.Bytes())},
+		Data:    geth_common.BigToHash(big.NewInt(100)).Bytes(),
+	}}
+	usedLogs := make(map[int]bool)
+	if !transferLogged(logs, usedLogs, permits[0]) {
+		t.Errorf("transferLogged returned false for the transferred permit")
+	}
+	if transferLogged(logs, usedLogs, permits[1]) {
+		t.Errorf("transferLogged returned true for the failed permit")
+	}
+
+	// Fee-on-transfer token transfers less than the value
+	logs[0].Data = geth_common.BigToHash(big.NewInt(195)).Bytes()
+	if !transferLogged(logs, make(map[int]bool), permits[1]) {
+		t.Errorf("transferLogged returned false for the fee-on-transfer permit")
+	}
+}
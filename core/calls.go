@@ -0,0 +1,154 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"erc20-permit-relayer/common"
+
+	geth_common "github.com/ethereum/go-ethereum/common"
+)
+
+// txCall is one contract call the relayer signs and sends for a permit
+type txCall struct {
+	to   geth_common.Address
+	data []byte
+	gas  uint64 // gas_limit when 0
+}
+
+// Permit2 ISignatureTransfer structs
+type permit2TokenPermissions struct {
+	Token  geth_common.Address
+	Amount *big.Int
+}
+
+type permit2PermitTransferFrom struct {
+	Permitted permit2TokenPermissions
+	Nonce     *big.Int
+	Deadline  *big.Int
+}
+
+type permit2SignatureTransferDetails struct {
+	To              geth_common.Address
+	RequestedAmount *big.Int
+}
+
+// packCalls encodes the contract calls that execute the permit transfer, in sending order
+func (s *Signer) packCalls(token *common.TokenConfig, values common.PermitType, signature []byte) ([]txCall, error) {
+	tokenABI, ok := s.erc20PermitTokenABI[token.Address]
+	if !ok {
+		return nil, fmt.Errorf("abi of token %s not loaded", token.Address.Hex())
+	}
+
+	// Permit2 passes smart contract wallet signatures as is
+	if token.Mode == common.TokenModePermit2 {
+		return s.packPermit2Calls(token, values, signature)
+	}
+	if len(signature) != 65 && !token.SignatureBytes() {
+		return nil, fmt.Errorf("invalid signature length %d", len(signature))
+	}
+
+	// Split signature
+	var _r [32]byte
+	var _s [32]byte
+	var _v uint8
+	if len(signature) == 65 {
+		copy(_r[:], signature[:32])
+		copy(_s[:], signature[32:64])
+		_v = signature[64]
+	}
+
+	switch token.Mode {
+	case common.TokenModeEIP2612:
+		// Forwarder calls permit and transferFrom in one transaction
+		if token.Forwarder != common.Address0x0 {
+			data, err := s.forwarderABI.Pack("permitTransferFrom", token.Address, values.Owner, values.Receiver, values.Value, values.Deadline, _v, _r, _s)
+			if err != nil {
+				return nil, err
+			}
+			return []txCall{{to: token.Forwarder, data: data}}, nil
+		}
+
+		// Relayer is the spender, permit then transferFrom
+		permitData, err := tokenABI.Pack("permit", values.Owner, values.Spender, values.Value, values.Deadline, _v, _r, _s)
+		if err != nil {
+			return nil, err
+		}
+		transferData, err := tokenABI.Pack("transferFrom", values.Owner, values.Receiver, values.Value)
+		if err != nil {
+			return nil, err
+		}
+		return []txCall{{to: token.Address, data: permitData}, {to: token.Address, data: transferData}}, nil
+
+	case common.TokenModeEIP3009:
+		data, err := tokenABI.Pack("transferWithAuthorization", values.Owner, values.Receiver, values.Value, values.ValidAfter, values.Deadline, geth_common.BigToHash(values.Nonce), _v, _r, _s)
+		if err != nil {
+			return nil, err
+		}
+		return []txCall{{to: token.Address, data: data}}, nil
+
+	case common.TokenModeCustom:
+		// Function arguments mapped from permit fields and signature
+		args := make([]interface{}, len(token.CustomPermit.Arguments))
+		for i, argument := range token.CustomPermit.Arguments {
+			switch argument {
+			case "v":
+				args[i] = _v
+			case "r":
+				args[i] = _r
+			case "s":
+				args[i] = _s
+			case "signature":
+				args[i] = signature
+			default:
+				args[i] = values.Fields[argument]
+			}
+		}
+		data, err := tokenABI.Pack(token.CustomPermit.Function, args...)
+		if err != nil {
+			return nil, err
+		}
+		return []txCall{{to: token.Address, data: data}}, nil
+
+	default:
+		data, err := tokenABI.Pack("transferWithPermit", values.Owner, values.Receiver, values.Value, values.Deadline, _v, _r, _s)
+		if err != nil {
+			return nil, err
+		}
+		return []txCall{{to: token.Address, data: data}}, nil
+	}
+}
+
+// packPermit2Calls encodes permitTransferFrom, deploying an ERC-6492 counterfactual wallet first
+func (s *Signer) packPermit2Calls(token *common.TokenConfig, values common.PermitType, signature []byte) ([]txCall, error) {
+	calls := []txCall{}
+	if common.IsERC6492Signature(signature) {
+		factory, factoryCalldata, innerSignature, err := common.ParseERC6492Signature(signature)
+		if err != nil {
+			return nil, err
+		}
+
+		// Deploy the wallet when not deployed yet
+		code, err := s.client.CodeAt(context.Background(), values.Owner, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(code) == 0 {
+			calls = append(calls, txCall{to: factory, data: factoryCalldata})
+		}
+		signature = innerSignature
+	}
+
+	permit := permit2PermitTransferFrom{
+		Permitted: permit2TokenPermissions{Token: token.Address, Amount: values.Value},
+		Nonce:     values.Nonce,
+		Deadline:  values.Deadline,
+	}
+	transferDetails := permit2SignatureTransferDetails{To: values.Receiver, RequestedAmount: values.Value}
+	data, err := s.permit2ABI.Pack("permitTransferFrom", permit, transferDetails, values.Owner, signature)
+	if err != nil {
+		return nil, err
+	}
+	return append(calls, txCall{to: token.Permit2, data: data}), nil
+}
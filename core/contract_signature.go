@@ -0,0 +1,164 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"erc20-permit-relayer/common"
+
+	geth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ERC-1271 smart contract wallet and ERC-6492 counterfactual wallet signatures
+
+// Wallet owners and modules may change, accepted signatures are only cached for a while
+const contractSignatureCacheTTL = 10 * time.Minute
+
+var errExecutionReverted = errors.New("execution reverted")
+
+type contractSignatureResult struct {
+	valid   bool
+	expires time.Time
+}
+
+// verifyContractSignature checks the owner wallet contract accepts the signature of the permit hash,
+// rejections are not cached since the wallet may be deployed or its owners changed right after
+func (p *ProcessRequest) verifyContractSignature(owner geth_common.Address, hash []byte, signature []byte) (bool, error) {
+	key := crypto.Keccak256Hash(owner.Bytes(), hash, signature)
+
+	// Check cache
+	p.cacheMutex.Lock()
+	result, ok := p.signatureCache[key]
+	p.cacheMutex.Unlock()
+	if ok && time.Now().Before(result.expires) {
+		return result.valid, nil
+	}
+
+	valid, err := p.queryContractSignature(owner, geth_common.BytesToHash(hash), signature)
+	if err != nil || !valid {
+		return false, err
+	}
+
+	// Update cache, drop expired results
+	p.cacheMutex.Lock()
+	now := time.Now()
+	for k, r := range p.signatureCache {
+		if now.After(r.expires) {
+			delete(p.signatureCache, k)
+		}
+	}
+	p.signatureCache[key] = contractSignatureResult{valid: true, expires: now.Add(contractSignatureCacheTTL)}
+	p.cacheMutex.Unlock()
+
+	return true, nil
+}
+
+func (p *ProcessRequest) queryContractSignature(owner geth_common.Address, hash geth_common.Hash, signature []byte) (bool, error) {
+	code, err := p.wrapQueryCode(owner)
+	if err != nil {
+		return false, err
+	}
+
+	if common.IsERC6492Signature(signature) {
+		// Deployed wallet validates the wrapped signature itself
+		if len(code) > 0 {
+			_, _, innerSignature, err := common.ParseERC6492Signature(signature)
+			if err != nil {
+				return false, err
+			}
+			signature = innerSignature
+		} else {
+			// Undeployed wallet, validator simulates the factory deployment
+			if p.chain.ERC6492Validator == common.Address0x0 {
+				return false, fmt.Errorf("erc6492 validator not configured")
+			}
+			data, err := p.erc6492ValidatorABI.Pack("isValidSig", owner, hash, signature)
+			if err != nil {
+				return false, err
+			}
+			result, err := p.wrapEthCall(p.chain.ERC6492Validator, data)
+			if errors.Is(err, errExecutionReverted) {
+				return false, nil
+			} else if err != nil {
+				return false, err
+			}
+			return len(result) == 32 && result[31] == 1, nil
+		}
+	}
+
+	// Externally owned account
+	if len(code) == 0 {
+		return false, nil
+	}
+
+	data, err := p.erc1271ABI.Pack("isValidSignature", hash, signature)
+	if err != nil {
+		return false, err
+	}
+	result, err := p.wrapEthCall(owner, data)
+	if errors.Is(err, errExecutionReverted) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return len(result) >= 4 && bytes.Equal(result[:4], common.ERC1271MagicValue), nil
+}
+
+// wrapQueryCode returns the deployed code of the account
+func (p *ProcessRequest) wrapQueryCode(account geth_common.Address) ([]byte, error) {
+	return p.wrapRpcCall("eth_getCode", []interface{}{account.Hex(), "latest"})
+}
+
+// wrapEthCall calls the contract and returns the raw result
+func (p *ProcessRequest) wrapEthCall(to geth_common.Address, data []byte) ([]byte, error) {
+	return p.wrapRpcCall("eth_call", []interface{}{
+		map[string]interface{}{
+			"data": hexutil.Encode(data),
+			"to":   to.Hex(),
+		},
+		"latest",
+	})
+}
+
+func (p *ProcessRequest) wrapRpcCall(method string, params []interface{}) ([]byte, error) {
+	payload := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+		"id":      1,
+	}
+
+	response, err := p.forwardRequest(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the JSON string into the struct
+	var data map[string]interface{}
+	err = json.Unmarshal(response, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check rpc error
+	if rpcError, ok := data["error"].(map[string]interface{}); ok {
+		message, _ := rpcError["message"].(string)
+		if strings.Contains(message, "revert") {
+			return nil, fmt.Errorf("%w: %s", errExecutionReverted, message)
+		}
+		return nil, fmt.Errorf("%s failed: %s", method, message)
+	}
+
+	// Check nil result
+	result, ok := data["result"].(string)
+	if !ok {
+		return nil, fmt.Errorf("failed to read response data result")
+	}
+	return hexutil.Decode(result)
+}
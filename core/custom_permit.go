@@ -0,0 +1,113 @@
+package core
+
+import (
+	"fmt"
+	"math/big"
+
+	"erc20-permit-relayer/common"
+
+	geth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Custom permit types loaded from config
+
+func (p *ProcessRequest) parseCustomPermitParams(token *common.TokenConfig, data map[string]interface{}) (common.PermitType, []byte, error) {
+	fields := make(map[string]interface{})
+	hasSpender := false
+	for _, field := range token.CustomPermit.Fields {
+		// Spender must be a relayer account, parsed after the owner
+		if field.Name == "spender" && field.Type == "address" {
+			hasSpender = true
+			continue
+		}
+
+		value, err := parseCustomFieldParam(data, field)
+		if err != nil {
+			return common.PermitType{}, nil, err
+		}
+		fields[field.Name] = value
+	}
+	if hasSpender {
+		spenderAddress, err := p.parseSpenderParam(token, fields["owner"].(geth_common.Address), data)
+		if err != nil {
+			return common.PermitType{}, nil, err
+		}
+		fields["spender"] = spenderAddress
+	}
+
+	values := common.PermitType{
+		Owner:    fields["owner"].(geth_common.Address),
+		Receiver: fields["receiver"].(geth_common.Address),
+		Value:    fields["value"].(*big.Int),
+		Nonce:    fields["nonce"].(*big.Int),
+		Deadline: fields["deadline"].(*big.Int),
+		Token:    token.Address,
+		Fields:   fields,
+	}
+	if spender, ok := fields["spender"].(geth_common.Address); ok {
+		values.Spender = spender
+	}
+
+	signature, err := parseSignature(token, data)
+	if err != nil {
+		return common.PermitType{}, nil, err
+	}
+
+	return values, signature, nil
+}
+
+// parseCustomFieldParam parses the param of the field to the abi type of its EIP-712 type
+func parseCustomFieldParam(data map[string]interface{}, field common.PermitField) (interface{}, error) {
+	switch field.Type {
+	case "address":
+		address, ok := data[field.Name].(string)
+		if !ok || !geth_common.IsHexAddress(address) {
+			return nil, fmt.Errorf("invalid %s", field.Name)
+		}
+		return geth_common.HexToAddress(address), nil
+
+	case "uint256":
+		return parseUintParam(data, field.Name)
+
+	case "int256":
+		value := new(big.Int)
+		if _, ok := data[field.Name].(string); ok {
+			if _, ok := value.SetString(data[field.Name].(string), 0); !ok {
+				return nil, fmt.Errorf("invalid %s", field.Name)
+			}
+		} else if _, ok := data[field.Name].(float64); ok {
+			value.SetInt64(int64(data[field.Name].(float64)))
+		} else {
+			return nil, fmt.Errorf("invalid %s", field.Name)
+		}
+		return value, nil
+
+	case "bytes32":
+		hex, ok := data[field.Name].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s", field.Name)
+		}
+		value, err := hexutil.Decode(hex)
+		if err != nil || len(value) != 32 {
+			return nil, fmt.Errorf("invalid %s, require bytes32", field.Name)
+		}
+		return geth_common.BytesToHash(value), nil
+
+	case "bool":
+		value, ok := data[field.Name].(bool)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s", field.Name)
+		}
+		return value, nil
+
+	case "string":
+		value, ok := data[field.Name].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s", field.Name)
+		}
+		return value, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %s of %s", field.Type, field.Name)
+}
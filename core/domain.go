@@ -0,0 +1,159 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"erc20-permit-relayer/common"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	geth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/inconshreveable/log15"
+)
+
+// EIP-5267 fields of name, version, chainId, verifyingContract
+const eip712DomainFields = 0x0f
+
+// ResolveDomains reads the EIP-712 domain of the tokens from chain and checks it against DOMAIN_SEPARATOR()
+func ResolveDomains(chain *common.ChainConfig, log *log15.Logger, client *ethclient.Client) error {
+	if chain.DomainCheck == common.DomainCheckOff {
+		return nil
+	}
+
+	domainABI, err := abi.JSON(strings.NewReader(common.EIP712DomainABI))
+	if err != nil {
+		return err
+	}
+
+	for i := range chain.Tokens {
+		token := &chain.Tokens[i]
+		err := resolveDomain(chain, token, log, domainABI, client)
+		if err == nil {
+			continue
+		}
+
+		if chain.DomainCheck == common.DomainCheckStrict {
+			return fmt.Errorf("token %s: %v", token.Address.Hex(), err)
+		}
+		(*log).Warn("EIP-712 domain check fail", "token", token.Address, "msg", err)
+	}
+
+	return nil
+}
+
+func resolveDomain(chain *common.ChainConfig, token *common.TokenConfig, log *log15.Logger, domainABI abi.ABI, client *ethclient.Client) error {
+	ctx := context.Background()
+
+	// Permit2 domain is fixed, only check the separator
+	if token.Mode == common.TokenModePermit2 {
+		domain := common.Domain{Name: "Permit2", ChainId: chain.NetworkId, VerifyingContract: token.Permit2}
+		separator, err := callDomainSeparator(ctx, client, domainABI, token.Permit2)
+		if err != nil {
+			return err
+		}
+		return checkDomainSeparator(token.Mode, domain, separator)
+	}
+
+	configured := common.Domain{Name: token.Name, Version: token.Version, ChainId: chain.NetworkId, VerifyingContract: token.Address}
+
+	// Read the on-chain domain, EIP-5267 or name() and version()
+	onchain, err := callEIP712Domain(ctx, client, domainABI, token.Address)
+	if err != nil {
+		onchain = configured
+		if name, err := callString(ctx, client, domainABI, token.Address, "name"); err == nil {
+			onchain.Name = name
+		}
+		if version, err := callString(ctx, client, domainABI, token.Address, "version"); err == nil {
+			onchain.Version = version
+		}
+	}
+	if onchain.ChainId != chain.NetworkId || onchain.VerifyingContract != token.Address {
+		return fmt.Errorf("eip712Domain chainId %d, verifyingContract %s mismatch", onchain.ChainId, onchain.VerifyingContract.Hex())
+	}
+
+	// Cross-check with DOMAIN_SEPARATOR(), the on-chain values first
+	separator, err := callDomainSeparator(ctx, client, domainABI, token.Address)
+	if err != nil {
+		(*log).Warn("DOMAIN_SEPARATOR not available, skip domain check", "token", token.Address, "msg", err)
+	} else if checkDomainSeparator(token.Mode, onchain, separator) != nil {
+		if err := checkDomainSeparator(token.Mode, configured, separator); err != nil {
+			return err
+		}
+		onchain = configured
+	}
+
+	// Use the on-chain values
+	if onchain != configured {
+		(*log).Warn("Configured EIP-712 domain differ from on-chain, use on-chain", "token", token.Address, "name", onchain.Name, "version", onchain.Version)
+	}
+	token.Name = onchain.Name
+	token.Version = onchain.Version
+
+	return nil
+}
+
+func checkDomainSeparator(mode string, domain common.Domain, separator []byte) error {
+	computed, err := common.DomainSeparator(mode, domain)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(computed, separator) {
+		return fmt.Errorf("domain separator mismatch, computed: %x on-chain: %x", computed, separator)
+	}
+	return nil
+}
+
+func callEIP712Domain(ctx context.Context, client *ethclient.Client, domainABI abi.ABI, address geth_common.Address) (common.Domain, error) {
+	values, err := callContract(ctx, client, domainABI, address, "eip712Domain")
+	if err != nil {
+		return common.Domain{}, err
+	}
+
+	fields := values[0].([1]byte)
+	if fields[0] != eip712DomainFields {
+		return common.Domain{}, fmt.Errorf("unsupported eip712Domain fields %#x", fields[0])
+	}
+
+	return common.Domain{
+		Name:              values[1].(string),
+		Version:           values[2].(string),
+		ChainId:           values[3].(*big.Int).Int64(),
+		VerifyingContract: values[4].(geth_common.Address),
+	}, nil
+}
+
+func callDomainSeparator(ctx context.Context, client *ethclient.Client, domainABI abi.ABI, address geth_common.Address) ([]byte, error) {
+	values, err := callContract(ctx, client, domainABI, address, "DOMAIN_SEPARATOR")
+	if err != nil {
+		return nil, err
+	}
+	separator := values[0].([32]byte)
+	return separator[:], nil
+}
+
+func callString(ctx context.Context, client *ethclient.Client, domainABI abi.ABI, address geth_common.Address, method string) (string, error) {
+	values, err := callContract(ctx, client, domainABI, address, method)
+	if err != nil {
+		return "", err
+	}
+	return values[0].(string), nil
+}
+
+func callContract(ctx context.Context, client *ethclient.Client, contractABI abi.ABI, address geth_common.Address, method string) ([]interface{}, error) {
+	data, err := contractABI.Pack(method)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.CallContract(ctx, ethereum.CallMsg{To: &address, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return contractABI.Unpack(method, result)
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"math/big"
+	"time"
+
+	"erc20-permit-relayer/store"
+)
+
+// Fee policy of new permits, held while the network fee is above the ceiling or the target
+
+// Period of the emergency budget
+const emergencyBudgetPeriod = 24 * time.Hour
+
+type feeDecision int
+
+const (
+	feeSend      feeDecision = iota // sign with fees capped at the ceiling
+	feeDefer                        // hold until the network fee drops
+	feeEmergency                    // close to the deadline, sign above the ceiling within the emergency budget
+)
+
+func (s *Signer) feePolicyEnabled() bool {
+	return s.chain.Signer.FeeCeiling > 0 || s.chain.Signer.FeeTarget > 0
+}
+
+// feeDecision returns how the unsigned permit is sent at the network fee
+func (s *Signer) feeDecision(tx store.Tx, fees txFees, now time.Time) feeDecision {
+	signerConfig := s.chain.Signer
+	if !s.feePolicyEnabled() || fees.networkFee == nil {
+		return feeSend
+	}
+
+	// Permits without deadline can wait
+	urgent := tx.Deadline != nil && tx.Deadline.Cmp(big.NewInt(now.Add(signerConfig.FeeUrgentWindow*time.Millisecond).Unix())) <= 0
+
+	if signerConfig.FeeCeiling > 0 && fees.networkFee.Cmp(new(big.Int).SetUint64(signerConfig.FeeCeiling)) > 0 {
+		if urgent {
+			return feeEmergency
+		}
+		return feeDefer
+	}
+	if signerConfig.FeeTarget > 0 && fees.networkFee.Cmp(new(big.Int).SetUint64(signerConfig.FeeTarget)) > 0 && !urgent {
+		return feeDefer
+	}
+	return feeSend
+}
+
+// capFees limits the max fee per gas to the ceiling
+func capFees(fees txFees, feeCeiling uint64) txFees {
+	if feeCeiling == 0 {
+		return fees
+	}
+	ceiling := new(big.Int).SetUint64(feeCeiling)
+	capped := fees
+	if fees.gasPrice != nil && fees.gasPrice.Cmp(ceiling) > 0 {
+		capped.gasPrice = ceiling
+	}
+	if fees.gasFeeCap != nil && fees.gasFeeCap.Cmp(ceiling) > 0 {
+		capped.gasFeeCap = ceiling
+		if fees.gasTipCap.Cmp(ceiling) > 0 {
+			capped.gasTipCap = ceiling
+		}
+	}
+	return capped
+}
+
+// emergencyCost is the max cost above the ceiling of the txs at the gas limit
+func (s *Signer) emergencyCost(fees txFees, txs int) *big.Int {
+	maxFee := fees.gasPrice
+	if fees.gasFeeCap != nil {
+		maxFee = fees.gasFeeCap
+	}
+	cost := new(big.Int).Sub(maxFee, new(big.Int).SetUint64(s.chain.Signer.FeeCeiling))
+	if cost.Sign() < 0 {
+		return new(big.Int)
+	}
+	cost.Mul(cost, new(big.Int).SetUint64(s.chain.Signer.GasLimit))
+	return cost.Mul(cost, big.NewInt(int64(txs)))
+}
+
+// spendEmergencyBudget charges the cost of the permit to the budget of the last 24 hours, false if it exceeds the budget
+func (s *Signer) spendEmergencyBudget(permitHash string, cost *big.Int) (bool, error) {
+	return s.txStore.SpendEmergencyBudget(permitHash, cost, new(big.Int).SetUint64(s.chain.Signer.FeeEmergencyBudget), emergencyBudgetPeriod)
+}
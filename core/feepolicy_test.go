@@ -0,0 +1,54 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"erc20-permit-relayer/common"
+	"erc20-permit-relayer/store"
+)
+
+func TestFeeDecision(t *testing.T) {
+	s := &Signer{chain: &common.ChainConfig{Signer: common.SignerConfig{
+		GasLimit:           100000,
+		FeeCeiling:         100,
+		FeeTarget:          50,
+		FeeUrgentWindow:    600000,
+		FeeEmergencyBudget: 5000000,
+	}}}
+	now := time.Unix(1700000000, 0)
+	urgent := store.Tx{Deadline: big.NewInt(now.Unix() + 300)}
+	later := store.Tx{Deadline: big.NewInt(now.Unix() + 3600)}
+	noDeadline := store.Tx{}
+
+	cases := []struct {
+		networkFee int64
+		tx         store.Tx
+		decision   feeDecision
+	}{
+		{40, later, feeSend},
+		{80, later, feeDefer},
+		{80, noDeadline, feeDefer},
+		{80, urgent, feeSend},
+		{120, later, feeDefer},
+		{120, urgent, feeEmergency},
+	}
+	for _, c := range cases {
+		if decision := s.feeDecision(c.tx, txFees{networkFee: big.NewInt(c.networkFee)}, now); decision != c.decision {
+			t.Errorf("feeDecision returned %d at network fee %d, expected %d", decision, c.networkFee, c.decision)
+		}
+	}
+
+	// Fees above the ceiling are capped
+	capped := capFees(txFees{gasTipCap: big.NewInt(150), gasFeeCap: big.NewInt(200)}, 100)
+	if capped.gasFeeCap.Int64() != 100 || capped.gasTipCap.Int64() != 100 {
+		t.Errorf("capFees returned wrong fees: %+v", capped)
+	}
+
+	// Cost above the ceiling at the gas limit is 30 * 100000
+	cost := s.emergencyCost(txFees{gasPrice: big.NewInt(130)}, 1)
+	if cost.Int64() != 3000000 {
+		t.Errorf("emergencyCost returned wrong cost: %s", cost)
+	}
+}
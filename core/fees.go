@@ -0,0 +1,106 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"erc20-permit-relayer/common"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// txFees are the fees of one signed transaction, gasPrice for legacy or gasTipCap, gasFeeCap for EIP-1559
+type txFees struct {
+	gasPrice   *big.Int
+	gasTipCap  *big.Int
+	gasFeeCap  *big.Int
+	networkFee *big.Int // fee per gas of the next block, base fee plus priority fee or gas price
+}
+
+// suggestFees returns the fixed gas_price for legacy transactions or EIP-1559 fees from eth_feeHistory,
+// legacy transactions follow eth_gasPrice above gas_price under a fee policy
+func (s *Signer) suggestFees(ctx context.Context) (txFees, error) {
+	if s.chain.Signer.TxType != common.TxTypeDynamicFee {
+		gasPrice := new(big.Int).SetUint64(s.chain.Signer.GasPrice)
+		if !s.feePolicyEnabled() {
+			return txFees{gasPrice: gasPrice, networkFee: gasPrice}, nil
+		}
+		networkFee, err := s.client.SuggestGasPrice(ctx)
+		if err != nil {
+			return txFees{}, err
+		}
+		if networkFee.Cmp(gasPrice) > 0 {
+			gasPrice = new(big.Int).Set(networkFee)
+		}
+		return txFees{gasPrice: gasPrice, networkFee: networkFee}, nil
+	}
+
+	signerConfig := s.chain.Signer
+	feeHistory, err := s.client.FeeHistory(ctx, signerConfig.FeeHistoryBlocks, nil, []float64{signerConfig.PriorityFeePercentile})
+	if err != nil {
+		return txFees{}, err
+	}
+	if len(feeHistory.BaseFee) == 0 {
+		return txFees{}, fmt.Errorf("fee history without base fee, chain may not support eip1559")
+	}
+
+	// Priority fee is the average reward percentile of recent blocks
+	gasTipCap := new(big.Int)
+	rewards := int64(0)
+	for _, reward := range feeHistory.Reward {
+		if len(reward) > 0 && reward[0] != nil {
+			gasTipCap.Add(gasTipCap, reward[0])
+			rewards++
+		}
+	}
+	if rewards > 0 {
+		gasTipCap.Div(gasTipCap, big.NewInt(rewards))
+	}
+	if signerConfig.MaxPriorityFee > 0 && gasTipCap.Cmp(new(big.Int).SetUint64(signerConfig.MaxPriorityFee)) > 0 {
+		gasTipCap.SetUint64(signerConfig.MaxPriorityFee)
+	}
+
+	// Max fee covers the next block base fee with multiplier
+	baseFee := feeHistory.BaseFee[len(feeHistory.BaseFee)-1]
+	networkFee := new(big.Int).Add(baseFee, gasTipCap)
+	gasFeeCap, _ := new(big.Float).Mul(new(big.Float).SetInt(baseFee), big.NewFloat(signerConfig.BaseFeeMultiplier)).Int(nil)
+	gasFeeCap.Add(gasFeeCap, gasTipCap)
+	if signerConfig.MaxFee > 0 && gasFeeCap.Cmp(new(big.Int).SetUint64(signerConfig.MaxFee)) > 0 {
+		gasFeeCap.SetUint64(signerConfig.MaxFee)
+	}
+	if gasTipCap.Cmp(gasFeeCap) > 0 {
+		gasTipCap.Set(gasFeeCap)
+	}
+
+	return txFees{gasTipCap: gasTipCap, gasFeeCap: gasFeeCap, networkFee: networkFee}, nil
+}
+
+// newTransaction makes the legacy or EIP-1559 transaction of the call
+func (s *Signer) newTransaction(nonce uint64, call txCall, fees txFees) *types.Transaction {
+	to := call.to
+	gas := s.chain.Signer.GasLimit
+	if call.gas > 0 {
+		gas = call.gas
+	}
+	if fees.gasFeeCap != nil {
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:   big.NewInt(s.chain.NetworkId),
+			Nonce:     nonce,
+			GasTipCap: fees.gasTipCap,
+			GasFeeCap: fees.gasFeeCap,
+			Gas:       gas,
+			To:        &to,
+			Data:      call.data,
+		})
+	}
+	return types.NewTransaction(nonce, to, nil, gas, fees.gasPrice, call.data)
+}
+
+// txSigner returns the London signer for EIP-1559 or EIP-155 signer for legacy transactions
+func (s *Signer) txSigner() types.Signer {
+	if s.chain.Signer.TxType == common.TxTypeDynamicFee {
+		return types.NewLondonSigner(big.NewInt(s.chain.NetworkId))
+	}
+	return types.NewEIP155Signer(big.NewInt(s.chain.NetworkId))
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum"
+)
+
+// Gas limit of each tx from eth_estimateGas with a safety multiplier, bounded by the configured gas limit
+
+// estimateGas returns the gas limit of the call and its estimate, the configured gas limit and 0 if it is not estimated.
+// A dependent call reverts until the calls before it are mined, its failed estimate is expected.
+func (s *Signer) estimateGas(ctx context.Context, account *signerAccount, call txCall, dependent bool) (uint64, uint64) {
+	signerConfig := s.chain.Signer
+	if call.gas > 0 {
+		return call.gas, 0
+	}
+	if signerConfig.GasEstimateMultiplier == 0 {
+		return signerConfig.GasLimit, 0
+	}
+
+	estimate, err := s.client.EstimateGas(ctx, ethereum.CallMsg{From: account.address, To: &call.to, Data: call.data})
+	if err != nil {
+		// Reverts while permits of the owner with lower nonces are queued
+		if !dependent {
+			account.log.Warn("Failed to estimate gas, use gas limit", "to", call.to, "msg", err)
+		}
+		return signerConfig.GasLimit, 0
+	}
+	return boundGas(estimate, signerConfig.GasEstimateMultiplier, signerConfig.GasLimit), estimate
+}
+
+// balanceTxGas returns the gas of one tx of the account to check its balance, the recent estimates bounded like new txs
+func (s *Signer) balanceTxGas(account *signerAccount) (uint64, error) {
+	signerConfig := s.chain.Signer
+	if signerConfig.GasEstimateMultiplier == 0 {
+		return signerConfig.GasLimit, nil
+	}
+	estimate, err := s.txStore.GetAverageGasEstimate(account.storeAddress())
+	if err != nil {
+		return 0, err
+	}
+	if estimate == 0 {
+		return signerConfig.GasLimit, nil
+	}
+	return boundGas(estimate, signerConfig.GasEstimateMultiplier, signerConfig.GasLimit), nil
+}
+
+// boundGas applies the safety multiplier to the estimate up to the gas limit
+func boundGas(estimate uint64, multiplier float64, gasLimit uint64) uint64 {
+	gas := float64(estimate) * multiplier
+	if gas >= float64(gasLimit) {
+		return gasLimit
+	}
+	return uint64(gas)
+}
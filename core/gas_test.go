@@ -0,0 +1,12 @@
+package core
+
+import "testing"
+
+func TestBoundGas(t *testing.T) {
+	if gas := boundGas(100000, 1.2, 3000000); gas != 120000 {
+		t.Errorf("boundGas returned wrong gas: %d", gas)
+	}
+	if gas := boundGas(2800000, 1.2, 3000000); gas != 3000000 {
+		t.Errorf("boundGas returned gas above the gas limit: %d", gas)
+	}
+}
@@ -1,15 +1,16 @@
 package core
 
 import (
-	"bytes"
 	"context"
 	"math/big"
+	"strings"
 	"sync"
 	"time"
 
 	"erc20-permit-relayer/common"
 	"erc20-permit-relayer/store"
 
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	geth_common "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -18,22 +19,49 @@ import (
 )
 
 type Keeper struct {
-	config   *common.Config
-	log      log15.Logger
-	txStore  store.TxStore
-	client   *ethclient.Client
-	wg       *sync.WaitGroup
-	isClosed bool
+	config        *common.Config
+	chain         *common.ChainConfig
+	log           log15.Logger
+	txStore       *store.TxStore
+	client        *ethclient.Client
+	tokens        map[geth_common.Address]bool
+	errorABIs     []abi.ABI // decode revert reasons
+	multicall3ABI abi.ABI
+	wg            *sync.WaitGroup
+	isClosed      bool
 }
 
-func NewKeeper(config *common.Config, log *log15.Logger, txStore *store.TxStore, client *ethclient.Client, wg *sync.WaitGroup) *Keeper {
+func NewKeeper(config *common.Config, chain *common.ChainConfig, log *log15.Logger, txStore *store.TxStore, client *ethclient.Client, wg *sync.WaitGroup) *Keeper {
+	// Watch all configured tokens, forwarders and Permit2
+	tokens := make(map[geth_common.Address]bool)
+	for _, token := range chain.Tokens {
+		tokens[token.Address] = true
+		if token.Forwarder != common.Address0x0 {
+			tokens[token.Forwarder] = true
+		}
+		if token.Permit2 != common.Address0x0 {
+			tokens[token.Permit2] = true
+		}
+	}
+	if chain.Signer.BatchSize > 1 {
+		tokens[chain.Signer.BatchExecutor] = true
+	}
+	multicall3ABI, err := abi.JSON(strings.NewReader(common.Multicall3ABI))
+	if err != nil {
+		(*log).Error("Failed to parse json abi", "msg", err)
+	}
+
 	return &Keeper{
-		config:   config,
-		log:      *log,
-		txStore:  *txStore,
-		client:   client,
-		wg:       wg,
-		isClosed: false,
+		config:        config,
+		chain:         chain,
+		log:           *log,
+		txStore:       txStore,
+		client:        client,
+		tokens:        tokens,
+		errorABIs:     loadErrorABIs(chain),
+		multicall3ABI: multicall3ABI,
+		wg:            wg,
+		isClosed:      false,
 	}
 }
 
@@ -42,7 +70,7 @@ func (k *Keeper) Sync(syncBlockNumber int64) {
 	defer k.wg.Done()
 
 	// Prepare defult config
-	err := k.txStore.PrepareKeeperConfig(k.config.Keeper.InitialSyncBlockNumber)
+	err := k.txStore.PrepareKeeperConfig(k.chain.Keeper.InitialSyncBlockNumber)
 	if err != nil {
 		k.log.Error("PrepareKeeperConfig fail", "msg", err)
 		return
@@ -66,9 +94,9 @@ func (k *Keeper) Sync(syncBlockNumber int64) {
 
 		// Sleep
 		if isSyncing {
-			time.Sleep(k.config.Keeper.SyncingInterval * time.Millisecond)
+			time.Sleep(k.chain.Keeper.SyncingInterval * time.Millisecond)
 		} else {
-			time.Sleep(k.config.Keeper.LatestInterval * time.Millisecond)
+			time.Sleep(k.chain.Keeper.LatestInterval * time.Millisecond)
 		}
 	}
 }
@@ -88,7 +116,7 @@ func (k *Keeper) processTransactions(ctx context.Context, blockNumber *big.Int)
 	}
 
 	// Get Current sync block
-	blockCount := k.config.Keeper.BlockBatchLimit
+	blockCount := k.chain.Keeper.BlockBatchLimit
 	isSyncing := latestBlock.Number().Int64()-blockNumber.Int64() > blockCount
 	if !isSyncing {
 		blockCount = latestBlock.Number().Int64() - blockNumber.Int64()
@@ -97,6 +125,14 @@ func (k *Keeper) processTransactions(ctx context.Context, blockNumber *big.Int)
 		return false, blockNumber
 	}
 
+	// Only txs of the signer accounts can be pending
+	accounts, err := k.txStore.GetSignerAccounts()
+	if err != nil {
+		k.log.Error("Failed to retrieve signer accounts", "msg", err)
+		return true, blockNumber
+	}
+	txSigner := types.LatestSignerForChainID(big.NewInt(k.chain.NetworkId))
+
 	var (
 		block *types.Block
 		txs   int = 0
@@ -112,8 +148,13 @@ func (k *Keeper) processTransactions(ctx context.Context, blockNumber *big.Int)
 
 		// Process txs in block
 		for _, tx := range block.Transactions() {
-			// Skip non ERC20PermitTokenAddress
-			if tx.To() == nil || !bytes.Equal(tx.To().Bytes(), k.config.ERC20PermitTokenAddress.Bytes()) {
+			// Skip non configured tokens
+			if tx.To() == nil || !k.tokens[*tx.To()] {
+				continue
+			}
+			// Skip txs of other senders to the tokens and the public batch executor
+			from, err := types.Sender(txSigner, tx)
+			if err != nil || !accounts[strings.ToLower(from.Hex())] {
 				continue
 			}
 
@@ -125,10 +166,20 @@ func (k *Keeper) processTransactions(ctx context.Context, blockNumber *big.Int)
 				return false, blockNumber
 			}
 
+			// Permits of a batch tx on the outcome of each call
+			if k.chain.Signer.BatchSize > 1 && *tx.To() == k.chain.Signer.BatchExecutor {
+				err = k.processBatchTransaction(ctx, tx, receipt)
+				if err != nil {
+					k.log.Error("Cannot update batch tx pending", "hash", tx.Hash(), "msg", err)
+					return false, blockNumber
+				}
+				continue
+			}
+
 			if receipt.Status == 1 {
 				// Transaction succeeded
 				// clear from tx_pending, move to tx_submited
-				ok, _tx, err := k.txStore.UpdateTxPendingToSubmited(txHash.Hex())
+				ok, _tx, err := k.txStore.UpdateTxPendingToSubmited(txHash.Hex(), receipt.GasUsed)
 				if !ok && err != nil {
 					k.log.Error("Cannot update tx pending to submited", "hash", tx.Hash(), "msg", err)
 					return false, blockNumber
@@ -136,18 +187,21 @@ func (k *Keeper) processTransactions(ctx context.Context, blockNumber *big.Int)
 
 				if ok {
 					duration := time.Since(_tx.Timestamp)
-					k.log.Info("🔗 Finalized transaction", "  hash", tx.Hash(), "finalized", geth_common.PrettyDuration(duration))
+					k.log.Info("🔗 Finalized transaction", "  hash", tx.Hash(), "finalized", geth_common.PrettyDuration(duration), "gasUsed", receipt.GasUsed, "gasEstimate", _tx.GasEstimate)
 				}
 			} else if receipt.Status == 0 {
 				// Transaction failed or was reverted
-				// clear from tx_pending, move to tx_fail to enqueue for retry again
-				ok, _, err := k.txStore.UpdateTxPendingToFail(txHash.Hex())
+				// clear from tx_pending, move to tx_fail, the Signer retries it after the backoff
+				reason := k.revertReason(ctx, tx, receipt)
+				ok, _tx, err := k.txStore.UpdateTxPendingToFail(txHash.Hex(), reason, receipt.GasUsed)
 				if !ok && err != nil {
 					k.log.Error("Cannot update tx pending to fail", "hash", tx.Hash(), "msg", err)
 					return false, blockNumber
 				}
 
-				k.log.Info("😱 Transaction receipt fail", "  hash", tx.Hash(), "msg", "tx failed or reverted, enqueue to retry again")
+				if ok {
+					k.log.Info("😱 Transaction receipt fail", "  hash", tx.Hash(), "reason", reason, "msg", "enqueue to retry", "attempts", _tx.RetryCount)
+				}
 			}
 		}
 		txs += len(block.Transactions())
@@ -0,0 +1,292 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"erc20-permit-relayer/store"
+
+	"github.com/ethereum/go-ethereum"
+	geth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Nonce gap detection and repair of the signer accounts
+
+// repairNonces compares the on-chain nonces with the tx nonces of pending txs, signs duplicates again and fills gaps
+func (s *Signer) repairNonces(ctx context.Context, account *signerAccount) error {
+	// Ensure only one access
+	account.mutex.Lock()
+	defer account.mutex.Unlock()
+
+	minedNonce, err := s.client.NonceAt(ctx, account.address, nil)
+	if err != nil {
+		return err
+	}
+	localTxNonce, err := s.txStore.GetSignerTxNonce(account.storeAddress())
+	if err != nil {
+		return err
+	}
+	if localTxNonce <= minedNonce {
+		return nil
+	}
+
+	// Self-transfers filling gaps are not in tx_pending
+	s.replaceGapFill(ctx, account, minedNonce)
+
+	txs, err := s.txStore.GetSignedTxPending(account.storeAddress(), minedNonce)
+	if err != nil {
+		return err
+	}
+
+	// A tx hash known by the node keeps a nonce shared with other txs
+	live, err := s.liveSharedNonces(ctx, txs, minedNonce)
+	if err != nil {
+		return err
+	}
+	duplicates, used, nextNonce := nonceUsage(txs, minedNonce, live)
+	for _, tx := range duplicates {
+		err = s.txStore.ResetTxPendingSigned(tx.PermitHash)
+		if err != nil {
+			return err
+		}
+		account.log.Warn("Duplicate tx nonce, sign the permit again", "permit", tx.PermitHash, "nonce", tx.TxNonce)
+	}
+
+	// Release trailing nonces not used by pending txs
+	if nextNonce < localTxNonce {
+		err = s.txStore.ResetSignerTxNonce(account.storeAddress(), nextNonce)
+		if err != nil {
+			return err
+		}
+		account.log.Info("Release unused tx nonces", "from", nextNonce, "to", localTxNonce-1)
+	}
+
+	// Gaps below the pending nonce of the node are filled in its mempool
+	pendingNonce, err := s.client.PendingNonceAt(ctx, account.address)
+	if err != nil {
+		return err
+	}
+	gaps := nonceGaps(used, pendingNonce, nextNonce)
+	if len(gaps) == 0 {
+		return nil
+	}
+
+	return s.fillNonceGaps(ctx, account, gaps, nextNonce)
+}
+
+// txNonces returns the nonces used by the signed tx and its permit transaction
+func txNonces(tx store.Tx, minedNonce uint64) []uint64 {
+	nonces := []uint64{tx.TxNonce}
+	if len(tx.TxPermitSigned) > 0 && tx.TxNonce > minedNonce {
+		nonces = append(nonces, tx.TxNonce-1)
+	}
+	return nonces
+}
+
+// liveSharedNonces returns the tx hashes known by the node among the txs sharing a nonce
+func (s *Signer) liveSharedNonces(ctx context.Context, txs []store.Tx, minedNonce uint64) (map[string]bool, error) {
+	hashes := make(map[uint64]map[string]bool)
+	for _, tx := range txs {
+		for _, nonce := range txNonces(tx, minedNonce) {
+			if hashes[nonce] == nil {
+				hashes[nonce] = make(map[string]bool)
+			}
+			hashes[nonce][tx.TxHash] = true
+		}
+	}
+
+	live := make(map[string]bool)
+	checked := make(map[string]bool)
+	for _, tx := range txs {
+		shared := false
+		for _, nonce := range txNonces(tx, minedNonce) {
+			shared = shared || len(hashes[nonce]) > 1
+		}
+		if !shared || checked[tx.TxHash] {
+			continue
+		}
+		checked[tx.TxHash] = true
+
+		known, err := s.transactionKnown(ctx, tx.TxHash)
+		if err != nil {
+			return nil, err
+		}
+		live[tx.TxHash] = known
+	}
+	return live, nil
+}
+
+// transactionKnown checks the tx hash has a receipt or is in the mempool
+func (s *Signer) transactionKnown(ctx context.Context, txHash string) (bool, error) {
+	hash := geth_common.HexToHash(txHash)
+	_, err := s.client.TransactionReceipt(ctx, hash)
+	if err == nil {
+		return true, nil
+	}
+	if err != ethereum.NotFound {
+		return false, err
+	}
+	_, _, err = s.client.TransactionByHash(ctx, hash)
+	if err == ethereum.NotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// nonceUsage assigns the nonces of the signed txs, live tx hashes first then in signing order.
+// It returns the txs sharing a nonce with an assigned one, the tx hash using each nonce and the next nonce after them,
+// permits of one batch share the tx
+func nonceUsage(txs []store.Tx, minedNonce uint64, live map[string]bool) ([]store.Tx, map[uint64]string, uint64) {
+	var duplicates []store.Tx
+	used := make(map[uint64]string)
+	nextNonce := minedNonce
+	assign := func(tx store.Tx) {
+		nonces := txNonces(tx, minedNonce)
+		for _, nonce := range nonces {
+			if used[nonce] != "" && used[nonce] != tx.TxHash {
+				duplicates = append(duplicates, tx)
+				return
+			}
+		}
+		for _, nonce := range nonces {
+			used[nonce] = tx.TxHash
+			if nonce+1 > nextNonce {
+				nextNonce = nonce + 1
+			}
+		}
+	}
+
+	for _, tx := range txs {
+		if live[tx.TxHash] {
+			assign(tx)
+		}
+	}
+	for _, tx := range txs {
+		if !live[tx.TxHash] {
+			assign(tx)
+		}
+	}
+	return duplicates, used, nextNonce
+}
+
+// nonceGaps returns the nonces from the pending nonce of the node to the next nonce not used by a pending tx
+func nonceGaps(used map[uint64]string, pendingNonce uint64, nextNonce uint64) []uint64 {
+	var gaps []uint64
+	for nonce := pendingNonce; nonce < nextNonce; nonce++ {
+		if used[nonce] == "" {
+			gaps = append(gaps, nonce)
+		}
+	}
+	return gaps
+}
+
+// fillNonceGaps signs queued permits that fit the free nonces, or zero-value self-transfers when none is left
+func (s *Signer) fillNonceGaps(ctx context.Context, account *signerAccount, gaps []uint64, nextNonce uint64) error {
+	fees, err := s.suggestFees(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Queued permits of the account
+	pendingTxs, err := s.txStore.GetAllTxPending(account.storeAddress(), s.chain.Signer.SenderBulkSize)
+	if err != nil {
+		return err
+	}
+	var queued []store.Tx
+	for _, tx := range pendingTxs {
+		if tx.TxHash == "" {
+			queued = append(queued, tx)
+		}
+	}
+
+	gapSet := make(map[uint64]bool)
+	for _, nonce := range gaps {
+		gapSet[nonce] = true
+	}
+
+	for _, nonce := range gaps {
+		if !gapSet[nonce] {
+			continue
+		}
+
+		// Consecutive free nonces from the gap
+		free := uint64(0)
+		for gapSet[nonce+free] && nonce+free < nextNonce {
+			free++
+		}
+
+		filled := false
+		for i, tx := range queued {
+			calls, err := s.pendingCalls(tx)
+			if err != nil {
+				continue
+			}
+			calls, err = s.unappliedCalls(ctx, tx, calls)
+			if err != nil || uint64(len(calls)) > free {
+				continue
+			}
+
+			_, err = s.signPendingTransaction(ctx, account, tx, calls, nonce, fees)
+			if err != nil {
+				return err
+			}
+			for j := range calls {
+				delete(gapSet, nonce+uint64(j))
+			}
+			queued = append(queued[:i], queued[i+1:]...)
+			account.log.Info("Fill nonce gap with queued permit", "permit", tx.PermitHash, "nonce", nonce)
+			filled = true
+			break
+		}
+		if filled {
+			continue
+		}
+
+		// Nothing left to fill it
+		tx, err := account.backend.SignTx(ctx, s.newTransaction(nonce, txCall{to: account.address, gas: params.TxGas}, fees), s.txSigner())
+		if err != nil {
+			return err
+		}
+		err = s.client.SendTransaction(ctx, tx)
+		if err != nil && classifySendError(err) != sendErrorKnown {
+			return err
+		}
+		account.gapFills[nonce] = gapFill{tx: tx, sent: time.Now()}
+		delete(gapSet, nonce)
+		account.log.Info("Fill nonce gap with self-transfer", "  hash", tx.Hash(), "nonce", nonce)
+	}
+
+	return nil
+}
+
+// replaceGapFill bumps the fees of the gap self-transfer blocking the account like a stuck tx
+func (s *Signer) replaceGapFill(ctx context.Context, account *signerAccount, minedNonce uint64) {
+	for nonce := range account.gapFills {
+		if nonce < minedNonce {
+			delete(account.gapFills, nonce)
+		}
+	}
+	fill, ok := account.gapFills[minedNonce]
+	if !ok || s.chain.Signer.ReplaceAfter == 0 || time.Since(fill.sent) < s.chain.Signer.ReplaceAfter*time.Millisecond {
+		return
+	}
+
+	fees, err := s.suggestFees(ctx)
+	if err != nil {
+		account.log.Warn("Failed to replace nonce gap self-transfer", "hash", fill.tx.Hash(), "nonce", minedNonce, "msg", err)
+		return
+	}
+	replacedTx, err := s.replacementTransaction(ctx, account, fill.tx, fees, s.chain.Signer.FeeCeiling)
+	if err != nil {
+		account.log.Warn("Failed to replace nonce gap self-transfer", "hash", fill.tx.Hash(), "nonce", minedNonce, "msg", err)
+		return
+	}
+	err = s.client.SendTransaction(ctx, replacedTx)
+	if err != nil && classifySendError(err) != sendErrorKnown {
+		account.log.Warn("Failed to replace nonce gap self-transfer", "hash", replacedTx.Hash(), "nonce", minedNonce, "msg", err)
+		return
+	}
+	account.gapFills[minedNonce] = gapFill{tx: replacedTx, sent: time.Now()}
+	account.log.Info("⛽ Replaced stuck nonce gap self-transfer", "  hash", replacedTx.Hash(), "replaced", fill.tx.Hash(), "nonce", minedNonce)
+}
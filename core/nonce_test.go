@@ -0,0 +1,60 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	"erc20-permit-relayer/store"
+)
+
+func TestNonceUsage(t *testing.T) {
+	txs := []store.Tx{
+		{PermitHash: "p1", TxHash: "a", TxNonce: 5},
+		{PermitHash: "p2", TxHash: "b", TxNonce: 5},                                // duplicate of a, live
+		{PermitHash: "p3", TxHash: "c", TxNonce: 6},                                // batch with p4
+		{PermitHash: "p4", TxHash: "c", TxNonce: 6},                                // batch with p3
+		{PermitHash: "p5", TxHash: "d", TxNonce: 9, TxPermitSigned: []byte{0x01}},  // permit tx at 8
+		{PermitHash: "p6", TxHash: "e", TxNonce: 8},                                // duplicate of d permit tx
+		{PermitHash: "p7", TxHash: "f", TxNonce: 10, TxPermitSigned: []byte{0x01}}, // permit tx at 9, duplicate of d
+	}
+
+	// First signed keeps a shared nonce
+	duplicates, used, nextNonce := nonceUsage(txs, 5, map[string]bool{})
+	var reset []string
+	for _, tx := range duplicates {
+		reset = append(reset, tx.PermitHash)
+	}
+	if !reflect.DeepEqual(reset, []string{"p2", "p6", "p7"}) {
+		t.Errorf("nonceUsage returned duplicates %v, expected [p2 p6 p7]", reset)
+	}
+	if nextNonce != 10 {
+		t.Errorf("nonceUsage returned next nonce %d, expected 10", nextNonce)
+	}
+	if gaps := nonceGaps(used, 5, nextNonce); !reflect.DeepEqual(gaps, []uint64{7}) {
+		t.Errorf("nonceGaps returned %v, expected [7]", gaps)
+	}
+
+	// Live tx hashes keep a shared nonce
+	duplicates, used, nextNonce = nonceUsage(txs, 5, map[string]bool{"b": true, "e": true, "f": true})
+	reset = nil
+	for _, tx := range duplicates {
+		reset = append(reset, tx.PermitHash)
+	}
+	if !reflect.DeepEqual(reset, []string{"p1", "p5"}) {
+		t.Errorf("nonceUsage returned duplicates %v, expected [p1 p5]", reset)
+	}
+	if used[5] != "b" || used[9] != "f" || used[10] != "f" {
+		t.Errorf("nonceUsage returned used nonces %v", used)
+	}
+	if nextNonce != 11 {
+		t.Errorf("nonceUsage returned next nonce %d, expected 11", nextNonce)
+	}
+	if gaps := nonceGaps(used, 6, nextNonce); !reflect.DeepEqual(gaps, []uint64{7}) {
+		t.Errorf("nonceGaps returned %v, expected [7]", gaps)
+	}
+
+	// Gaps below the pending nonce of the node are in its mempool
+	if gaps := nonceGaps(used, 8, nextNonce); gaps != nil {
+		t.Errorf("nonceGaps returned %v, expected none", gaps)
+	}
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"erc20-permit-relayer/common"
+
+	geth_common "github.com/ethereum/go-ethereum/common"
+)
+
+// Uniswap Permit2 SignatureTransfer requests
+
+func (p *ProcessRequest) verifyPermit2Data(token *common.TokenConfig, values common.PermitType) error {
+	// Ensure only one access
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// Check deadline
+	if err := checkDeadline(token, values.Deadline, time.Now()); err != nil {
+		return err
+	}
+
+	// Check unordered nonce with pending txs, nonces are shared by all tokens of the Permit2 contract
+	tokens := []string{}
+	for _, t := range p.chain.Tokens {
+		if t.Mode == common.TokenModePermit2 && t.Permit2 == token.Permit2 {
+			tokens = append(tokens, t.Address.Hex())
+		}
+	}
+	pending, err := p.txStore.HasTxPendingNonce(tokens, values.Owner.Hex(), values.Nonce)
+	if err != nil {
+		return err
+	}
+	if pending {
+		return fmt.Errorf("permit2 nonce already pending")
+	}
+
+	// Check unordered nonce on-chain
+	wordPos, bitPos := common.Permit2NonceBitmapPosition(values.Nonce)
+	bitmap, err := p.wrapQueryUint256(token.Permit2, "0x4fe02b44", geth_common.BytesToHash(values.Owner.Bytes()), geth_common.BigToHash(wordPos)) // Permit2.nonceBitmap(address,uint256)
+	if err != nil {
+		return err
+	}
+	if bitmap.Bit(int(bitPos)) != 0 {
+		return fmt.Errorf("permit2 nonce already used")
+	}
+
+	// Check allowance to Permit2
+	allowance, err := p.wrapQueryUint256(token.Address, "0xdd62ed3e", geth_common.BytesToHash(values.Owner.Bytes()), geth_common.BytesToHash(token.Permit2.Bytes())) // ERC20.allowance(address,address)
+	if err != nil {
+		return err
+	}
+	if allowance.Cmp(values.Value) < 0 {
+		return fmt.Errorf("insifficient allowance to permit2 %s", token.Permit2.Hex())
+	}
+
+	// Check balance
+	balance, err := p.wrapQueryERC20BalanceOf(token, values.Owner.Hex())
+	if err != nil {
+		return err
+	}
+	if balance.Cmp(values.Value) < 0 {
+		return fmt.Errorf("insifficient balance")
+	}
+
+	return nil
+}
+
+// wrapQueryUint256 calls a view function with static arguments and returns uint256 result
+func (p *ProcessRequest) wrapQueryUint256(to geth_common.Address, selector string, args ...geth_common.Hash) (*big.Int, error) {
+	calldata := selector
+	for _, arg := range args {
+		calldata += arg.Hex()[2:]
+	}
+
+	payload := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_call",
+		"params": []interface{}{
+			map[string]interface{}{
+				"data": calldata,
+				"to":   to.Hex(),
+			},
+			"latest",
+		},
+		"id": 1,
+	}
+
+	response, err := p.forwardRequest(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the JSON string into the struct
+	var data map[string]interface{}
+	err = json.Unmarshal(response, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check nil result
+	result, ok := data["result"].(string)
+	if !ok || len(result) < 2 {
+		return nil, fmt.Errorf("failed to read response data result")
+	}
+
+	value, ok := new(big.Int).SetString(result[2:], 16) // remove 0x
+	if !ok {
+		return nil, fmt.Errorf("failed to read response data result")
+	}
+	return value, nil
+}
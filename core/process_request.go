@@ -14,6 +14,7 @@ import (
 	"erc20-permit-relayer/common"
 	"erc20-permit-relayer/store"
 
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	geth_common "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/common/mclock"
@@ -21,23 +22,42 @@ import (
 )
 
 type ProcessRequest struct {
-	config  *common.Config
-	log     log15.Logger
-	txStore store.TxStore
-	signer  Signer
-	mutex   sync.Mutex
+	config              *common.Config
+	chain               *common.ChainConfig
+	log                 log15.Logger
+	txStore             *store.TxStore
+	signer              *Signer
+	erc1271ABI          abi.ABI
+	erc6492ValidatorABI abi.ABI
+	signatureCache      map[geth_common.Hash]contractSignatureResult
+	mutex               sync.Mutex
+	cacheMutex          sync.Mutex
 }
 
-func NewProcessRequest(config *common.Config, log *log15.Logger, txStore *store.TxStore, signer *Signer) *ProcessRequest {
+func NewProcessRequest(config *common.Config, chain *common.ChainConfig, log *log15.Logger, txStore *store.TxStore, signer *Signer) *ProcessRequest {
+	erc1271ABI, err := abi.JSON(strings.NewReader(common.ERC1271ABI))
+	if err != nil {
+		(*log).Error("Failed to parse json abi", "msg", err)
+	}
+	erc6492ValidatorABI, err := abi.JSON(strings.NewReader(common.ERC6492ValidatorABI))
+	if err != nil {
+		(*log).Error("Failed to parse json abi", "msg", err)
+	}
+
 	return &ProcessRequest{
-		config:  config,
-		log:     *log,
-		txStore: *txStore,
-		signer:  *signer,
+		config:              config,
+		chain:               chain,
+		log:                 *log,
+		txStore:             txStore,
+		signer:              signer,
+		erc1271ABI:          erc1271ABI,
+		erc6492ValidatorABI: erc6492ValidatorABI,
+		signatureCache:      make(map[geth_common.Hash]contractSignatureResult),
 	}
 }
 
-func (p *ProcessRequest) Process(requestBody map[string]interface{}) ([]byte, error) {
+// Process handles the request, the API key sets the priority class of delegated permits
+func (p *ProcessRequest) Process(requestBody map[string]interface{}, apiKey string) ([]byte, error) {
 	method, ok := requestBody["method"].(string)
 	if !ok {
 		return nil, fmt.Errorf("invalid request format: method not found")
@@ -60,16 +80,21 @@ func (p *ProcessRequest) Process(requestBody map[string]interface{}) ([]byte, er
 			return nil, fmt.Errorf("invalid eth_call params format")
 		}
 
-		// Check ERC20PermitTokenAddress
-		if bytes.Equal(p.config.ERC20PermitTokenAddress.Bytes(), geth_common.HexToAddress(to).Bytes()) {
-			calldata := strings.ToLower(data["data"].(string))
+		// Check configured tokens
+		if token, ok := p.chain.GetToken(geth_common.HexToAddress(to)); ok {
+			calldata, _ := data["data"].(string)
+			calldata = strings.ToLower(calldata)
 
 			if len(calldata) == 74 && calldata[:10] == "0x70a08231" { // ERC20.balanceOf(address)
 				account := "0x" + calldata[34:]
-				return p.queryERC20BalanceOf(requestBody, account)
+				return p.queryERC20BalanceOf(requestBody, token, account)
 			} else if len(calldata) == 74 && calldata[:10] == "0x7ecebe00" { // ERC20Permit.nonces(address)
 				account := "0x" + calldata[34:]
-				return p.queryERC20PermitNonce(requestBody, account)
+				return p.queryERC20PermitNonce(requestBody, token, account)
+			} else if len(calldata) == 138 && calldata[:10] == "0xe94a0102" && token.Mode == common.TokenModeEIP3009 { // EIP3009.authorizationState(address,bytes32)
+				account := "0x" + calldata[34:74]
+				nonce, _ := new(big.Int).SetString(calldata[74:], 16)
+				return p.queryAuthorizationState(requestBody, token, account, nonce)
 			}
 		}
 	} else if method == "delegate_permit" {
@@ -83,40 +108,108 @@ func (p *ProcessRequest) Process(requestBody map[string]interface{}) ([]byte, er
 			return nil, fmt.Errorf("invalid delegate_permit params format")
 		}
 
+		// Route token
+		token, err := p.parseToken(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid delegate_permit params: %v", err)
+		}
+		if token.Mode == common.TokenModeEIP3009 {
+			return nil, fmt.Errorf("invalid delegate_permit params: token %s is eip3009, use delegate_authorization", token.Address.Hex())
+		}
+
 		// Parse parameters
-		values, signature, err := p.parseDelegatePermitParams(data)
+		values, signature, err := p.parseDelegatePermitParams(token, data)
 		if err != nil {
 			return nil, fmt.Errorf("invalid delegate_permit params: %v", err)
 		}
 
 		// Verify permit signature
-		if err = p.verifyPermit(values, signature); err != nil {
+		permitHash, err := p.verifyPermit(token, values, signature)
+		if err != nil {
 			return nil, fmt.Errorf("invalid verify permit with signature: %v", err)
 		}
 
 		// Verify balance, nonce, deadline
-		if err = p.verifyData(values); err != nil {
+		if token.Mode == common.TokenModePermit2 {
+			err = p.verifyPermit2Data(token, values)
+		} else {
+			err = p.verifyData(token, values)
+		}
+		if err != nil {
 			return nil, fmt.Errorf("invalid verify data: %v", err)
 		}
 
 		if p.config.LogDebug {
-			p.log.Debug("Incoming delegate_permit", "owner", data["owner"], "receiver", data["receiver"], "value", data["value"])
+			p.log.Debug("Incoming delegate_permit", "token", token.Address, "owner", data["owner"], "receiver", data["receiver"], "value", data["value"])
 		}
 
-		// Added tx to tx_pending
-		txHash, err := p.signer.AddPendingTransaction(values, signature)
+		// Added permit to tx_pending
+		permitHash, err = p.signer.AddPendingTransaction(token, values, signature, permitHash, p.permitPriority(token, values, apiKey))
 		if err != nil {
 			return nil, fmt.Errorf("failed to add pending transaction: %v", err)
 		}
 
-		return common.MakeJsonResponseResult(requestBody["id"].(float64), txHash.Hex())
+		return common.MakeJsonResponseResult(requestBody["id"].(float64), permitHash.Hex())
+	} else if method == "delegate_authorization" {
+		params, ok := requestBody["params"].([]interface{})
+		if !ok || len(params) == 0 {
+			return nil, fmt.Errorf("invalid delegate_authorization params format")
+		}
+
+		data, ok := params[0].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid delegate_authorization params format")
+		}
+
+		return p.delegateAuthorization(requestBody, data, apiKey)
+	} else if method == "delegate_status" {
+		params, ok := requestBody["params"].([]interface{})
+		if !ok || len(params) == 0 {
+			return nil, fmt.Errorf("invalid delegate_status params format")
+		}
+
+		return p.delegateStatus(requestBody, params)
+	} else if strings.HasPrefix(method, "admin_") {
+		if !p.config.IsAdminApiKey(apiKey) {
+			return nil, fmt.Errorf("%s requires an admin api key", method)
+		}
+		if method == "admin_signedTransactions" {
+			return p.adminSignedTransactions(requestBody)
+		}
+		return nil, fmt.Errorf("unsupported method %s", method)
 	}
 
 	// Others case
 	return p.forwardRequest(requestBody)
 }
 
-func (p *ProcessRequest) parseDelegatePermitParams(data map[string]interface{}) (common.PermitType, []byte, error) {
+func (p *ProcessRequest) parseToken(data map[string]interface{}) (*common.TokenConfig, error) {
+	// Default to the only configured token
+	if _, ok := data["token"]; !ok {
+		if len(p.chain.Tokens) == 1 {
+			return &p.chain.Tokens[0], nil
+		}
+		return nil, fmt.Errorf("missing token")
+	}
+
+	address, ok := data["token"].(string)
+	if !ok || !geth_common.IsHexAddress(address) {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	token, ok := p.chain.GetToken(geth_common.HexToAddress(address))
+	if !ok {
+		return nil, fmt.Errorf("unsupported token %s", address)
+	}
+
+	return token, nil
+}
+
+func (p *ProcessRequest) parseDelegatePermitParams(token *common.TokenConfig, data map[string]interface{}) (common.PermitType, []byte, error) {
+	if token.Mode == common.TokenModeCustom {
+		return p.parseCustomPermitParams(token, data)
+	}
+
 	if _, ok := data["owner"].(string); !ok {
 		return common.PermitType{}, nil, fmt.Errorf("invalid owner")
 	}
@@ -152,15 +245,27 @@ func (p *ProcessRequest) parseDelegatePermitParams(data map[string]interface{})
 		return common.PermitType{}, nil, fmt.Errorf("invalid deadline")
 	}
 
+	// EIP-2612 or Permit2 spender, default to the relayer account of the owner or forwarder
+	spenderAddress := common.Address0x0
+	if token.Mode == common.TokenModeEIP2612 || token.Mode == common.TokenModePermit2 {
+		var err error
+		spenderAddress, err = p.parseSpenderParam(token, ownerAddress, data)
+		if err != nil {
+			return common.PermitType{}, nil, err
+		}
+	}
+
 	values := common.PermitType{
 		Owner:    ownerAddress,
 		Receiver: receiverAddress,
+		Spender:  spenderAddress,
 		Value:    value,
 		Nonce:    nonce,
 		Deadline: deadline,
+		Token:    token.Address,
 	}
 
-	signature, err := hexutil.Decode(data["signature"].(string))
+	signature, err := parseSignature(token, data)
 	if err != nil {
 		return common.PermitType{}, nil, err
 	}
@@ -168,34 +273,120 @@ func (p *ProcessRequest) parseDelegatePermitParams(data map[string]interface{})
 	return values, signature, nil
 }
 
-func (p *ProcessRequest) verifyPermit(values common.PermitType, signature []byte) error {
+// parseSpenderParam returns the spender param, the forwarder or the account of the owner, any relayer account for Permit2
+func (p *ProcessRequest) parseSpenderParam(token *common.TokenConfig, owner geth_common.Address, data map[string]interface{}) (geth_common.Address, error) {
+	spenderAddress := p.signer.Spender(token, owner)
+	if _, ok := data["spender"]; ok {
+		if _, ok := data["spender"].(string); !ok {
+			return common.Address0x0, fmt.Errorf("invalid spender")
+		}
+		if !p.signer.IsSpender(token, owner, geth_common.HexToAddress(data["spender"].(string))) {
+			return common.Address0x0, fmt.Errorf("invalid spender, require %s", spenderAddress.Hex())
+		}
+		spenderAddress = geth_common.HexToAddress(data["spender"].(string))
+	}
+	return spenderAddress, nil
+}
+
+// parseSignature decodes the signature param to the canonical encoding, 64 bytes are EIP-2098 compact
+// for tokens taking (v, r, s), or with the compact param for tokens passing signature bytes to wallets
+func parseSignature(token *common.TokenConfig, data map[string]interface{}) ([]byte, error) {
+	if _, ok := data["signature"].(string); !ok {
+		return nil, fmt.Errorf("invalid signature")
+	}
+
+	signature, err := hexutil.Decode(data["signature"].(string))
+	if err != nil {
+		return nil, err
+	}
+
+	compact := !token.SignatureBytes()
+	if _, ok := data["compact"]; ok {
+		value, ok := data["compact"].(bool)
+		if !ok {
+			return nil, fmt.Errorf("invalid compact")
+		}
+		compact = compact || value
+	}
+
+	return common.NormalizeSignature(signature, compact)
+}
+
+// verifyPermit checks the permit is signed by the owner and returns the EIP-712 permit hash
+func (p *ProcessRequest) verifyPermit(token *common.TokenConfig, values common.PermitType, signature []byte) (geth_common.Hash, error) {
 	domain := common.Domain{
-		Name:              p.config.ERC20PermitTokenName,
-		Version:           "1",
-		ChainId:           p.config.NetworkId,
-		VerifyingContract: p.config.ERC20PermitTokenAddress,
+		Name:              token.Name,
+		Version:           token.Version,
+		ChainId:           p.chain.NetworkId,
+		VerifyingContract: token.Address,
+	}
+
+	if token.Mode == common.TokenModePermit2 {
+		domain = common.Domain{
+			Name:              "Permit2",
+			ChainId:           p.chain.NetworkId,
+			VerifyingContract: token.Permit2,
+		}
 	}
 
-	signerAddress, err := common.VerifySignature(domain, values, signature)
+	hash, err := common.HashTypedData(common.MakeTokenTypedData(token, domain, values))
 	if err != nil {
-		return err
+		return geth_common.Hash{}, err
 	}
+	permitHash := geth_common.BytesToHash(hash)
 
 	// Check signer must equal owner
-	if !bytes.Equal(signerAddress.Bytes(), values.Owner.Bytes()) {
-		return fmt.Errorf("recovered signer mismatch, signer: %v owner: %v", signerAddress.Hex(), values.Owner.Hex())
+	signerAddress := common.Address0x0
+	if len(signature) == 65 {
+		signerAddress, err = common.RecoverSigner(hash, signature)
+		if err == nil && bytes.Equal(signerAddress.Bytes(), values.Owner.Bytes()) {
+			return permitHash, nil
+		}
 	}
 
-	return nil
+	// Token contracts taking (v, r, s) only recover EOA signers, Permit2 passes any signature bytes to the wallet
+	if !token.SignatureBytes() {
+		if common.IsERC6492Signature(signature) {
+			return geth_common.Hash{}, fmt.Errorf("contract signatures not supported for token mode %s", token.Mode)
+		}
+		code, err := p.wrapQueryCode(values.Owner)
+		if err != nil {
+			return geth_common.Hash{}, err
+		}
+		if len(code) > 0 {
+			return geth_common.Hash{}, fmt.Errorf("contract signatures not supported for token mode %s", token.Mode)
+		}
+		if len(signature) != 65 {
+			return geth_common.Hash{}, fmt.Errorf("invalid signature length, token mode %s requires 65 bytes", token.Mode)
+		}
+		if signerAddress != common.Address0x0 {
+			return geth_common.Hash{}, fmt.Errorf("recovered signer mismatch, signer: %v owner: %v", signerAddress.Hex(), values.Owner.Hex())
+		}
+		return geth_common.Hash{}, fmt.Errorf("invalid signature of owner %v", values.Owner.Hex())
+	}
+
+	// Fallback to ERC-1271 smart contract wallet
+	valid, err := p.verifyContractSignature(values.Owner, hash, signature)
+	if err != nil {
+		return geth_common.Hash{}, err
+	}
+	if !valid {
+		if signerAddress != common.Address0x0 {
+			return geth_common.Hash{}, fmt.Errorf("recovered signer mismatch, signer: %v owner: %v", signerAddress.Hex(), values.Owner.Hex())
+		}
+		return geth_common.Hash{}, fmt.Errorf("invalid signature of owner %v", values.Owner.Hex())
+	}
+
+	return permitHash, nil
 }
 
-func (p *ProcessRequest) verifyData(values common.PermitType) error {
+func (p *ProcessRequest) verifyData(token *common.TokenConfig, values common.PermitType) error {
 	// Ensure only one access
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
 	// Check nonce
-	nonce, err := p.wrapQueryERC20PermitNonce(values.Owner.Hex())
+	nonce, err := p.wrapQueryERC20PermitNonce(token, values.Owner.Hex())
 	if err != nil {
 		return err
 	}
@@ -204,7 +395,7 @@ func (p *ProcessRequest) verifyData(values common.PermitType) error {
 	}
 
 	// Check balance
-	balance, err := p.wrapQueryERC20BalanceOf(values.Owner.Hex())
+	balance, err := p.wrapQueryERC20BalanceOf(token, values.Owner.Hex())
 	if err != nil {
 		return err
 	}
@@ -213,29 +404,32 @@ func (p *ProcessRequest) verifyData(values common.PermitType) error {
 	}
 
 	// Check deadline
-	differenceInSeconds := values.Deadline.Int64() - time.Now().Unix()
-	if differenceInSeconds < p.config.DeadlineMinimum {
-		return fmt.Errorf("minimum deadline is %d days", p.config.DeadlineMinimum/(24*60*60))
-	}
+	return checkDeadline(token, values.Deadline, time.Now())
+}
 
+// checkDeadline checks the deadline is at least deadline_minimum ahead, compared as big.Int since deadlines up to max uint256 are valid
+func checkDeadline(token *common.TokenConfig, deadline *big.Int, now time.Time) error {
+	if deadline.Cmp(new(big.Int).Add(big.NewInt(now.Unix()), big.NewInt(token.DeadlineMinimum))) < 0 {
+		return fmt.Errorf("minimum deadline is %d days", token.DeadlineMinimum/(24*60*60))
+	}
 	return nil
 }
 
-func (p *ProcessRequest) wrapQueryERC20BalanceOf(account string) (*big.Int, error) {
+func (p *ProcessRequest) wrapQueryERC20BalanceOf(token *common.TokenConfig, account string) (*big.Int, error) {
 	payload := map[string]interface{}{
 		"jsonrpc": "2.0",
 		"method":  "eth_call",
 		"params": []interface{}{
 			map[string]interface{}{
 				"data": "0x70a08231000000000000000000000000" + account[2:],
-				"to":   p.config.ERC20PermitTokenAddress.Hex(),
+				"to":   token.Address.Hex(),
 			},
 			"latest",
 		},
 		"id": 1,
 	}
 
-	response, err := p.queryERC20BalanceOf(payload, account)
+	response, err := p.queryERC20BalanceOf(payload, token, account)
 	if err != nil {
 		return nil, err
 	}
@@ -251,21 +445,21 @@ func (p *ProcessRequest) wrapQueryERC20BalanceOf(account string) (*big.Int, erro
 	return balance, nil
 }
 
-func (p *ProcessRequest) wrapQueryERC20PermitNonce(account string) (*big.Int, error) {
+func (p *ProcessRequest) wrapQueryERC20PermitNonce(token *common.TokenConfig, account string) (*big.Int, error) {
 	payload := map[string]interface{}{
 		"jsonrpc": "2.0",
 		"method":  "eth_call",
 		"params": []interface{}{
 			map[string]interface{}{
 				"data": "0x7ecebe00000000000000000000000000" + account[2:],
-				"to":   p.config.ERC20PermitTokenAddress.Hex(),
+				"to":   token.Address.Hex(),
 			},
 			"latest",
 		},
 		"id": 1,
 	}
 
-	response, err := p.queryERC20PermitNonce(payload, account)
+	response, err := p.queryERC20PermitNonce(payload, token, account)
 	if err != nil {
 		return nil, err
 	}
@@ -281,7 +475,7 @@ func (p *ProcessRequest) wrapQueryERC20PermitNonce(account string) (*big.Int, er
 	return nonce, nil
 }
 
-func (p *ProcessRequest) queryERC20BalanceOf(requestBody map[string]interface{}, account string) ([]byte, error) {
+func (p *ProcessRequest) queryERC20BalanceOf(requestBody map[string]interface{}, token *common.TokenConfig, account string) ([]byte, error) {
 	start := mclock.Now()
 
 	// Get balanceOf from direct rpc
@@ -308,7 +502,7 @@ func (p *ProcessRequest) queryERC20BalanceOf(requestBody map[string]interface{},
 	balance.SetString(data["result"].(string)[2:], 16) // remove 0x
 
 	// Get pending balance from txStore
-	pending_balance, err := p.txStore.GetPendingBalance(account)
+	pending_balance, err := p.txStore.GetPendingBalance(token.Address.Hex(), account)
 	if err != nil {
 		return nil, err
 	}
@@ -317,7 +511,7 @@ func (p *ProcessRequest) queryERC20BalanceOf(requestBody map[string]interface{},
 	unrealize_balance := new(big.Int).Add(balance, pending_balance)
 
 	if p.config.LogDebug {
-		p.log.Debug("Query ERC20.balanceOf", "account", account, "realize", common.ParseEther(balance), "pending", common.ParseEther(pending_balance), "unrealize", common.ParseEther(unrealize_balance), "elapsed", geth_common.PrettyDuration(mclock.Now().Sub(start)))
+		p.log.Debug("Query ERC20.balanceOf", "token", token.Address, "account", account, "realize", common.ParseEther(balance), "pending", common.ParseEther(pending_balance), "unrealize", common.ParseEther(unrealize_balance), "elapsed", geth_common.PrettyDuration(mclock.Now().Sub(start)))
 	}
 
 	// Check negative value to default 0
@@ -338,7 +532,7 @@ func (p *ProcessRequest) queryERC20BalanceOf(requestBody map[string]interface{},
 	return updatedJSON, nil
 }
 
-func (p *ProcessRequest) queryERC20PermitNonce(requestBody map[string]interface{}, account string) ([]byte, error) {
+func (p *ProcessRequest) queryERC20PermitNonce(requestBody map[string]interface{}, token *common.TokenConfig, account string) ([]byte, error) {
 	start := mclock.Now()
 
 	// Get balanceOf from direct rpc
@@ -365,7 +559,7 @@ func (p *ProcessRequest) queryERC20PermitNonce(requestBody map[string]interface{
 	nonce.SetString(data["result"].(string)[2:], 16) // remove 0x
 
 	// Get pending balance from txStore
-	pending_txs, err := p.txStore.GetPendingTxs(account)
+	pending_txs, err := p.txStore.GetPendingTxs(token.Address.Hex(), account)
 	if err != nil {
 		return nil, err
 	}
@@ -374,7 +568,7 @@ func (p *ProcessRequest) queryERC20PermitNonce(requestBody map[string]interface{
 	latest_nonce := new(big.Int).Add(nonce, big.NewInt(pending_txs))
 
 	if p.config.LogDebug {
-		p.log.Debug("Query ERC20Permit.nonce", "account", account, "nonce", latest_nonce.String(), "pending_txs", pending_txs, "elapsed", geth_common.PrettyDuration(mclock.Now().Sub(start)))
+		p.log.Debug("Query ERC20Permit.nonce", "token", token.Address, "account", account, "nonce", latest_nonce.String(), "pending_txs", pending_txs, "elapsed", geth_common.PrettyDuration(mclock.Now().Sub(start)))
 	}
 
 	// Update result with uint256 (64 hexadecimal characters)
@@ -396,7 +590,7 @@ func (p *ProcessRequest) forwardRequest(requestBody map[string]interface{}) ([]b
 		return nil, err
 	}
 
-	resp, err := http.Post(p.config.RpcEndpoint, "application/json", bytes.NewBuffer(reqJSON))
+	resp, err := http.Post(p.chain.RpcEndpoint, "application/json", bytes.NewBuffer(reqJSON))
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request to endpoint: %v", err)
 	}
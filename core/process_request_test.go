@@ -0,0 +1,32 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"erc20-permit-relayer/common"
+
+	"github.com/ethereum/go-ethereum/common/math"
+)
+
+func TestCheckDeadline(t *testing.T) {
+	token := &common.TokenConfig{DeadlineMinimum: 3600}
+	now := time.Unix(1700000000, 0)
+
+	cases := []struct {
+		deadline *big.Int
+		valid    bool
+	}{
+		{big.NewInt(1700003600), true},  // at the minimum
+		{big.NewInt(1700003599), false}, // one second short
+		{big.NewInt(0), false},
+		{math.MaxBig256, true}, // type(uint256).max never expires
+		{new(big.Int).Add(big.NewInt(math.MaxInt64), big.NewInt(1)), true},
+	}
+	for _, c := range cases {
+		if err := checkDeadline(token, c.deadline, now); (err == nil) != c.valid {
+			t.Errorf("checkDeadline returned %v for deadline %s", err, c.deadline)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"erc20-permit-relayer/store"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Stuck transaction replacement with the same nonce and bumped fees
+
+// replaceStuckTransactions re-signs the tx at the mined nonce broadcast longer than replace_after and not mined yet
+func (s *Signer) replaceStuckTransactions(ctx context.Context, account *signerAccount) (int, error) {
+	if s.chain.Signer.ReplaceAfter == 0 {
+		return 0, nil
+	}
+
+	// Ensure only one access
+	account.mutex.Lock()
+	defer account.mutex.Unlock()
+
+	txs, err := s.txStore.GetStuckTxPending(account.storeAddress(), s.chain.Signer.ReplaceAfter*time.Millisecond, s.chain.Signer.SenderBulkSize)
+	if err != nil {
+		return 0, err
+	}
+	if len(txs) == 0 {
+		return 0, nil
+	}
+
+	// Mined nonce, txs below it wait for the Keeper
+	minedNonce, err := s.client.NonceAt(ctx, account.address, nil)
+	if err != nil {
+		return 0, err
+	}
+	fees, err := s.suggestFees(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	replaceCount := 0
+	replaced := make(map[string]bool)
+	for _, tx := range txs {
+		// Only the tx blocking the account at the mined nonce is bumped, the txs after it wait for it
+		blocking := tx.TxNonce == minedNonce || (len(tx.TxPermitSigned) > 0 && tx.TxNonce == minedNonce+1)
+		// Permits of one batch share the transaction
+		if !blocking || replaced[tx.TxHash] {
+			continue
+		}
+		replaced[tx.TxHash] = true
+
+		err := s.replaceTransaction(ctx, account, tx, minedNonce, fees)
+		if err != nil {
+			account.log.Warn("Failed to replace stuck transaction", "hash", tx.TxHash, "nonce", tx.TxNonce, "msg", err)
+			continue
+		}
+		replaceCount++
+	}
+
+	return replaceCount, nil
+}
+
+func (s *Signer) replaceTransaction(ctx context.Context, account *signerAccount, tx store.Tx, minedNonce uint64, fees txFees) error {
+	signedTx, err := decodeTransaction(tx.TxSigned)
+	if err != nil {
+		return err
+	}
+
+	// Close to the deadline, replace above the fee ceiling within the emergency budget
+	feeCeiling := s.chain.Signer.FeeCeiling
+	if s.feeDecision(tx, fees, time.Now()) == feeEmergency {
+		bumpedFees, err := s.bumpFees(signedTx, fees, 0)
+		if err != nil {
+			return err
+		}
+		txs := 1
+		if len(tx.TxPermitSigned) > 0 {
+			txs = 2
+		}
+		spent, err := s.spendEmergencyBudget(tx.PermitHash, s.emergencyCost(bumpedFees, txs))
+		if err != nil {
+			return err
+		}
+		if spent {
+			feeCeiling = 0
+		}
+	}
+
+	// Re-sign the permit or wallet deploy transaction when not mined
+	var txPermitSigned []byte
+	if len(tx.TxPermitSigned) > 0 {
+		permitTx, err := decodeTransaction(tx.TxPermitSigned)
+		if err != nil {
+			return err
+		}
+		txPermitSigned = tx.TxPermitSigned
+		if permitTx.Nonce() >= minedNonce {
+			replacedPermitTx, err := s.replacementTransaction(ctx, account, permitTx, fees, feeCeiling)
+			if err != nil {
+				return err
+			}
+			txPermitSigned, err = encodeTransaction(replacedPermitTx)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	replacedTx, err := s.replacementTransaction(ctx, account, signedTx, fees, feeCeiling)
+	if err != nil {
+		return err
+	}
+	txSigned, err := encodeTransaction(replacedTx)
+	if err != nil {
+		return err
+	}
+
+	// Record the replacement before sending, keep the replaced hashes
+	err = s.txStore.UpdateTxPendingReplaced(tx.TxHash, replacedTx.Hash().Hex(), txSigned, txPermitSigned)
+	if err != nil {
+		return err
+	}
+
+	// Send the permit transaction first
+	if len(txPermitSigned) > 0 && !bytes.Equal(txPermitSigned, tx.TxPermitSigned) {
+		permitTx, _ := decodeTransaction(txPermitSigned)
+		err = s.client.SendTransaction(ctx, permitTx)
+		if err != nil {
+			account.log.Warn("Failed to send replacement permit transaction", "hash", permitTx.Hash(), "msg", err)
+		}
+	}
+
+	err = s.client.SendTransaction(ctx, replacedTx)
+	if err != nil {
+		return err
+	}
+
+	account.log.Info("⛽ Replaced stuck transaction", "  hash", replacedTx.Hash(), "replaced", signedTx.Hash(), "nonce", replacedTx.Nonce())
+	return nil
+}
+
+// replacementTransaction signs the same call and nonce with fees bumped over the stuck transaction
+func (s *Signer) replacementTransaction(ctx context.Context, account *signerAccount, stuckTx *types.Transaction, fees txFees, feeCeiling uint64) (*types.Transaction, error) {
+	bumpedFees, err := s.bumpFees(stuckTx, fees, feeCeiling)
+	if err != nil {
+		return nil, err
+	}
+
+	call := txCall{to: *stuckTx.To(), data: stuckTx.Data(), gas: stuckTx.Gas()}
+	return account.backend.SignTx(ctx, s.newTransaction(stuckTx.Nonce(), call, bumpedFees), s.txSigner())
+}
+
+// bumpFees returns fees at least fee_bump_percent above the stuck transaction and the current fees,
+// under the max fee cap and the fee ceiling when not 0
+func (s *Signer) bumpFees(stuckTx *types.Transaction, current txFees, feeCeiling uint64) (txFees, error) {
+	signerConfig := s.chain.Signer
+	bump := func(fee *big.Int) *big.Int {
+		bumped := new(big.Int).Mul(fee, new(big.Int).SetUint64(100+signerConfig.FeeBumpPercent))
+		bumped.Add(bumped, big.NewInt(99)) // round up
+		return bumped.Div(bumped, big.NewInt(100))
+	}
+	max := func(a, b *big.Int) *big.Int {
+		if a.Cmp(b) > 0 {
+			return new(big.Int).Set(a)
+		}
+		return new(big.Int).Set(b)
+	}
+
+	// Legacy
+	if current.gasFeeCap == nil {
+		minGasPrice := bump(stuckTx.GasPrice())
+		gasPrice := max(minGasPrice, current.gasPrice)
+		if signerConfig.MaxGasPrice > 0 && gasPrice.Cmp(new(big.Int).SetUint64(signerConfig.MaxGasPrice)) > 0 {
+			gasPrice.SetUint64(signerConfig.MaxGasPrice)
+		}
+		if gasPrice.Cmp(minGasPrice) < 0 {
+			return txFees{}, fmt.Errorf("replacement gas price reached max_gas_price %d", signerConfig.MaxGasPrice)
+		}
+		if feeCeiling > 0 && minGasPrice.Cmp(new(big.Int).SetUint64(feeCeiling)) > 0 {
+			return txFees{}, fmt.Errorf("replacement gas price reached fee_ceiling %d", feeCeiling)
+		}
+		if feeCeiling > 0 && gasPrice.Cmp(new(big.Int).SetUint64(feeCeiling)) > 0 {
+			gasPrice.SetUint64(feeCeiling)
+		}
+		return txFees{gasPrice: gasPrice}, nil
+	}
+
+	// EIP-1559, both tip and fee cap must be bumped
+	minGasTipCap := bump(stuckTx.GasTipCap())
+	minGasFeeCap := bump(stuckTx.GasFeeCap())
+	gasTipCap := max(minGasTipCap, current.gasTipCap)
+	gasFeeCap := max(minGasFeeCap, current.gasFeeCap)
+	if signerConfig.MaxFee > 0 && gasFeeCap.Cmp(new(big.Int).SetUint64(signerConfig.MaxFee)) > 0 {
+		gasFeeCap.SetUint64(signerConfig.MaxFee)
+	}
+	if gasTipCap.Cmp(gasFeeCap) > 0 {
+		gasTipCap.Set(gasFeeCap)
+	}
+	if gasFeeCap.Cmp(minGasFeeCap) < 0 || gasTipCap.Cmp(minGasTipCap) < 0 {
+		return txFees{}, fmt.Errorf("replacement fee reached max_fee %d", signerConfig.MaxFee)
+	}
+	if feeCeiling > 0 && minGasFeeCap.Cmp(new(big.Int).SetUint64(feeCeiling)) > 0 {
+		return txFees{}, fmt.Errorf("replacement fee reached fee_ceiling %d", feeCeiling)
+	}
+	if feeCeiling > 0 && gasFeeCap.Cmp(new(big.Int).SetUint64(feeCeiling)) > 0 {
+		gasFeeCap.SetUint64(feeCeiling)
+		if gasTipCap.Cmp(gasFeeCap) > 0 {
+			gasTipCap.Set(gasFeeCap)
+		}
+	}
+	return txFees{gasTipCap: gasTipCap, gasFeeCap: gasFeeCap}, nil
+}
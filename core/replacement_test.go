@@ -0,0 +1,55 @@
+package core
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"erc20-permit-relayer/common"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestBumpFees(t *testing.T) {
+	s := &Signer{chain: &common.ChainConfig{Signer: common.SignerConfig{FeeBumpPercent: 10}}}
+	legacyTx := types.NewTx(&types.LegacyTx{GasPrice: big.NewInt(100)})
+	dynamicTx := types.NewTx(&types.DynamicFeeTx{GasTipCap: big.NewInt(10), GasFeeCap: big.NewInt(200)})
+
+	cases := []struct {
+		stuckTx   *types.Transaction
+		current   txFees
+		maxFee    uint64
+		gasPrice  int64
+		gasTipCap int64
+		gasFeeCap int64
+		err       string
+	}{
+		{legacyTx, txFees{gasPrice: big.NewInt(50)}, 0, 110, 0, 0, ""},                                         // percentage bump
+		{legacyTx, txFees{gasPrice: big.NewInt(150)}, 0, 150, 0, 0, ""},                                        // current fees higher
+		{legacyTx, txFees{gasPrice: big.NewInt(50)}, 105, 0, 0, 0, "max_gas_price 105"},                        // bump over the cap
+		{dynamicTx, txFees{gasTipCap: big.NewInt(5), gasFeeCap: big.NewInt(100)}, 0, 0, 11, 220, ""},           // percentage bump
+		{dynamicTx, txFees{gasTipCap: big.NewInt(20), gasFeeCap: big.NewInt(300)}, 0, 0, 20, 300, ""},          // current fees higher
+		{dynamicTx, txFees{gasTipCap: big.NewInt(20), gasFeeCap: big.NewInt(300)}, 250, 0, 20, 250, ""},        // capped above the bump
+		{dynamicTx, txFees{gasTipCap: big.NewInt(5), gasFeeCap: big.NewInt(100)}, 210, 0, 0, 0, "max_fee 210"}, // bump over the cap
+	}
+	for i, c := range cases {
+		s.chain.Signer.MaxGasPrice, s.chain.Signer.MaxFee = c.maxFee, c.maxFee
+		fees, err := s.bumpFees(c.stuckTx, c.current, 0)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("bumpFees case %d returned error %v, expected %s", i, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("bumpFees case %d returned error: %v", i, err)
+			continue
+		}
+		if c.gasPrice > 0 && fees.gasPrice.Int64() != c.gasPrice {
+			t.Errorf("bumpFees case %d returned gas price %v, expected %d", i, fees.gasPrice, c.gasPrice)
+		}
+		if c.gasFeeCap > 0 && (fees.gasTipCap.Int64() != c.gasTipCap || fees.gasFeeCap.Int64() != c.gasFeeCap) {
+			t.Errorf("bumpFees case %d returned fees %v/%v, expected %d/%d", i, fees.gasTipCap, fees.gasFeeCap, c.gasTipCap, c.gasFeeCap)
+		}
+	}
+}
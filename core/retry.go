@@ -0,0 +1,231 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"erc20-permit-relayer/common"
+	"erc20-permit-relayer/store"
+
+	"github.com/ethereum/go-ethereum"
+	geth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Retry of failed transactions, still valid permits are requeued and signed again with a new tx nonce
+
+func (s *Signer) retryWorker() {
+	defer s.wg.Done()
+
+	ctx := context.Background()
+
+	// Wait for startup ready
+	time.Sleep(3000 * time.Millisecond)
+
+	for !s.isClosed {
+		_, err := s.retryFailedTransactions(ctx)
+		if err != nil {
+			s.log.Error("Failed to retryFailedTransactions", "msg", err)
+		}
+
+		time.Sleep(s.chain.Signer.RetryInterval * time.Millisecond)
+	}
+}
+
+// retryFailedTransactions checks the failed txs due to retry, requeues valid ones and rejects invalid ones
+func (s *Signer) retryFailedTransactions(ctx context.Context) (int, error) {
+	txs, err := s.txStore.GetRetryTxFail(s.chain.Signer.SenderBulkSize)
+	if err != nil {
+		return 0, err
+	}
+
+	requeued := 0
+	for _, tx := range txs {
+		account, reason, permanent, err := s.checkRetry(ctx, tx)
+		if err != nil {
+			// Check the other permits, this one is checked again after the backoff
+			s.log.Error("Failed to check failed permit", "permit", tx.PermitHash, "msg", err)
+			err = s.txStore.UpdateTxFailRetry(tx.PermitHash, tx.FailReason)
+			if err != nil {
+				return requeued, err
+			}
+			continue
+		}
+
+		// Attempts exhausted
+		if !permanent && tx.RetryCount >= s.chain.Signer.RetryMaxAttempts {
+			if reason == "" {
+				reason = tx.FailReason
+			}
+			reason = fmt.Sprintf("max retry attempts reached, %s", reason)
+			permanent = true
+		}
+
+		switch {
+		case permanent:
+			err = s.txStore.UpdateTxFailTerminal(tx.PermitHash, reason)
+			if err != nil {
+				return requeued, err
+			}
+			s.log.Warn("Reject failed permit", "permit", tx.PermitHash, "attempts", tx.RetryCount, "reason", reason)
+
+		case reason != "":
+			err = s.txStore.UpdateTxFailRetry(tx.PermitHash, reason)
+			if err != nil {
+				return requeued, err
+			}
+			s.log.Info("Failed permit not valid yet, retry later", "permit", tx.PermitHash, "attempts", tx.RetryCount, "reason", reason)
+
+		default:
+			err = s.txStore.UpdateTxFailToPending(tx.PermitHash, account.storeAddress())
+			if err != nil {
+				return requeued, err
+			}
+			s.log.Info("Requeue failed permit", "permit", tx.PermitHash, "account", account.address, "attempts", tx.RetryCount+1)
+			requeued++
+		}
+	}
+
+	return requeued, nil
+}
+
+// checkRetry re-checks deadline, permit nonce and balance of the failed permit on-chain,
+// returns the account to send it or the reason it is invalid, permanent when it can never be sent
+func (s *Signer) checkRetry(ctx context.Context, tx store.Tx) (*signerAccount, string, bool, error) {
+	token, ok := s.chain.GetToken(geth_common.HexToAddress(tx.Token))
+	if !ok {
+		return nil, fmt.Sprintf("unsupported token %s", tx.Token), true, nil
+	}
+	values, err := common.DecodePermit(token, tx.Permit)
+	if err != nil {
+		return nil, fmt.Sprintf("invalid permit, %v", err), true, nil
+	}
+
+	// Check deadline
+	if values.Deadline != nil && values.Deadline.Cmp(big.NewInt(time.Now().Unix())) <= 0 {
+		return nil, "deadline expired", true, nil
+	}
+
+	// Check permit nonce
+	owner := geth_common.BytesToHash(values.Owner.Bytes())
+	switch token.Mode {
+	case common.TokenModePermit2:
+		wordPos, bitPos := common.Permit2NonceBitmapPosition(values.Nonce)
+		bitmap, err := s.callUint256(ctx, token.Permit2, "0x4fe02b44", owner, geth_common.BigToHash(wordPos)) // Permit2.nonceBitmap(address,uint256)
+		if err != nil {
+			return nil, "", false, err
+		}
+		if bitmap.Bit(int(bitPos)) != 0 {
+			return nil, "permit2 nonce already used", true, nil
+		}
+
+		allowance, err := s.callUint256(ctx, token.Address, "0xdd62ed3e", owner, geth_common.BytesToHash(token.Permit2.Bytes())) // ERC20.allowance(address,address)
+		if err != nil {
+			return nil, "", false, err
+		}
+		if allowance.Cmp(values.Value) < 0 {
+			return nil, fmt.Sprintf("insufficient allowance to permit2 %s", token.Permit2.Hex()), false, nil
+		}
+
+	case common.TokenModeEIP3009:
+		state, err := s.callUint256(ctx, token.Address, "0xe94a0102", owner, geth_common.BigToHash(values.Nonce)) // EIP3009.authorizationState(address,bytes32)
+		if err != nil {
+			return nil, "", false, err
+		}
+		if state.Sign() != 0 {
+			return nil, "authorization nonce already used", true, nil
+		}
+
+	default:
+		if !hasPermitNonces(token) {
+			break
+		}
+		nonce, err := s.callUint256(ctx, token.Address, "0x7ecebe00", owner) // ERC20Permit.nonces(address)
+		if err != nil {
+			return nil, "", false, err
+		}
+		if nonce.Cmp(values.Nonce) > 0 {
+			// Permit mined by a previous attempt, only transferFrom is left
+			applied, err := s.permitApplied(ctx, token, values)
+			if err != nil {
+				return nil, "", false, err
+			}
+			if !applied {
+				return nil, "permit nonce already used", true, nil
+			}
+		}
+		// Permits of the owner with lower nonces are not sent yet
+		if nonce.Cmp(values.Nonce) < 0 {
+			return nil, "permit nonce not reached", false, nil
+		}
+	}
+
+	// Check balance
+	balance, err := s.callUint256(ctx, token.Address, "0x70a08231", owner) // ERC20.balanceOf(address)
+	if err != nil {
+		return nil, "", false, err
+	}
+	if balance.Cmp(values.Value) < 0 {
+		return nil, "insufficient balance", false, nil
+	}
+
+	account, err := s.assignAccount(token, values)
+	if err != nil {
+		return nil, err.Error(), true, nil
+	}
+	return account, "", false, nil
+}
+
+// hasPermitNonces checks the token has ERC20Permit.nonces(address) checked before sending,
+// custom permits and forwarder calls have no nonce to check against the relayer state
+func hasPermitNonces(token *common.TokenConfig) bool {
+	switch token.Mode {
+	case common.TokenModeTransferWithPermit:
+		return true
+	case common.TokenModeEIP2612:
+		return token.Forwarder == common.Address0x0
+	}
+	return false
+}
+
+// permitApplied checks the EIP-2612 permit nonce is used and the allowance to the spender covers the transfer
+func (s *Signer) permitApplied(ctx context.Context, token *common.TokenConfig, values common.PermitType) (bool, error) {
+	if token.Mode != common.TokenModeEIP2612 || token.Forwarder != common.Address0x0 {
+		return false, nil
+	}
+	owner := geth_common.BytesToHash(values.Owner.Bytes())
+	nonce, err := s.callUint256(ctx, token.Address, "0x7ecebe00", owner) // ERC20Permit.nonces(address)
+	if err != nil {
+		return false, err
+	}
+	if nonce.Cmp(values.Nonce) <= 0 {
+		return false, nil
+	}
+	allowance, err := s.callUint256(ctx, token.Address, "0xdd62ed3e", owner, geth_common.BytesToHash(values.Spender.Bytes())) // ERC20.allowance(address,address)
+	if err != nil {
+		return false, err
+	}
+	return allowance.Cmp(values.Value) >= 0, nil
+}
+
+// callUint256 calls a view function with static arguments at the latest block and returns uint256 result
+func (s *Signer) callUint256(ctx context.Context, to geth_common.Address, selector string, args ...geth_common.Hash) (*big.Int, error) {
+	data, err := hexutil.Decode(selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, arg := range args {
+		data = append(data, arg.Bytes()...)
+	}
+
+	result, err := s.client.CallContract(ctx, ethereum.CallMsg{To: &to, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) < 32 {
+		return nil, fmt.Errorf("invalid uint256 result %s of %s", hexutil.Encode(result), to.Hex())
+	}
+	return new(big.Int).SetBytes(result[:32]), nil
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"erc20-permit-relayer/common"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Revert reasons of failed transactions
+
+var panicSelector = []byte{0x4e, 0x48, 0x7b, 0x71} // Panic(uint256)
+
+// loadErrorABIs returns the ABIs to decode custom errors, token ABIs first
+func loadErrorABIs(chain *common.ChainConfig) []abi.ABI {
+	var errorABIs []abi.ABI
+	for _, token := range chain.Tokens {
+		tokenABI, err := loadTokenABI(token)
+		if err == nil {
+			errorABIs = append(errorABIs, tokenABI)
+		}
+	}
+	for _, abiJSON := range []string{common.ERC20PermitForwarderABI, common.Permit2ABI, common.CommonErrorsABI} {
+		contractABI, err := abi.JSON(strings.NewReader(abiJSON))
+		if err == nil {
+			errorABIs = append(errorABIs, contractABI)
+		}
+	}
+	return errorABIs
+}
+
+// revertReason replays the failed tx with eth_call before its block and decodes the revert data
+func (k *Keeper) revertReason(ctx context.Context, tx *types.Transaction, receipt *types.Receipt) string {
+	from, err := types.Sender(types.LatestSignerForChainID(big.NewInt(k.chain.NetworkId)), tx)
+	if err != nil {
+		return "transaction reverted"
+	}
+
+	msg := ethereum.CallMsg{
+		From:  from,
+		To:    tx.To(),
+		Gas:   tx.Gas(),
+		Value: tx.Value(),
+		Data:  tx.Data(),
+	}
+	// State before the block, the state at its block already includes the tx
+	parentBlock := new(big.Int).Sub(receipt.BlockNumber, big.NewInt(1))
+	_, err = k.client.CallContract(ctx, msg, parentBlock)
+	if err == nil {
+		// Not reverted by the state before its block
+		if receipt.GasUsed >= tx.Gas() {
+			return "out of gas"
+		}
+		return "transaction reverted"
+	}
+
+	if reason, ok := revertError(err, k.errorABIs); ok {
+		return reason
+	}
+
+	k.log.Warn("Failed to replay failed transaction", "hash", tx.Hash(), "msg", err)
+	return "transaction reverted"
+}
+
+// revertError returns the decoded reason of an eth_call error, false if the call did not revert
+func revertError(err error, errorABIs []abi.ABI) (string, bool) {
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) {
+		if data, ok := dataErr.ErrorData().(string); ok {
+			revertData, err := hexutil.Decode(data)
+			if err == nil {
+				return decodeRevert(revertData, errorABIs), true
+			}
+		}
+	}
+	if strings.Contains(err.Error(), "revert") {
+		return err.Error(), true
+	}
+	return "", false
+}
+
+// decodeRevert returns the reason of Error(string), Panic(uint256) or a custom error of the ABIs
+func decodeRevert(data []byte, errorABIs []abi.ABI) string {
+	if len(data) == 0 {
+		return "execution reverted"
+	}
+
+	reason, err := abi.UnpackRevert(data)
+	if err == nil {
+		if bytes.Equal(data[:4], panicSelector) {
+			return "panic: " + reason
+		}
+		return reason
+	}
+
+	if len(data) >= 4 {
+		for _, contractABI := range errorABIs {
+			for _, abiError := range contractABI.Errors {
+				if !bytes.Equal(abiError.ID[:4], data[:4]) {
+					continue
+				}
+				values, err := abiError.Inputs.Unpack(data[4:])
+				if err != nil {
+					continue
+				}
+				args := make([]string, len(values))
+				for i, value := range values {
+					args[i] = fmt.Sprint(value)
+				}
+				return fmt.Sprintf("%s(%s)", abiError.Name, strings.Join(args, ", "))
+			}
+		}
+	}
+
+	return "unknown error " + hexutil.Encode(data)
+}
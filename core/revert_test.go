@@ -0,0 +1,55 @@
+package core
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"erc20-permit-relayer/common"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	geth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestDecodeRevert(t *testing.T) {
+	errorsABI, err := abi.JSON(strings.NewReader(common.CommonErrorsABI))
+	if err != nil {
+		t.Fatalf("Parse abi returned error: %v", err)
+	}
+	errorABIs := []abi.ABI{errorsABI}
+
+	stringType, _ := abi.NewType("string", "", nil)
+	uint256Type, _ := abi.NewType("uint256", "", nil)
+
+	// Error(string)
+	args, _ := abi.Arguments{{Type: stringType}}.Pack("ERC20Permit: expired deadline")
+	data := append(crypto.Keccak256([]byte("Error(string)"))[:4], args...)
+	if reason := decodeRevert(data, errorABIs); reason != "ERC20Permit: expired deadline" {
+		t.Errorf("decodeRevert returned wrong Error reason: %s", reason)
+	}
+
+	// Panic(uint256)
+	args, _ = abi.Arguments{{Type: uint256Type}}.Pack(big.NewInt(0x11))
+	data = append(crypto.Keccak256([]byte("Panic(uint256)"))[:4], args...)
+	if reason := decodeRevert(data, errorABIs); reason != "panic: arithmetic underflow or overflow" {
+		t.Errorf("decodeRevert returned wrong Panic reason: %s", reason)
+	}
+
+	// Custom error
+	owner := geth_common.HexToAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266")
+	abiError := errorsABI.Errors["InvalidAccountNonce"]
+	args, _ = abiError.Inputs.Pack(owner, big.NewInt(3))
+	data = append(abiError.ID[:4], args...)
+	if reason := decodeRevert(data, errorABIs); reason != "InvalidAccountNonce(0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266, 3)" {
+		t.Errorf("decodeRevert returned wrong custom error reason: %s", reason)
+	}
+
+	// Unknown error
+	if reason := decodeRevert([]byte{0x01, 0x02, 0x03, 0x04}, errorABIs); reason != "unknown error 0x01020304" {
+		t.Errorf("decodeRevert returned wrong unknown reason: %s", reason)
+	}
+	if reason := decodeRevert(nil, errorABIs); reason != "execution reverted" {
+		t.Errorf("decodeRevert returned wrong empty reason: %s", reason)
+	}
+}
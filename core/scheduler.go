@@ -0,0 +1,50 @@
+package core
+
+import (
+	"math/big"
+	"time"
+
+	"erc20-permit-relayer/common"
+	"erc20-permit-relayer/store"
+)
+
+// Scheduling of the pending queue, the order itself is the schedule query of the store
+
+// permitPriority returns the priority class of the permit, the higher of its API key and the fee it pays
+func (p *ProcessRequest) permitPriority(token *common.TokenConfig, values common.PermitType, apiKey string) int64 {
+	priority := p.config.ApiKeyPriority(apiKey)
+	if feePriority := feePriorityClass(token, values); feePriority > priority {
+		priority = feePriority
+	}
+	return priority
+}
+
+// feePriorityClass returns the number of fee thresholds of the token the fee field of the permit reaches
+func feePriorityClass(token *common.TokenConfig, values common.PermitType) int64 {
+	fee, ok := values.Fields["fee"].(*big.Int)
+	if !ok {
+		return 0
+	}
+	priority := int64(0)
+	for _, threshold := range token.FeePriority {
+		if fee.Cmp(threshold) < 0 {
+			break
+		}
+		priority++
+	}
+	return priority
+}
+
+// expectedSendTime estimates the send time of the permit at the queue position, sender_bulk_size permits signed per
+// sender_interval besides the signed ones rebroadcast, false while the fee policy holds it at the network fee
+func (s *Signer) expectedSendTime(tx store.Tx, position int64, fees txFees, now time.Time) (time.Time, bool) {
+	if s.feeDecision(tx, fees, now) == feeDefer {
+		return time.Time{}, false
+	}
+	bulkSize := int64(s.chain.Signer.SenderBulkSize)
+	if bulkSize <= 0 {
+		bulkSize = 1000
+	}
+	rounds := (position + bulkSize - 1) / bulkSize
+	return now.Add(time.Duration(rounds) * s.chain.Signer.SenderInterval * time.Millisecond), true
+}
@@ -0,0 +1,45 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"erc20-permit-relayer/common"
+	"erc20-permit-relayer/store"
+)
+
+func TestScheduler(t *testing.T) {
+	token := &common.TokenConfig{FeePriority: []*big.Int{big.NewInt(1000), big.NewInt(10000)}}
+	cases := map[int64]int64{999: 0, 1000: 1, 9999: 1, 10000: 2}
+	for fee, priority := range cases {
+		values := common.PermitType{Fields: map[string]interface{}{"fee": big.NewInt(fee)}}
+		if result := feePriorityClass(token, values); result != priority {
+			t.Errorf("feePriorityClass returned %d for fee %d, expected %d", result, fee, priority)
+		}
+	}
+	if result := feePriorityClass(token, common.PermitType{}); result != 0 {
+		t.Errorf("feePriorityClass returned %d without fee field", result)
+	}
+
+	s := &Signer{chain: &common.ChainConfig{Signer: common.SignerConfig{SenderInterval: 60000, SenderBulkSize: 50, FeeCeiling: 100, FeeUrgentWindow: 600000}}}
+	now := time.Unix(1700000000, 0)
+	tx := store.Tx{Deadline: big.NewInt(now.Unix() + 3600)}
+	fees := txFees{networkFee: big.NewInt(100)}
+	if eta, ok := s.expectedSendTime(tx, 50, fees, now); !ok || !eta.Equal(now.Add(time.Minute)) {
+		t.Errorf("expectedSendTime returned wrong time: %v", eta)
+	}
+	if eta, ok := s.expectedSendTime(tx, 51, fees, now); !ok || !eta.Equal(now.Add(2*time.Minute)) {
+		t.Errorf("expectedSendTime returned wrong time: %v", eta)
+	}
+
+	// Held above the fee ceiling
+	fees = txFees{networkFee: big.NewInt(101)}
+	if _, ok := s.expectedSendTime(tx, 1, fees, now); ok {
+		t.Errorf("expectedSendTime returned a time for a permit held by the fee policy")
+	}
+	tx.Deadline = big.NewInt(now.Unix() + 60)
+	if _, ok := s.expectedSendTime(tx, 1, fees, now); !ok {
+		t.Errorf("expectedSendTime returned no time for an urgent permit")
+	}
+}
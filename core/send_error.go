@@ -0,0 +1,163 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"erc20-permit-relayer/store"
+
+	"github.com/ethereum/go-ethereum"
+	geth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Classified errors of the node rejecting a sent transaction
+
+type sendErrorClass int
+
+const (
+	sendErrorUnknown           sendErrorClass = iota
+	sendErrorKnown                            // already in the mempool
+	sendErrorNonceTooLow                      // nonce mined, skip when the tx is mined or sign again
+	sendErrorUnderpriced                      // below the mempool price or the tx it replaces, bump fees
+	sendErrorInsufficientFunds                // gas balance too low, pause new permits and stop the round
+	sendErrorGasLimit                         // exceeds block gas limit, mark failed
+	sendErrorIntrinsicGas                     // intrinsic gas too low, mark failed
+)
+
+// Ends the send round of the account, the next round sends again
+var errSenderPaused = errors.New("sender paused, insufficient funds")
+
+// classifySendError matches the error messages of the geth tx pool, also returned by most other clients
+func classifySendError(err error) sendErrorClass {
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "already known") || strings.Contains(msg, "known transaction"):
+		return sendErrorKnown
+	case strings.Contains(msg, "nonce too low"):
+		return sendErrorNonceTooLow
+	case strings.Contains(msg, "underpriced"):
+		return sendErrorUnderpriced
+	case strings.Contains(msg, "insufficient funds"):
+		return sendErrorInsufficientFunds
+	case strings.Contains(msg, "exceeds block gas limit"):
+		return sendErrorGasLimit
+	case strings.Contains(msg, "intrinsic gas too low"):
+		return sendErrorIntrinsicGas
+	}
+	return sendErrorUnknown
+}
+
+// handleSendError takes the action of the error class for the tx of the pending permit, true if a replacement was sent.
+// Only insufficient funds stops the round with errSenderPaused, the balance monitor resumes new permits once topped up.
+func (s *Signer) handleSendError(ctx context.Context, account *signerAccount, tx store.Tx, signedTx *types.Transaction, sendErr error) (bool, error) {
+	switch classifySendError(sendErr) {
+	case sendErrorKnown:
+		account.log.Info("Skip transaction exist in mempool", "hash", signedTx.Hash())
+		return false, nil
+
+	case sendErrorNonceTooLow:
+		mined, err := s.transactionMined(ctx, tx)
+		if err != nil {
+			return false, err
+		}
+		if mined {
+			// The Keeper finalizes it
+			account.log.Info("Skip transaction with mined nonce", "hash", signedTx.Hash(), "nonce", signedTx.Nonce())
+			return false, nil
+		}
+
+		// Nonce used by another tx, the permits are signed again with a new nonce
+		err = s.resetPendingTransaction(tx.TxHash)
+		if err != nil {
+			return false, err
+		}
+		account.log.Warn("Tx nonce used by another transaction, sign the permit again", "hash", signedTx.Hash(), "nonce", signedTx.Nonce())
+		return false, nil
+
+	case sendErrorUnderpriced:
+		minedNonce, err := s.client.NonceAt(ctx, account.address, nil)
+		if err != nil {
+			return false, err
+		}
+		fees, err := s.suggestFees(ctx)
+		if err != nil {
+			return false, err
+		}
+		err = s.replaceTransaction(ctx, account, tx, minedNonce, fees)
+		if err != nil {
+			account.log.Warn("Failed to bump fees of underpriced transaction", "hash", signedTx.Hash(), "nonce", signedTx.Nonce(), "msg", err)
+			return false, nil
+		}
+		return true, nil
+
+	case sendErrorInsufficientFunds:
+		// Only the balance monitor resumes the account
+		if s.chain.Signer.BalanceCheckInterval > 0 && !account.paused.Swap(true) {
+			account.log.Error("⛽ Insufficient funds to send transaction, pause new permits", "hash", signedTx.Hash(), "msg", sendErr)
+		}
+		return false, errSenderPaused
+
+	case sendErrorGasLimit, sendErrorIntrinsicGas:
+		// Permits of the tx move to tx_fail and are signed again on retry, the nonce gap is filled by the nonce repair
+		err := s.failPendingTransaction(tx.TxHash, sendErr.Error())
+		if err != nil {
+			return false, err
+		}
+		account.log.Warn("😱 Transaction rejected by the node, mark failed", "hash", signedTx.Hash(), "nonce", signedTx.Nonce(), "reason", sendErr)
+		return false, nil
+	}
+
+	account.log.Error("Failed to send transaction", "hash", signedTx.Hash(), "nonce", signedTx.Nonce(), "msg", sendErr)
+	return false, nil
+}
+
+// transactionMined checks one of the broadcast hashes of the permit has a receipt
+func (s *Signer) transactionMined(ctx context.Context, tx store.Tx) (bool, error) {
+	hashes := tx.TxHashes
+	if tx.TxHash != "" {
+		hashes = append([]string{tx.TxHash}, hashes...)
+	}
+	for _, hash := range hashes {
+		_, err := s.client.TransactionReceipt(ctx, geth_common.HexToHash(hash))
+		if err == ethereum.NotFound {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// resetPendingTransaction returns the permits of the signed tx to the queue to sign again
+func (s *Signer) resetPendingTransaction(txHash string) error {
+	txs, err := s.txStore.GetBatchTxPending(txHash)
+	if err != nil {
+		return err
+	}
+	for _, tx := range txs {
+		err = s.txStore.ResetTxPendingSigned(tx.PermitHash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// failPendingTransaction moves the permits of the signed tx to tx_fail
+func (s *Signer) failPendingTransaction(txHash string, reason string) error {
+	txs, err := s.txStore.GetBatchTxPending(txHash)
+	if err != nil {
+		return err
+	}
+	for _, tx := range txs {
+		err = s.txStore.UpdatePermitPendingToFail(tx, txHash, reason, 0)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
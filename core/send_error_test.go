@@ -0,0 +1,77 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"erc20-permit-relayer/common"
+	"erc20-permit-relayer/store"
+
+	geth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/inconshreveable/log15"
+)
+
+func TestClassifySendError(t *testing.T) {
+	cases := map[string]sendErrorClass{
+		"already known": sendErrorKnown,
+		"nonce too low: next nonce 5, tx nonce 3":                               sendErrorNonceTooLow,
+		"replacement transaction underpriced":                                   sendErrorUnderpriced,
+		"transaction underpriced":                                               sendErrorUnderpriced,
+		"insufficient funds for gas * price + value: balance 0, tx cost 300000": sendErrorInsufficientFunds,
+		"exceeds block gas limit":                                               sendErrorGasLimit,
+		"intrinsic gas too low":                                                 sendErrorIntrinsicGas,
+		"connection refused":                                                    sendErrorUnknown,
+	}
+	for msg, class := range cases {
+		if result := classifySendError(errors.New(msg)); result != class {
+			t.Errorf("classifySendError returned %d for %q, expected %d", result, msg, class)
+		}
+	}
+}
+
+// ethStub serves eth_getTransactionReceipt of the mined hashes
+type ethStub struct {
+	mined map[geth_common.Hash]bool
+}
+
+func (e *ethStub) GetTransactionReceipt(hash geth_common.Hash) *types.Receipt {
+	if !e.mined[hash] {
+		return nil
+	}
+	return &types.Receipt{Status: types.ReceiptStatusSuccessful, TxHash: hash, BlockNumber: big.NewInt(1), Logs: []*types.Log{}}
+}
+
+func TestHandleSendError(t *testing.T) {
+	signedTx := testTransactions()[0]
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &ethStub{mined: map[geth_common.Hash]bool{signedTx.Hash(): true}}); err != nil {
+		t.Fatalf("RegisterName returned error: %v", err)
+	}
+	s := &Signer{chain: &common.ChainConfig{Signer: common.SignerConfig{BalanceCheckInterval: 60000}}, client: ethclient.NewClient(rpc.DialInProc(server))}
+	logger := log15.New()
+	logger.SetHandler(log15.DiscardHandler())
+	account := &signerAccount{log: logger}
+	tx := store.Tx{TxHash: signedTx.Hash().Hex()}
+
+	// Errors handled without a store action keep sending the rest of the batch
+	for _, msg := range []string{"already known", "nonce too low", "connection refused"} {
+		replaced, err := s.handleSendError(context.Background(), account, tx, signedTx, errors.New(msg))
+		if replaced || err != nil {
+			t.Errorf("handleSendError returned %v %v for %q, expected to continue", replaced, err, msg)
+		}
+	}
+	if account.paused.Load() {
+		t.Errorf("handleSendError paused the account")
+	}
+
+	// Insufficient funds ends the round and pauses new permits
+	_, err := s.handleSendError(context.Background(), account, tx, signedTx, errors.New("insufficient funds for gas * price + value"))
+	if err != errSenderPaused || !account.paused.Load() {
+		t.Errorf("handleSendError returned %v, expected errSenderPaused with the account paused", err)
+	}
+}
@@ -3,9 +3,7 @@ package core
 import (
 	"bytes"
 	"context"
-	"encoding/gob"
 	"fmt"
-	"math/big"
 	"os"
 	"strings"
 	"sync"
@@ -14,8 +12,8 @@ import (
 	"erc20-permit-relayer/common"
 	"erc20-permit-relayer/store"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
-	"github.com/ethereum/go-ethereum/accounts/keystore"
 	geth_common "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -25,73 +23,195 @@ import (
 
 type Signer struct {
 	config              *common.Config
+	chain               *common.ChainConfig
 	log                 log15.Logger
-	txStore             store.TxStore
+	txStore             *store.TxStore
 	client              *ethclient.Client
-	account             *keystore.Key
-	erc20PermitTokenABI abi.ABI
+	accounts            []*signerAccount
+	erc20PermitTokenABI map[geth_common.Address]abi.ABI
+	forwarderABI        abi.ABI
+	permit2ABI          abi.ABI
+	multicall3ABI       abi.ABI
+	errorABIs           []abi.ABI
 	wg                  *sync.WaitGroup
 	isClosed            bool
 	mutex               sync.Mutex
 }
 
-func NewSigner(config *common.Config, log *log15.Logger, txStore *store.TxStore, client *ethclient.Client, wg *sync.WaitGroup) *Signer {
-	var account *keystore.Key
-	if config.Signer.Enable {
-		// Load the keystore file
-		keystoreJSON, err := os.ReadFile(config.Signer.KeystoreFilePath)
-		if err != nil {
-			(*log).Error("Failed to read keystore file", "msg", err)
-		}
+func NewSigner(config *common.Config, chain *common.ChainConfig, log *log15.Logger, txStore *store.TxStore, client *ethclient.Client, wg *sync.WaitGroup) *Signer {
+	var accounts []*signerAccount
+	if chain.Signer.Enable {
+		accounts = loadSignerAccounts(chain.Signer, *log)
+	}
 
-		// Unlock the account
-		account, err = keystore.DecryptKey(keystoreJSON, config.Signer.Password)
+	// ABI of each token
+	erc20PermitTokenABI := make(map[geth_common.Address]abi.ABI)
+	for _, token := range chain.Tokens {
+		tokenABI, err := loadTokenABI(token)
 		if err != nil {
-			(*log).Error("Failed to unlock the account", "msg", err)
-		} else {
-			(*log).Info("Unlock account", "address", account.Address)
+			(*log).Error("Failed to parse json abi", "token", token.Address, "msg", err)
+			continue
 		}
+		if token.Mode == common.TokenModeCustom {
+			method, ok := tokenABI.Methods[token.CustomPermit.Function]
+			if !ok || len(method.Inputs) != len(token.CustomPermit.Arguments) {
+				(*log).Error("Custom permit function not match abi", "token", token.Address, "function", token.CustomPermit.Function)
+				continue
+			}
+		}
+		erc20PermitTokenABI[token.Address] = tokenABI
 	}
-
-	// ABI
-	erc20PermitTokenABI, err := abi.JSON(strings.NewReader(common.ERC20PermitTokenABI))
+	forwarderABI, err := abi.JSON(strings.NewReader(common.ERC20PermitForwarderABI))
+	if err != nil {
+		(*log).Error("Failed to parse json abi", "msg", err)
+	}
+	permit2ABI, err := abi.JSON(strings.NewReader(common.Permit2ABI))
+	if err != nil {
+		(*log).Error("Failed to parse json abi", "msg", err)
+	}
+	multicall3ABI, err := abi.JSON(strings.NewReader(common.Multicall3ABI))
 	if err != nil {
-		(*log).Info("Failed to parse json abi", "msg", err)
+		(*log).Error("Failed to parse json abi", "msg", err)
 	}
 
 	return &Signer{
 		config:              config,
+		chain:               chain,
 		log:                 *log,
-		txStore:             *txStore,
+		txStore:             txStore,
 		client:              client,
-		account:             account,
+		accounts:            accounts,
 		erc20PermitTokenABI: erc20PermitTokenABI,
+		forwarderABI:        forwarderABI,
+		permit2ABI:          permit2ABI,
+		multicall3ABI:       multicall3ABI,
+		errorABIs:           loadErrorABIs(chain),
 		wg:                  wg,
 		isClosed:            false,
 	}
 }
 
+func loadTokenABI(token common.TokenConfig) (abi.ABI, error) {
+	if token.AbiFilePath == "" {
+		switch token.Mode {
+		case common.TokenModeEIP2612:
+			return abi.JSON(strings.NewReader(common.ERC20EIP2612TokenABI))
+		case common.TokenModeEIP3009:
+			return abi.JSON(strings.NewReader(common.ERC20EIP3009TokenABI))
+		default:
+			return abi.JSON(strings.NewReader(common.ERC20PermitTokenABI))
+		}
+	}
+
+	abiJSON, err := os.ReadFile(token.AbiFilePath)
+	if err != nil {
+		return abi.ABI{}, err
+	}
+	return abi.JSON(bytes.NewReader(abiJSON))
+}
+
+// Accounts returns the relayer account addresses
+func (s *Signer) Accounts() []geth_common.Address {
+	addresses := make([]geth_common.Address, len(s.accounts))
+	for i, account := range s.accounts {
+		addresses[i] = account.address
+	}
+	return addresses
+}
+
+// Spender returns the EIP-2612 or Permit2 spender that permits of the owner must approve
+func (s *Signer) Spender(token *common.TokenConfig, owner geth_common.Address) geth_common.Address {
+	if token.Forwarder != common.Address0x0 {
+		return token.Forwarder
+	}
+	if len(s.accounts) == 0 {
+		return common.Address0x0
+	}
+	return s.ownerAccount(owner).address
+}
+
+// IsSpender checks the address is the forwarder or a relayer account the permits of the owner may approve,
+// owner nonces must stay on the account of the owner to be sent in order, Permit2 nonces are unordered
+func (s *Signer) IsSpender(token *common.TokenConfig, owner geth_common.Address, address geth_common.Address) bool {
+	if token.Forwarder != common.Address0x0 {
+		return address == token.Forwarder
+	}
+	if token.Mode != common.TokenModePermit2 {
+		return len(s.accounts) > 0 && address == s.ownerAccount(owner).address
+	}
+	_, ok := s.getAccount(address)
+	return ok
+}
+
 func (s *Signer) Sender() {
 	s.wg.Add(1)
 	defer s.wg.Done()
 
+	if len(s.accounts) == 0 {
+		s.log.Error("No signer account unlocked")
+		return
+	}
+
 	// Prepare defult config
-	err := s.txStore.PrepareSignerConfig(strings.ToLower(s.account.Address.Hex()))
+	for _, account := range s.accounts {
+		err := s.txStore.PrepareSignerConfig(account.storeAddress())
+		if err != nil {
+			s.log.Error("PrepareSignerConfig fail", "msg", err)
+			return
+		}
+	}
+
+	// Assign pending txs without account
+	err := s.assignPendingTransactions()
 	if err != nil {
-		s.log.Error("PrepareSignerConfig fail", "msg", err)
+		s.log.Error("Failed to assignPendingTransactions", "msg", err)
 		return
 	}
 
+	// Start one sender of each account nonce sequence
+	for _, account := range s.accounts {
+		s.wg.Add(1)
+		go s.accountSender(account)
+
+		// Gas balance monitor
+		if s.chain.Signer.BalanceCheckInterval > 0 {
+			s.wg.Add(1)
+			go s.balanceMonitor(account)
+		}
+	}
+
+	// Retry failed transactions
+	if s.chain.Signer.RetryInterval > 0 {
+		s.wg.Add(1)
+		go s.retryWorker()
+	}
+}
+
+func (s *Signer) accountSender(account *signerAccount) {
+	defer s.wg.Done()
+
 	ctx := context.Background()
 
 	// Wait for startup ready
 	time.Sleep(3000 * time.Millisecond)
 
 	for !s.isClosed {
+		// Repair nonce gaps and duplicates before sending
+		err := s.repairNonces(ctx, account)
+		if err != nil {
+			account.log.Error("Failed to repairNonces", "msg", err)
+		}
+
 		// Bulk send transactions
-		total, err := s.sendTransactions(ctx)
+		total, err := s.sendTransactions(ctx, account)
 		if err != nil {
-			s.log.Error("Failed to sendTransactions", "msg", err)
+			account.log.Error("Failed to sendTransactions", "msg", err)
+		}
+
+		// Replace stuck transactions with bumped fees
+		_, err = s.replaceStuckTransactions(ctx, account)
+		if err != nil {
+			account.log.Error("Failed to replaceStuckTransactions", "msg", err)
 		}
 
 		if total == 0 {
@@ -99,7 +219,7 @@ func (s *Signer) Sender() {
 			time.Sleep(3000 * time.Millisecond)
 		} else {
 			// Sleep
-			time.Sleep(s.config.Signer.SenderInterval * time.Millisecond)
+			time.Sleep(s.chain.Signer.SenderInterval * time.Millisecond)
 		}
 	}
 }
@@ -108,126 +228,429 @@ func (s *Signer) Close() {
 	s.isClosed = true
 }
 
-func (s *Signer) sendTransactions(ctx context.Context) (int, error) {
+func (s *Signer) sendTransactions(ctx context.Context, account *signerAccount) (int, error) {
 	// Ensure only one access
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	account.mutex.Lock()
+	defer account.mutex.Unlock()
 
 	start := mclock.Now()
 
 	// Get pending txs
-	txs, err := s.txStore.GetAllTxPending(s.config.Signer.SenderBulkSize)
+	txs, err := s.txStore.GetAllTxPending(account.storeAddress(), s.chain.Signer.SenderBulkSize)
 	if err != nil {
 		return 0, err
 	}
 
-	sendCount := 0
+	var (
+		sendCount  int
+		deferCount int
+		txNonce    uint64
+		fees       *txFees
+		cappedFees txFees
+		batch      []store.Tx
+		batchCalls []txCall
+		sent       = make(map[string]bool)
+		now        = time.Now()
+	)
+	// Permits of each signed tx, batch calls are not simulated again
+	batchPermits := make(map[string]int)
 	for _, tx := range txs {
-		var signedTx *types.Transaction
+		if tx.TxHash != "" {
+			batchPermits[tx.TxHash]++
+		}
+	}
+
+	for _, tx := range txs {
+		// Sign the permit with the next tx nonce and current fees
+		if tx.TxHash == "" {
+			if fees == nil {
+				txNonce, err = s.nextTxNonce(ctx, account)
+				if err != nil {
+					return 0, err
+				}
+				suggestedFees, err := s.suggestFees(ctx)
+				if err != nil {
+					return 0, err
+				}
+				fees = &suggestedFees
+				cappedFees = capFees(suggestedFees, s.chain.Signer.FeeCeiling)
+			}
+
+			// Hold the permit while the network fee is above the fee policy
+			decision := s.feeDecision(tx, *fees, now)
+			if decision == feeDefer {
+				err = s.txStore.UpdateTxPendingDeferred(tx.PermitHash)
+				if err != nil {
+					return 0, err
+				}
+				deferCount++
+				continue
+			}
+
+			// Reject the permit can not be encoded, the next one takes its tx nonce
+			calls, encodeErr := s.pendingCalls(tx)
+			if encodeErr != nil {
+				err = s.txStore.UpdateTxPendingToRejected(tx.PermitHash, fmt.Sprintf("invalid permit, %v", encodeErr))
+				if err != nil {
+					return 0, err
+				}
+				account.log.Error("Reject pending permit failed to encode", "permit", tx.PermitHash, "msg", encodeErr)
+				continue
+			}
+			calls, err = s.unappliedCalls(ctx, tx, calls)
+			if err != nil {
+				return 0, err
+			}
+
+			// Reject the permit reverting at the latest state instead of paying gas for it
+			reason, err := s.simulatePendingTransaction(ctx, account, tx, calls)
+			if err != nil {
+				return 0, err
+			}
+			if reason != "" {
+				err = s.txStore.UpdateTxPendingToRejected(tx.PermitHash, reason)
+				if err != nil {
+					return 0, err
+				}
+				account.log.Warn("Reject pending permit reverting in simulation", "permit", tx.PermitHash, "reason", reason)
+				continue
+			}
 
-		// Decode []byte to Transaction
-		decoder := gob.NewDecoder(bytes.NewBuffer(tx.TxSigned))
-		err := decoder.Decode(&signedTx)
+			// Close to the deadline, pay above the ceiling within the emergency budget
+			if decision == feeEmergency {
+				cost := s.emergencyCost(*fees, len(calls))
+				spent, err := s.spendEmergencyBudget(tx.PermitHash, cost)
+				if err != nil {
+					return 0, err
+				}
+				if !spent {
+					err = s.txStore.UpdateTxPendingDeferred(tx.PermitHash)
+					if err != nil {
+						return 0, err
+					}
+					deferCount++
+					account.log.Warn("Emergency fee budget exhausted, hold permit close to its deadline", "permit", tx.PermitHash, "deadline", tx.Deadline, "networkFee", fees.networkFee)
+					continue
+				}
+				tx, err = s.signPendingTransaction(ctx, account, tx, calls, txNonce, *fees)
+				if err != nil {
+					return 0, err
+				}
+				account.log.Warn("🚨 Sign permit close to its deadline above the fee ceiling", "permit", tx.PermitHash, "deadline", tx.Deadline, "networkFee", fees.networkFee, "cost", cost)
+			} else if s.batchable(tx, calls) {
+				// Collect permits of one batch executor call
+				batch = append(batch, tx)
+				batchCalls = append(batchCalls, calls[0])
+				if len(batch) < s.chain.Signer.BatchSize {
+					continue
+				}
+				tx, err = s.signBatchTransaction(ctx, account, batch, batchCalls, txNonce, cappedFees)
+				if err != nil {
+					return 0, err
+				}
+				batch, batchCalls = nil, nil
+			} else {
+				tx, err = s.signPendingTransaction(ctx, account, tx, calls, txNonce, cappedFees)
+				if err != nil {
+					return 0, err
+				}
+			}
+			txNonce = tx.TxNonce + 1
+		} else if batchPermits[tx.TxHash] == 1 && !sent[tx.TxHash] {
+			// Simulate the signed tx again before broadcasting it when dropped from the mempool
+			rejected, err := s.resimulateSignedTransaction(ctx, account, tx)
+			if err != nil {
+				return 0, err
+			}
+			if rejected {
+				continue
+			}
+		}
+
+		// Permits of one batch share the transaction
+		if sent[tx.TxHash] {
+			continue
+		}
+		sent[tx.TxHash] = true
+
+		ok, err := s.sendPendingTransaction(ctx, account, tx)
+		if err == errSenderPaused {
+			return len(txs), nil
+		}
 		if err != nil {
 			return 0, err
 		}
+		if ok {
+			sendCount++
+		}
+	}
 
-		// Send the transaction
-		err = s.client.SendTransaction(ctx, signedTx)
+	// Last batch not full
+	if len(batch) > 0 {
+		tx, err := s.signBatchTransaction(ctx, account, batch, batchCalls, txNonce, cappedFees)
 		if err != nil {
-			if err.Error() == "already known" {
-				// tx exist in mempool
-				s.log.Info("Skip transaction exist in mempool", "hash", signedTx.Hash())
-				continue
-			}
 			return 0, err
 		}
-
-		s.log.Info("🔑 Submitted transaction", "  hash", signedTx.Hash())
-		sendCount++
+		ok, err := s.sendPendingTransaction(ctx, account, tx)
+		if err == errSenderPaused {
+			return len(txs), nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			sendCount++
+		}
 	}
 
 	// Log
+	if deferCount > 0 {
+		account.log.Warn("⏸️ Hold permits while the network fee is above the fee policy", "count", deferCount, "networkFee", fees.networkFee)
+	}
 	if sendCount > 1 {
-		s.log.Info("📦 Sent batch of transactions", "  count", sendCount, "elapsed", geth_common.PrettyDuration(mclock.Now().Sub(start)))
+		account.log.Info("📦 Sent batch of transactions", "  count", sendCount, "elapsed", geth_common.PrettyDuration(mclock.Now().Sub(start)))
 	}
 
 	return len(txs), nil
 }
 
-func (s *Signer) AddPendingTransaction(values common.PermitType, signature []byte) (geth_common.Hash, error) {
-	// Ensure only one access
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+// resimulateSignedTransaction rejects the signed permit not known by the node anymore that would revert at the latest state,
+// its tx nonce is released to the nonce repair
+func (s *Signer) resimulateSignedTransaction(ctx context.Context, account *signerAccount, tx store.Tx) (bool, error) {
+	_, _, err := s.client.TransactionByHash(ctx, geth_common.HexToHash(tx.TxHash))
+	if err == nil {
+		return false, nil
+	}
+	if err != ethereum.NotFound {
+		return false, err
+	}
 
-	ctx := context.Background()
+	calls, err := s.pendingCalls(tx)
+	if err != nil {
+		return false, nil
+	}
+	reason, err := s.simulatePendingTransaction(ctx, account, tx, calls)
+	if err != nil || reason == "" {
+		return false, err
+	}
 
+	err = s.txStore.UpdateTxPendingToRejected(tx.PermitHash, reason)
+	if err != nil {
+		return false, err
+	}
+	account.log.Warn("Reject signed permit reverting in simulation before rebroadcast", "permit", tx.PermitHash, "hash", tx.TxHash, "nonce", tx.TxNonce, "reason", reason)
+	return true, nil
+}
+
+// sendPendingTransaction sends the signed txs of a pending permit, false if not sent, send errors are handled by their class
+func (s *Signer) sendPendingTransaction(ctx context.Context, account *signerAccount, tx store.Tx) (bool, error) {
+	// Send the permit or wallet deploy transaction first
+	if len(tx.TxPermitSigned) > 0 {
+		permitTx, err := decodeTransaction(tx.TxPermitSigned)
+		if err != nil {
+			return false, err
+		}
+
+		err = s.client.SendTransaction(ctx, permitTx)
+		if err != nil {
+			// tx exist in mempool or mined
+			class := classifySendError(err)
+			if class != sendErrorKnown && class != sendErrorNonceTooLow {
+				return s.handleSendError(ctx, account, tx, permitTx, err)
+			}
+		} else {
+			account.log.Info("🔑 Submitted permit transaction", "  hash", permitTx.Hash())
+		}
+	}
+
+	// Decode []byte to Transaction
+	signedTx, err := decodeTransaction(tx.TxSigned)
+	if err != nil {
+		return false, err
+	}
+
+	// Send the transaction
+	err = s.client.SendTransaction(ctx, signedTx)
+	if err != nil {
+		return s.handleSendError(ctx, account, tx, signedTx, err)
+	}
+
+	account.log.Info("🔑 Submitted transaction", "  hash", signedTx.Hash())
+	return true, nil
+}
+
+// nextTxNonce returns the highest next nonce of the account from pending txs and signer_config
+func (s *Signer) nextTxNonce(ctx context.Context, account *signerAccount) (uint64, error) {
 	// Get next nonce from pending txs
-	txNonce, err := s.client.PendingNonceAt(ctx, s.account.Address)
+	txNonce, err := s.client.PendingNonceAt(ctx, account.address)
 	if err != nil {
-		return geth_common.Hash{}, err
+		return 0, err
 	}
 	// Get next nonce from signer_config
-	localTxNonce, err := s.txStore.GetSignerTxNonce(strings.ToLower(s.account.Address.Hex()))
+	localTxNonce, err := s.txStore.GetSignerTxNonce(account.storeAddress())
 	if err != nil {
-		return geth_common.Hash{}, err
+		return 0, err
 	}
 	// Use highest nonce
 	if localTxNonce > txNonce {
 		txNonce = localTxNonce
 	}
+	return txNonce, nil
+}
 
-	// Split signature
-	var _r [32]byte
-	var _s [32]byte
-	var _v uint8
-	copy(_r[:], signature[:32])
-	copy(_s[:], signature[32:64])
-	_v = uint8(signature[64] + 27)
+// pendingCalls encodes the contract calls of a pending permit
+func (s *Signer) pendingCalls(tx store.Tx) ([]txCall, error) {
+	token, ok := s.chain.GetToken(geth_common.HexToAddress(tx.Token))
+	if !ok {
+		return nil, fmt.Errorf("unsupported token %s", tx.Token)
+	}
+	values, err := common.DecodePermit(token, tx.Permit)
+	if err != nil {
+		return nil, err
+	}
 
-	// ABI encode function call
-	data, err := s.erc20PermitTokenABI.Pack("transferWithPermit", values.Owner, values.Receiver, values.Value, values.Deadline, _v, _r, _s)
+	// ABI encode function calls
+	return s.packCalls(token, values, tx.Signature)
+}
+
+// unappliedCalls drops the permit call of a requeued permit mined by a previous attempt with its transfer failed
+func (s *Signer) unappliedCalls(ctx context.Context, tx store.Tx, calls []txCall) ([]txCall, error) {
+	if tx.RetryCount == 0 || len(calls) < 2 {
+		return calls, nil
+	}
+	token, ok := s.chain.GetToken(geth_common.HexToAddress(tx.Token))
+	if !ok {
+		return calls, nil
+	}
+	values, err := common.DecodePermit(token, tx.Permit)
 	if err != nil {
-		return geth_common.Hash{}, err
+		return calls, nil
 	}
+	applied, err := s.permitApplied(ctx, token, values)
+	if err != nil {
+		return nil, err
+	}
+	if applied {
+		return calls[1:], nil
+	}
+	return calls, nil
+}
+
+// signPendingTransaction signs the calls of a pending permit from txNonce and records them before sending
+func (s *Signer) signPendingTransaction(ctx context.Context, account *signerAccount, tx store.Tx, calls []txCall, txNonce uint64, fees txFees) (store.Tx, error) {
+	var err error
+
+	// Sign the transactions with sequential nonces, the last one is the transfer
+	signedTxs := make([][]byte, len(calls))
+	var signedTx *types.Transaction
+	var gasEstimate uint64
+	for i, call := range calls {
+		// Calls after the first one depend on it, the gas limit when they can not be estimated before it is mined
+		call.gas, gasEstimate = s.estimateGas(ctx, account, call, i > 0)
 
-	// Make Tx
-	tx := types.NewTransaction(txNonce, geth_common.HexToAddress(s.config.ERC20PermitTokenAddress.Hex()), nil, s.config.Signer.GasLimit, big.NewInt(int64(s.config.Signer.GasPrice)), data)
+		// Make Tx
+		_tx := s.newTransaction(txNonce+uint64(i), call, fees)
 
-	// Sign the transaction
-	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(big.NewInt(s.config.NetworkId)), s.account.PrivateKey)
+		// Sign the transaction
+		signedTx, err = account.backend.SignTx(ctx, _tx, s.txSigner())
+		if err != nil {
+			return tx, err
+		}
+
+		// Encode the signedTx to []byte
+		signedTxs[i], err = encodeTransaction(signedTx)
+		if err != nil {
+			return tx, err
+		}
+	}
+	tx.TxHash = signedTx.Hash().Hex()
+	tx.TxSigned = signedTxs[len(signedTxs)-1]
+	tx.TxPermitSigned = nil
+	if len(signedTxs) > 1 {
+		tx.TxPermitSigned = signedTxs[0]
+	}
+	tx.TxNonce = signedTx.Nonce()
+	tx.GasEstimate = gasEstimate
+
+	// Update next nonce first, a failed record leaves a nonce gap instead of a reused nonce
+	err = s.txStore.UpdateSignerTxNonce(account.storeAddress(), tx.TxNonce+1)
 	if err != nil {
-		return geth_common.Hash{}, err
+		return tx, err
 	}
 
-	// Encode the signedTx to []byte
-	var buffer bytes.Buffer
-	encoder := gob.NewEncoder(&buffer)
-	err = encoder.Encode(signedTx)
+	// Record signed txs
+	err = s.txStore.UpdateTxPendingSigned(tx.PermitHash, tx.TxHash, tx.TxSigned, tx.TxPermitSigned, tx.TxNonce, tx.GasEstimate)
 	if err != nil {
-		return geth_common.Hash{}, err
+		return tx, err
 	}
 
-	// Get the transaction hash before sending
-	txHash := signedTx.Hash()
+	return tx, nil
+}
+
+// AddPendingTransaction stores the verified permit assigned to an account with its priority class, the Signer signs it when sending by schedule
+func (s *Signer) AddPendingTransaction(token *common.TokenConfig, values common.PermitType, signature []byte, permitHash geth_common.Hash, priority int64) (geth_common.Hash, error) {
+	// Ensure only one access
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	// Check tx_pedning exist
-	_tx, _ := s.txStore.GetTxPending(txHash.Hex())
-	if _tx.TxHash == txHash.Hex() {
-		return geth_common.Hash{}, fmt.Errorf("transaction already exist")
+	if len(s.accounts) == 0 {
+		return geth_common.Hash{}, fmt.Errorf("no signer account")
 	}
 
-	// Insert pending tx
-	err = s.txStore.AddTxPending(txHash.Hex(), values.Owner.Hex(), values.Receiver.Hex(), values.Value, values.Nonce, buffer.Bytes(), txNonce)
+	// Check the same permit with any signature encoding is not pending, submitted or failed
+	known, err := s.txStore.HasTx(permitHash.Hex())
 	if err != nil {
 		return geth_common.Hash{}, err
 	}
+	if known {
+		return geth_common.Hash{}, fmt.Errorf("permit already relayed")
+	}
 
-	// Update next nonce
-	err = s.txStore.UpdateSignerTxNonce(strings.ToLower(s.account.Address.Hex()), txNonce+1)
+	permit, err := common.EncodePermit(values)
 	if err != nil {
 		return geth_common.Hash{}, err
 	}
 
-	return txHash, nil
+	account, err := s.assignAccount(token, values)
+	if err != nil {
+		return geth_common.Hash{}, err
+	}
+	if account.paused.Load() {
+		return geth_common.Hash{}, fmt.Errorf("relayer account %s has insufficient gas balance, permits are paused until it is topped up", account.address.Hex())
+	}
+
+	// Insert pending permit
+	err = s.txStore.AddTxPending(store.Tx{
+		PermitHash: permitHash.Hex(),
+		Token:      token.Address.Hex(),
+		Payer:      values.Owner.Hex(),
+		Receiver:   values.Receiver.Hex(),
+		Amount:     values.Value,
+		Nonce:      values.Nonce,
+		Deadline:   values.Deadline,
+		ValidAfter: values.ValidAfter,
+		Signature:  signature,
+		Permit:     permit,
+		Account:    account.address.Hex(),
+		Priority:   priority,
+	})
+	if err != nil {
+		return geth_common.Hash{}, err
+	}
+
+	return permitHash, nil
+}
+
+// encodeTransaction returns the canonical EIP-2718 binary of the signed transaction
+func encodeTransaction(tx *types.Transaction) ([]byte, error) {
+	return tx.MarshalBinary()
+}
+
+func decodeTransaction(data []byte) (*types.Transaction, error) {
+	tx := new(types.Transaction)
+	err := tx.UnmarshalBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
 }
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"erc20-permit-relayer/common"
+	"erc20-permit-relayer/store"
+
+	"github.com/ethereum/go-ethereum"
+	geth_common "github.com/ethereum/go-ethereum/common"
+)
+
+// Pre-broadcast simulation of queued permits at the latest state
+
+// simulatePendingTransaction returns the revert reason of the permit calls, empty if they would succeed
+func (s *Signer) simulatePendingTransaction(ctx context.Context, account *signerAccount, tx store.Tx, calls []txCall) (string, error) {
+	token, ok := s.chain.GetToken(geth_common.HexToAddress(tx.Token))
+	if !ok {
+		return fmt.Sprintf("unsupported token %s", tx.Token), nil
+	}
+	values, err := common.DecodePermit(token, tx.Permit)
+	if err != nil {
+		return fmt.Sprintf("invalid permit, %v", err), nil
+	}
+
+	// An applied EIP-2612 permit leaves transferFrom to simulate
+	if len(calls) > 1 {
+		applied, err := s.permitApplied(ctx, token, values)
+		if err != nil {
+			return "", err
+		}
+		if applied {
+			calls = calls[1:]
+		}
+	}
+
+	// Calls after the first one depend on it, only the first one is simulated and the balance is checked for the transfer
+	call := calls[0]
+	gas := call.gas
+	if gas == 0 {
+		gas = s.chain.Signer.GasLimit
+	}
+	_, err = s.client.CallContract(ctx, ethereum.CallMsg{From: account.address, To: &call.to, Gas: gas, Data: call.data}, nil)
+	if err != nil {
+		reason, reverted := revertError(err, s.errorABIs)
+		if !reverted {
+			return "", err
+		}
+
+		// Sequential permit nonce not reached while permits of the owner with lower nonces are queued
+		if hasPermitNonces(token) {
+			nonce, err := s.callUint256(ctx, token.Address, "0x7ecebe00", geth_common.BytesToHash(values.Owner.Bytes())) // ERC20Permit.nonces(address)
+			if err != nil {
+				return "", err
+			}
+			if nonce.Cmp(values.Nonce) < 0 {
+				return "", nil
+			}
+		}
+		return reason, nil
+	}
+
+	// Balance of the transfer after the permit call
+	if len(calls) > 1 {
+		balance, err := s.callUint256(ctx, token.Address, "0x70a08231", geth_common.BytesToHash(values.Owner.Bytes())) // ERC20.balanceOf(address)
+		if err != nil {
+			return "", err
+		}
+		if balance.Cmp(values.Value) < 0 {
+			return "insufficient balance", nil
+		}
+	}
+
+	return "", nil
+}
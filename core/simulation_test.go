@@ -0,0 +1,88 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"erc20-permit-relayer/common"
+	"erc20-permit-relayer/store"
+
+	geth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// callStub serves eth_call of permit calls reverting or not, and nonces(address) of the owner
+type callStub struct {
+	revert bool
+	nonce  int64
+}
+
+func (c *callStub) Call(args map[string]interface{}, block string) (hexutil.Bytes, error) {
+	input, _ := args["input"].(string)
+	if input == "" {
+		input, _ = args["data"].(string)
+	}
+	data, _ := hexutil.Decode(input)
+	if len(data) >= 4 && hexutil.Encode(data[:4]) == "0x7ecebe00" {
+		return geth_common.BigToHash(big.NewInt(c.nonce)).Bytes(), nil
+	}
+	if c.revert {
+		return nil, errors.New("execution reverted: token paused")
+	}
+	return hexutil.Bytes{}, nil
+}
+
+func TestSimulatePendingTransaction(t *testing.T) {
+	stub := &callStub{}
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", stub); err != nil {
+		t.Fatalf("RegisterName returned error: %v", err)
+	}
+	tokenAddress := geth_common.HexToAddress("0x1234567890123456789012345678901234567890")
+	chain := &common.ChainConfig{Tokens: []common.TokenConfig{{Address: tokenAddress, Mode: common.TokenModeTransferWithPermit}}}
+	s := &Signer{chain: chain, client: ethclient.NewClient(rpc.DialInProc(server))}
+	account := &signerAccount{}
+
+	values := common.PermitType{
+		Owner:    geth_common.HexToAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"),
+		Receiver: geth_common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8"),
+		Value:    big.NewInt(100),
+		Nonce:    big.NewInt(3),
+		Deadline: big.NewInt(1700000000),
+	}
+	permit, err := common.EncodePermit(values)
+	if err != nil {
+		t.Fatalf("EncodePermit returned error: %v", err)
+	}
+	tx := store.Tx{Token: tokenAddress.Hex(), Permit: permit}
+	calls := []txCall{{to: tokenAddress, data: []byte{0x01, 0x02, 0x03, 0x04}, gas: 100000}}
+
+	forwarder := geth_common.HexToAddress("0x0987654321098765432109876543210987654321")
+	cases := []struct {
+		mode      string
+		forwarder geth_common.Address
+		revert    bool
+		nonce     int64
+		reject    bool
+	}{
+		{common.TokenModeTransferWithPermit, common.Address0x0, false, 3, false}, // passes
+		{common.TokenModeTransferWithPermit, common.Address0x0, true, 3, true},   // reverts at its nonce
+		{common.TokenModeTransferWithPermit, common.Address0x0, true, 2, false},  // lower nonces of the owner still queued
+		{common.TokenModeEIP2612, forwarder, true, 2, true},                      // forwarder call, no nonce to wait for
+	}
+	for _, c := range cases {
+		chain.Tokens[0].Mode, chain.Tokens[0].Forwarder = c.mode, c.forwarder
+		stub.revert, stub.nonce = c.revert, c.nonce
+		reason, err := s.simulatePendingTransaction(context.Background(), account, tx, calls)
+		if err != nil {
+			t.Fatalf("simulatePendingTransaction returned error: %v", err)
+		}
+		if (reason != "") != c.reject {
+			t.Errorf("simulatePendingTransaction returned %q for mode %s revert %v nonce %d", reason, c.mode, c.revert, c.nonce)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"erc20-permit-relayer/common"
+	"erc20-permit-relayer/store"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// delegateStatus returns the status of a permit by the permit hash returned from delegate_permit
+func (p *ProcessRequest) delegateStatus(requestBody map[string]interface{}, params []interface{}) ([]byte, error) {
+	permitHash, ok := params[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid delegate_status params: invalid permit hash")
+	}
+	permitHashBytes, err := hexutil.Decode(permitHash)
+	if err != nil || len(permitHashBytes) != 32 {
+		return nil, fmt.Errorf("invalid delegate_status params: invalid permit hash")
+	}
+
+	status, tx, err := p.txStore.GetTxStatus(hexutil.Encode(permitHashBytes))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("permit not found")
+	} else if err != nil {
+		return nil, err
+	}
+
+	result := map[string]interface{}{
+		"permitHash":  tx.PermitHash,
+		"status":      status,
+		"token":       tx.Token,
+		"owner":       tx.Payer,
+		"receiver":    tx.Receiver,
+		"value":       tx.Amount.String(),
+		"nonce":       tx.Nonce.String(),
+		"timestamp":   tx.Timestamp.UTC().Format(time.RFC3339),
+		"account":     nil,
+		"txHash":      nil,
+		"txNonce":     nil,
+		"rawTx":       nil,
+		"retryCount":  tx.RetryCount,
+		"failReason":  nil,
+		"gasEstimate": nil,
+		"gasUsed":     nil,
+		"deferredMs":  tx.DeferredTime.Milliseconds(),
+		"priority":    tx.Priority,
+	}
+	if tx.Account != "" {
+		result["account"] = tx.Account
+	}
+	if tx.FailReason != "" {
+		result["failReason"] = tx.FailReason
+	}
+	if tx.TxHash != "" {
+		result["txHash"] = tx.TxHash
+		result["txNonce"] = tx.TxNonce
+	}
+	if tx.GasEstimate > 0 {
+		result["gasEstimate"] = tx.GasEstimate
+	}
+	if tx.GasUsed > 0 {
+		result["gasUsed"] = tx.GasUsed
+	}
+	if tx.TxSignedRaw != "" {
+		result["rawTx"] = tx.TxSignedRaw
+	}
+	if tx.TxPermitRaw != "" {
+		result["rawPermitTx"] = tx.TxPermitRaw
+	}
+
+	// Authorizations not yet valid are scheduled from validAfter
+	if status == store.TxStatusPending && tx.TxHash == "" && tx.ValidAfter != nil && tx.ValidAfter.IsInt64() && tx.ValidAfter.Int64() > time.Now().Unix() {
+		result["expectedSendTime"] = time.Unix(tx.ValidAfter.Int64(), 0).UTC().Format(time.RFC3339)
+	} else if status == store.TxStatusPending && tx.TxHash == "" && tx.Account != "" {
+		// Position in the schedule of the account while not signed
+		position, err := p.txStore.GetTxPendingQueuePosition(tx.PermitHash, tx.Account)
+		if err != nil {
+			return nil, err
+		}
+		if position > 0 {
+			result["queuePosition"] = position
+
+			// Network fee of the fee policy
+			var fees txFees
+			if p.signer.feePolicyEnabled() {
+				fees, err = p.signer.suggestFees(context.Background())
+				if err != nil {
+					return nil, err
+				}
+			}
+			sendTime, ok := p.signer.expectedSendTime(tx, position, fees, time.Now())
+			if ok {
+				result["expectedSendTime"] = sendTime.UTC().Format(time.RFC3339)
+			} else {
+				result["feeHold"] = true
+			}
+		}
+	}
+
+	return common.MakeJsonResponseResult(requestBody["id"].(float64), result)
+}
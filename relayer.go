@@ -2,9 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
+	"math/big"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 
 	"erc20-permit-relayer/common"
@@ -16,12 +19,11 @@ import (
 )
 
 var (
-	log            log15.Logger
-	processRequest core.ProcessRequest
-	signer         core.Signer
-	keeper         core.Keeper
-	txStore        store.TxStore
-	wg             sync.WaitGroup
+	log             log15.Logger
+	processRequests map[int64]*core.ProcessRequest
+	defaultChainId  int64
+	txStore         *store.TxStore
+	wg              sync.WaitGroup
 )
 
 func handleRPCRequest(w http.ResponseWriter, r *http.Request) {
@@ -32,8 +34,13 @@ func handleRPCRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Process
-	response, err := processRequest.Process(requestBody)
+	// Route chain
+	var response []byte
+	processRequest, err := routeRequest(r.URL.Path, requestBody)
+	if err == nil {
+		// Process
+		response, err = processRequest.Process(requestBody, r.Header.Get("X-Api-Key"))
+	}
 	if err != nil {
 		id, ok := requestBody["id"].(float64)
 		if !ok {
@@ -49,6 +56,61 @@ func handleRPCRequest(w http.ResponseWriter, r *http.Request) {
 	w.Write(response)
 }
 
+// routeRequest resolves chain by url path /chain/<id> or chain field of delegate_permit, delegate_authorization
+func routeRequest(path string, requestBody map[string]interface{}) (*core.ProcessRequest, error) {
+	chainId := int64(0)
+
+	// Route by url path
+	if strings.HasPrefix(path, "/chain/") {
+		id, err := parseChainId(strings.Trim(strings.TrimPrefix(path, "/chain/"), "/"))
+		if err != nil {
+			return nil, err
+		}
+		chainId = id
+	} else if path != "/" {
+		return nil, fmt.Errorf("invalid path %s", path)
+	}
+
+	// Route by chain field
+	if method, _ := requestBody["method"].(string); method == "delegate_permit" || method == "delegate_authorization" {
+		if params, ok := requestBody["params"].([]interface{}); ok && len(params) > 0 {
+			if data, ok := params[0].(map[string]interface{}); ok && data["chain"] != nil {
+				id, err := parseChainId(data["chain"])
+				if err != nil {
+					return nil, err
+				}
+				if chainId != 0 && chainId != id {
+					return nil, fmt.Errorf("chain mismatch, path: %d chain: %d", chainId, id)
+				}
+				chainId = id
+			}
+		}
+	}
+
+	if chainId == 0 {
+		chainId = defaultChainId
+	}
+
+	processRequest, ok := processRequests[chainId]
+	if !ok {
+		return nil, fmt.Errorf("unsupported chain %d", chainId)
+	}
+	return processRequest, nil
+}
+
+func parseChainId(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case float64:
+		return int64(v), nil
+	case string:
+		id, ok := new(big.Int).SetString(v, 0)
+		if ok && id.IsInt64() && id.Sign() > 0 {
+			return id.Int64(), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid chain %v", value)
+}
+
 func main() {
 	// Startup
 	log = log15.New()
@@ -62,11 +124,10 @@ func main() {
 	}
 
 	log.Info("Proxy listening", "port", config.ProxyPort)
-	log.Info("Connect rpc endpoint", "endpoint", config.RpcEndpoint)
 	log.Info("Connect database", "postgres", config.Db.User+"@"+config.Db.Host+":"+strconv.Itoa(int(config.Db.Port)), "db", config.Db.Dbname)
 
 	// Database
-	txStore = *store.NewTxStore(config, &log)
+	txStore = store.NewTxStore(config, &log)
 	err = txStore.Connect()
 	if err != nil {
 		log.Error("Failed to connect database", "error", err)
@@ -74,26 +135,75 @@ func main() {
 	}
 	defer txStore.Close()
 
-	// Connect ethclient
-	client, err := ethclient.Dial(config.RpcEndpoint)
-	if err != nil {
-		log.Error("Failed to connect rpc endpoint", "msg", err)
-		return
-	}
+	// Chains
+	processRequests = make(map[int64]*core.ProcessRequest)
+	defaultChainId = config.Chains[0].NetworkId
+	for i := range config.Chains {
+		chain := &config.Chains[i]
+		chainLog := log.New("chain", chain.NetworkId)
+
+		chainLog.Info("Connect rpc endpoint", "endpoint", chain.RpcEndpoint)
+		for _, token := range chain.Tokens {
+			chainLog.Info("ERC20 Permit token", "name", token.Name, "address", token.Address)
+		}
 
-	// Signer
-	signer = *core.NewSigner(config, &log, &txStore, client, &wg)
+		// Connect ethclient
+		client, err := ethclient.Dial(chain.RpcEndpoint)
+		if err != nil {
+			chainLog.Error("Failed to connect rpc endpoint", "msg", err)
+			return
+		}
 
-	// Start Transaction Sender
-	if config.Signer.Enable {
-		go signer.Sender()
-		defer signer.Close()
-	} else {
-		log.Info("Transaction Sender", "enable", false)
-	}
+		// Resolve EIP-712 domain of tokens
+		err = core.ResolveDomains(chain, &chainLog, client)
+		if err != nil {
+			chainLog.Error("EIP-712 domain check fail", "msg", err)
+			return
+		}
+
+		// Database partition
+		chainStore := txStore.ForChain(chain)
+
+		// Signer
+		signer := core.NewSigner(config, chain, &chainLog, chainStore, client, &wg)
+
+		// Start Transaction Sender
+		if chain.Signer.Enable {
+			go signer.Sender()
+			defer signer.Close()
+		} else {
+			chainLog.Info("Transaction Sender", "enable", false)
+		}
 
-	// Process request
-	processRequest = *core.NewProcessRequest(config, &log, &txStore, &signer)
+		// Process request
+		processRequests[chain.NetworkId] = core.NewProcessRequest(config, chain, &chainLog, chainStore, signer)
+
+		// Keeper
+		keeper := core.NewKeeper(config, chain, &chainLog, chainStore, client, &wg)
+
+		// Start Transaction Keeper sync
+		if chain.Keeper.Enable {
+			// Load config
+			err = chainStore.PrepareKeeperConfig(chain.Keeper.InitialSyncBlockNumber)
+			if err != nil {
+				chainLog.Error("PrepareKeeperConfig fail", "msg", err)
+				return
+			}
+			syncBlockNumber, err := chainStore.GetKeeperBlockNumber()
+			if err != nil {
+				chainLog.Error("Failed to connect database", "error", err)
+				return
+			}
+
+			chainLog.Info("Transaction Keeper", "intance", chain.Keeper.InstanceId)
+			chainLog.Info("Start sync block number", "number", syncBlockNumber)
+
+			go keeper.Sync(syncBlockNumber)
+			defer keeper.Close()
+		} else {
+			chainLog.Info("Transaction Keeper", "enable", false)
+		}
+	}
 
 	// Proxy http
 	http.HandleFunc("/", handleRPCRequest)
@@ -109,26 +219,5 @@ func main() {
 		}
 	}()
 
-	// Keeper
-	keeper = *core.NewKeeper(config, &log, &txStore, client, &wg)
-
-	// Start Transaction Keeper sync
-	if config.Keeper.Enable {
-		// Load config
-		syncBlockNumber, err := txStore.GetKeeperBlockNumber()
-		if err != nil {
-			log.Error("Failed to connect database", "error", err)
-			return
-		}
-
-		log.Info("Transaction Keeper", "intance", config.Keeper.InstanceId)
-		log.Info("Start sync block number", "number", syncBlockNumber)
-
-		go keeper.Sync(syncBlockNumber)
-		defer keeper.Close()
-	} else {
-		log.Info("Transaction Keeper", "enable", false)
-	}
-
 	wg.Wait()
 }
@@ -0,0 +1,278 @@
+package store
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/gob"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var txTables = []string{"tx_pending", "tx_fail", "tx_submitted"}
+
+// migrate schema from previous versions
+func (t *TxStore) prepareMigrateSchema() error {
+	// account_balance is a cache of tx_pending, recreate it when token, chain_id column not exist
+	migrateQuery := `
+	DO $$
+	BEGIN
+		IF EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'account_balance')
+			AND (NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'account_balance' AND column_name = 'token')
+			OR NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'account_balance' AND column_name = 'chain_id')) THEN
+			DROP TABLE account_balance;
+		END IF;
+	END $$;`
+	_, err := t.db.Exec(migrateQuery)
+	if err != nil {
+		return err
+	}
+
+	// token, chain_id, tx_permit_signed, deadline, valid_after, signature, tx_hashes, account, retry_count, fail_reason, tx_signed_raw, tx_permit_signed_raw, gas_estimate, gas_used, deferred_ms, priority column
+	for _, table := range txTables {
+		migrateQuery = `
+		DO $$
+		BEGIN
+			IF EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = '` + table + `') THEN
+				ALTER TABLE ` + table + ` ADD COLUMN IF NOT EXISTS token VARCHAR;
+				ALTER TABLE ` + table + ` ADD COLUMN IF NOT EXISTS chain_id BIGINT;
+				ALTER TABLE ` + table + ` ADD COLUMN IF NOT EXISTS tx_permit_signed BYTEA;
+				ALTER TABLE ` + table + ` ADD COLUMN IF NOT EXISTS deadline NUMERIC;
+				ALTER TABLE ` + table + ` ADD COLUMN IF NOT EXISTS valid_after NUMERIC;
+				ALTER TABLE ` + table + ` ADD COLUMN IF NOT EXISTS signature BYTEA;
+				ALTER TABLE ` + table + ` ADD COLUMN IF NOT EXISTS tx_hashes VARCHAR[];
+				ALTER TABLE ` + table + ` ADD COLUMN IF NOT EXISTS account VARCHAR;
+				ALTER TABLE ` + table + ` ADD COLUMN IF NOT EXISTS retry_count INT DEFAULT 0;
+				ALTER TABLE ` + table + ` ADD COLUMN IF NOT EXISTS fail_reason VARCHAR;
+				ALTER TABLE ` + table + ` ADD COLUMN IF NOT EXISTS tx_signed_raw VARCHAR;
+				ALTER TABLE ` + table + ` ADD COLUMN IF NOT EXISTS tx_permit_signed_raw VARCHAR;
+				ALTER TABLE ` + table + ` ADD COLUMN IF NOT EXISTS gas_estimate NUMERIC;
+				ALTER TABLE ` + table + ` ADD COLUMN IF NOT EXISTS gas_used NUMERIC;
+				ALTER TABLE ` + table + ` ADD COLUMN IF NOT EXISTS deferred_ms NUMERIC;
+				ALTER TABLE ` + table + ` ADD COLUMN IF NOT EXISTS priority INT DEFAULT 0;
+			END IF;
+		END $$;`
+		_, err = t.db.Exec(migrateQuery)
+		if err != nil {
+			return err
+		}
+	}
+
+	// broadcast and fee policy hold time of tx_pending
+	migrateQuery = `
+	DO $$
+	BEGIN
+		IF EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'tx_pending') THEN
+			ALTER TABLE tx_pending ADD COLUMN IF NOT EXISTS timestamp_sent TIMESTAMP;
+			ALTER TABLE tx_pending ADD COLUMN IF NOT EXISTS timestamp_deferred TIMESTAMP;
+		END IF;
+	END $$;`
+	_, err = t.db.Exec(migrateQuery)
+	if err != nil {
+		return err
+	}
+
+	// retry time and terminal state of tx_fail
+	migrateQuery = `
+	DO $$
+	BEGIN
+		IF EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'tx_fail') THEN
+			ALTER TABLE tx_fail ADD COLUMN IF NOT EXISTS retry_at TIMESTAMP;
+			ALTER TABLE tx_fail ADD COLUMN IF NOT EXISTS terminal BOOLEAN DEFAULT FALSE;
+		END IF;
+	END $$;`
+	_, err = t.db.Exec(migrateQuery)
+	if err != nil {
+		return err
+	}
+
+	// permit column, rows keyed by permit_hash with tx_hash set once signed, previous rows use tx_hash
+	for _, table := range txTables {
+		migrateQuery = `
+		DO $$
+		BEGIN
+			IF EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = '` + table + `')
+				AND NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = '` + table + `' AND column_name = 'permit_hash') THEN
+				ALTER TABLE ` + table + ` ADD COLUMN permit_hash VARCHAR;
+				ALTER TABLE ` + table + ` ADD COLUMN IF NOT EXISTS permit JSONB;
+				UPDATE ` + table + ` SET permit_hash = tx_hash;
+				ALTER TABLE ` + table + ` DROP CONSTRAINT IF EXISTS ` + table + `_pkey;
+				ALTER TABLE ` + table + ` ADD PRIMARY KEY (permit_hash);
+				ALTER TABLE ` + table + ` ALTER COLUMN tx_hash DROP NOT NULL;
+			END IF;
+		END $$;`
+		_, err = t.db.Exec(migrateQuery)
+		if err != nil {
+			return err
+		}
+	}
+
+	// signer_config, keeper_config are partitioned by chain_id, previous rows belong to the first configured chain
+	chainId := strconv.FormatInt(t.config.Chains[0].NetworkId, 10)
+	for table, key := range map[string]string{"signer_config": "account", "keeper_config": "instance_id"} {
+		migrateQuery = `
+		DO $$
+		BEGIN
+			IF EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = '` + table + `')
+				AND NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = '` + table + `' AND column_name = 'chain_id') THEN
+				ALTER TABLE ` + table + ` ADD COLUMN chain_id BIGINT;
+				UPDATE ` + table + ` SET chain_id = ` + chainId + `;
+				ALTER TABLE ` + table + ` DROP CONSTRAINT IF EXISTS ` + table + `_pkey;
+				ALTER TABLE ` + table + ` ADD PRIMARY KEY (chain_id, ` + key + `);
+			END IF;
+		END $$;`
+		_, err = t.db.Exec(migrateQuery)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// previous rows without token, chain_id belong to the first configured token and chain
+func (t *TxStore) migrateDefaultValues() error {
+	chain := t.config.Chains[0]
+	token := strings.ToLower(chain.Tokens[0].Address.Hex())
+
+	for _, table := range txTables {
+		_, err := t.db.Exec(`UPDATE `+table+` SET token = $1 WHERE token IS NULL`, token)
+		if err != nil {
+			return err
+		}
+
+		_, err = t.db.Exec(`UPDATE `+table+` SET chain_id = $1 WHERE chain_id IS NULL`, chain.NetworkId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fail reason of pending rows whose signed tx can not be decoded, they have no permit to sign again
+const unreadableLegacyReason = "unreadable legacy transaction"
+
+// signedRow is a row of previous versions with a gob encoded signed tx
+type signedRow struct {
+	permitHash     string
+	txSigned       []byte
+	txPermitSigned []byte
+}
+
+// signed txs of previous versions are gob encoded, convert them to the canonical EIP-2718 binary with its raw hex
+func (t *TxStore) migrateSignedTransactions() error {
+	for _, table := range txTables {
+		query := `
+		SELECT permit_hash, tx_signed, tx_permit_signed FROM ` + table + `
+		WHERE (tx_signed IS NOT NULL AND tx_signed_raw IS NULL) OR (tx_permit_signed IS NOT NULL AND tx_permit_signed_raw IS NULL)`
+		rows, err := t.db.Query(query)
+		if err != nil {
+			return err
+		}
+
+		var signedRows []signedRow
+		for rows.Next() {
+			var row signedRow
+			if err := rows.Scan(&row.permitHash, &row.txSigned, &row.txPermitSigned); err != nil {
+				rows.Close()
+				return err
+			}
+			signedRows = append(signedRows, row)
+		}
+		rows.Close()
+
+		for _, row := range signedRows {
+			query, args, err := signedRowMigration(table, row)
+			if err == nil {
+				_, err = t.db.Exec(query, args...)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			if table != "tx_pending" {
+				t.log.Error("Cannot migrate signed transaction, clear it", "table", table, "permit", row.permitHash, "msg", err)
+				_, err = t.db.Exec(query, args...)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			// The pending tx may be in flight, keep its hash on a terminal tx_fail row for the operator
+			var chainId int64
+			var txHash sql.NullString
+			var token, payer, receiver string
+			err = t.db.QueryRow(query, args...).Scan(&chainId, &txHash, &token, &payer, &receiver)
+			if err != nil {
+				return err
+			}
+			t.log.Error("Cannot migrate signed transaction, move it to tx_fail", "permit", row.permitHash, "hash", txHash.String, "reason", unreadableLegacyReason)
+
+			err = t.updateChainPendingBalance(chainId, token, payer)
+			if err != nil {
+				return err
+			}
+			err = t.updateChainPendingBalance(chainId, token, receiver)
+			if err != nil {
+				return err
+			}
+		}
+		if len(signedRows) > 0 {
+			t.log.Info("Migrate signed transactions to EIP-2718 binary", "table", table, "rows", len(signedRows))
+		}
+	}
+	return nil
+}
+
+// signedRowMigration returns the update converting the row, or with the decode error the statement retiring it:
+// a terminal tx_fail move returning chain_id, tx_hash, token, payer, receiver for tx_pending, a cleared signed tx for others
+func signedRowMigration(table string, row signedRow) (string, []interface{}, error) {
+	txSigned, err := canonicalTransaction(row.txSigned)
+	var txPermitSigned []byte
+	if err == nil {
+		txPermitSigned, err = canonicalTransaction(row.txPermitSigned)
+	}
+	if err == nil {
+		query := `UPDATE ` + table + ` SET tx_signed = $2, tx_permit_signed = $3, tx_signed_raw = $4, tx_permit_signed_raw = $5 WHERE permit_hash = $1`
+		return query, []interface{}{row.permitHash, txSigned, txPermitSigned, nullHex(txSigned), nullHex(txPermitSigned)}, nil
+	}
+
+	if table != "tx_pending" {
+		query := `UPDATE ` + table + ` SET tx_signed = NULL, tx_permit_signed = NULL WHERE permit_hash = $1`
+		return query, []interface{}{row.permitHash}, err
+	}
+
+	query := `
+		WITH moved_records AS (
+			DELETE FROM tx_pending
+			WHERE permit_hash = $1
+			RETURNING *
+		), inserted_records AS (
+			INSERT INTO tx_fail (chain_id, ` + txColumns + `, timestamp_fail, retry_at, terminal)
+			SELECT chain_id, permit_hash, tx_hash, tx_hashes, token, payer, receiver, amount, nonce, deadline, valid_after, signature, permit, NULL, NULL, NULL, NULL, tx_nonce, account, retry_count, $2, gas_estimate, gas_used, deferred_ms, priority, timestamp, NOW(), NULL, TRUE
+			FROM moved_records
+			` + upsertColumns(txColumns, "timestamp_fail", "retry_at", "terminal") + `
+		)
+		SELECT chain_id, tx_hash, token, payer, receiver FROM moved_records;`
+	return query, []interface{}{row.permitHash, unreadableLegacyReason}, err
+}
+
+// canonicalTransaction returns the EIP-2718 binary of a gob encoded or already canonical transaction
+func canonicalTransaction(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var tx *types.Transaction
+	err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(&tx)
+	if err != nil {
+		tx = new(types.Transaction)
+		if err := tx.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+	}
+	return tx.MarshalBinary()
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math/big"
+	"strings"
+	"testing"
+
+	geth_common "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestSignedRowMigration(t *testing.T) {
+	to := geth_common.HexToAddress("0x1234567890123456789012345678901234567890")
+	tx := types.NewTx(&types.LegacyTx{Nonce: 7, GasPrice: big.NewInt(1), Gas: 21000, To: &to, Value: big.NewInt(0)})
+	canonical, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary returned error: %v", err)
+	}
+
+	// Legacy gob encoded row
+	var legacy bytes.Buffer
+	if err := gob.NewEncoder(&legacy).Encode(tx); err != nil {
+		t.Fatalf("gob Encode returned error: %v", err)
+	}
+	query, args, err := signedRowMigration("tx_pending", signedRow{permitHash: "p1", txSigned: legacy.Bytes()})
+	if err != nil {
+		t.Fatalf("signedRowMigration returned error: %v", err)
+	}
+	if !strings.HasPrefix(query, "UPDATE tx_pending SET tx_signed") || !bytes.Equal(args[1].([]byte), canonical) || args[2].([]byte) != nil {
+		t.Errorf("signedRowMigration returned wrong conversion: %s %v", query, args)
+	}
+
+	// Unreadable pending row is moved to a terminal tx_fail row with the reason
+	unreadable := signedRow{permitHash: "p2", txSigned: []byte{0x01, 0x02, 0x03}}
+	query, args, err = signedRowMigration("tx_pending", unreadable)
+	if err == nil {
+		t.Fatalf("signedRowMigration expected decode error")
+	}
+	if !strings.Contains(query, "DELETE FROM tx_pending") || !strings.Contains(query, "INSERT INTO tx_fail") || args[0] != "p2" || args[1] != unreadableLegacyReason {
+		t.Errorf("signedRowMigration returned wrong pending move: %s %v", query, args)
+	}
+
+	// Other tables only lose the signed tx
+	query, args, err = signedRowMigration("tx_submitted", unreadable)
+	if err == nil || !strings.HasPrefix(query, "UPDATE tx_submitted SET tx_signed = NULL") || len(args) != 1 {
+		t.Errorf("signedRowMigration returned wrong submitted update: %s %v %v", query, args, err)
+	}
+}
@@ -4,32 +4,142 @@ import (
 	"database/sql"
 	"fmt"
 	"math/big"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"erc20-permit-relayer/common"
 
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/inconshreveable/log15"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type TxStore struct {
 	db     *sql.DB
 	config *common.Config
+	chain  *common.ChainConfig
 	log    log15.Logger
 	mutex  sync.Mutex
 }
 
 type Tx struct {
-	TxHash    string
-	Payer     string
-	Receiver  string
-	Amount    *big.Int
-	Nonce     uint64
-	TxSigned  []byte
-	TxNonce   uint64
-	Timestamp time.Time
+	PermitHash     string
+	TxHash         string   // empty until signed by the Signer
+	TxHashes       []string // all broadcast hashes of the permit, replacements included
+	Token          string
+	Payer          string
+	Receiver       string
+	Amount         *big.Int
+	Nonce          *big.Int
+	Deadline       *big.Int
+	ValidAfter     *big.Int
+	Signature      []byte // canonical permit signature
+	Permit         []byte // verified permit values in JSON
+	TxSigned       []byte // canonical EIP-2718 binary
+	TxPermitSigned []byte // broadcast before TxSigned, EIP-2612 permit without forwarder or ERC-6492 wallet deploy
+	TxSignedRaw    string // hex of TxSigned to rebroadcast
+	TxPermitRaw    string // hex of TxPermitSigned
+	TxNonce        uint64
+	Account        string        // signer account sending the permit
+	RetryCount     int64         // attempts after failures
+	FailReason     string        // last failure, empty if never failed
+	GasEstimate    uint64        // eth_estimateGas of TxSigned before the safety multiplier, 0 if not estimated
+	GasUsed        uint64        // gas used by the mined tx, the whole batch tx for a batched permit
+	DeferredTime   time.Duration // held by the fee policy before signed
+	Priority       int64         // scheduling class, higher first
+	Timestamp      time.Time
+}
+
+// Common columns of tx_pending, tx_fail, tx_submitted
+const txColumns = `permit_hash, tx_hash, tx_hashes, token, payer, receiver, amount, nonce, deadline, valid_after, signature, permit, tx_signed, tx_permit_signed, tx_signed_raw, tx_permit_signed_raw, tx_nonce, account, retry_count, fail_reason, gas_estimate, gas_used, deferred_ms, priority, timestamp`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTx(row rowScanner) (Tx, error) {
+	var (
+		tx          Tx
+		txHash      sql.NullString
+		amount      string
+		nonce       string
+		deadline    sql.NullString
+		validAfter  sql.NullString
+		txNonce     sql.NullInt64
+		account     sql.NullString
+		retryCount  sql.NullInt64
+		failReason  sql.NullString
+		gasEstimate sql.NullInt64
+		gasUsed     sql.NullInt64
+		deferredMs  sql.NullInt64
+		priority    sql.NullInt64
+		txRaw       sql.NullString
+		permitRaw   sql.NullString
+	)
+	err := row.Scan(&tx.PermitHash, &txHash, pq.Array(&tx.TxHashes), &tx.Token, &tx.Payer, &tx.Receiver, &amount, &nonce, &deadline, &validAfter, &tx.Signature, &tx.Permit, &tx.TxSigned, &tx.TxPermitSigned, &txRaw, &permitRaw, &txNonce, &account, &retryCount, &failReason, &gasEstimate, &gasUsed, &deferredMs, &priority, &tx.Timestamp)
+	if err != nil {
+		return tx, err
+	}
+
+	tx.TxHash = txHash.String
+	tx.Amount, _ = new(big.Int).SetString(amount, 10)
+	tx.Nonce, _ = new(big.Int).SetString(nonce, 10)
+	tx.Deadline = parseNullBigInt(deadline)
+	tx.ValidAfter = parseNullBigInt(validAfter)
+	tx.TxNonce = uint64(txNonce.Int64)
+	tx.Account = account.String
+	tx.RetryCount = retryCount.Int64
+	tx.FailReason = failReason.String
+	tx.GasEstimate = uint64(gasEstimate.Int64)
+	tx.GasUsed = uint64(gasUsed.Int64)
+	tx.DeferredTime = time.Duration(deferredMs.Int64) * time.Millisecond
+	tx.Priority = priority.Int64
+	tx.TxSignedRaw = txRaw.String
+	tx.TxPermitRaw = permitRaw.String
+	return tx, nil
+}
+
+func parseNullBigInt(value sql.NullString) *big.Int {
+	if !value.Valid {
+		return nil
+	}
+	result, _ := new(big.Int).SetString(value.String, 10)
+	return result
+}
+
+// upsertColumns replaces the row of the permit hash moved to a table before, the latest outcome wins
+func upsertColumns(columns string, extraColumns ...string) string {
+	var sets []string
+	for _, column := range append(strings.Split(columns, ","), extraColumns...) {
+		column = strings.TrimSpace(column)
+		sets = append(sets, column+" = EXCLUDED."+column)
+	}
+	return "ON CONFLICT (permit_hash) DO UPDATE SET chain_id = EXCLUDED.chain_id, " + strings.Join(sets, ", ")
+}
+
+// nullGas returns NULL for gas not known
+func nullGas(value uint64) sql.NullInt64 {
+	if value == 0 {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(value), Valid: true}
+}
+
+// nullHex returns the raw hex of a signed transaction
+func nullHex(value []byte) sql.NullString {
+	if len(value) == 0 {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: hexutil.Encode(value), Valid: true}
+}
+
+func nullBigInt(value *big.Int) sql.NullString {
+	if value == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: value.String(), Valid: true}
 }
 
 func NewTxStore(config *common.Config, log *log15.Logger) *TxStore {
@@ -39,6 +149,16 @@ func NewTxStore(config *common.Config, log *log15.Logger) *TxStore {
 	}
 }
 
+// ForChain returns a store partition of the given chain sharing the database connection
+func (t *TxStore) ForChain(chain *common.ChainConfig) *TxStore {
+	return &TxStore{
+		db:     t.db,
+		config: t.config,
+		chain:  chain,
+		log:    t.log.New("chain", chain.NetworkId),
+	}
+}
+
 func (t *TxStore) Connect() error {
 	// Connect to the PostgreSQL database
 	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
@@ -50,12 +170,30 @@ func (t *TxStore) Connect() error {
 
 	t.db = db
 
+	// Prepare migrate schema
+	err = t.prepareMigrateSchema()
+	if err != nil {
+		return err
+	}
+
 	// Prepare create schema
 	err = t.prepareCreateSchama()
 	if err != nil {
 		return err
 	}
 
+	// Fill token, chain of previous rows
+	err = t.migrateDefaultValues()
+	if err != nil {
+		return err
+	}
+
+	// Convert gob signed txs of previous rows
+	err = t.migrateSignedTransactions()
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -68,14 +206,34 @@ func (t *TxStore) prepareCreateSchama() error {
 	// tx_pending
 	createSchemaQuery := `
 	CREATE TABLE IF NOT EXISTS tx_pending (
-		tx_hash VARCHAR PRIMARY KEY,
+		permit_hash VARCHAR PRIMARY KEY,
+		tx_hash VARCHAR,
+		tx_hashes VARCHAR[],
+		chain_id BIGINT,
+		token VARCHAR,
 		payer VARCHAR,
 		receiver VARCHAR,
 		amount NUMERIC,
 		nonce NUMERIC,
+		deadline NUMERIC,
+		valid_after NUMERIC,
+		signature BYTEA,
+		permit JSONB,
 		tx_signed BYTEA,
+		tx_permit_signed BYTEA,
+		tx_signed_raw VARCHAR,
+		tx_permit_signed_raw VARCHAR,
 		tx_nonce NUMERIC,
-		timestamp TIMESTAMP DEFAULT NOW()
+		account VARCHAR,
+		retry_count INT DEFAULT 0,
+		fail_reason VARCHAR,
+		gas_estimate NUMERIC,
+		gas_used NUMERIC,
+		deferred_ms NUMERIC,
+		priority INT DEFAULT 0,
+		timestamp TIMESTAMP DEFAULT NOW(),
+		timestamp_sent TIMESTAMP,
+		timestamp_deferred TIMESTAMP
 	);`
 	_, err := t.db.Exec(createSchemaQuery)
 	if err != nil {
@@ -85,15 +243,35 @@ func (t *TxStore) prepareCreateSchama() error {
 	// tx_fail
 	createSchemaQuery = `
 	CREATE TABLE IF NOT EXISTS tx_fail (
-		tx_hash VARCHAR PRIMARY KEY,
+		permit_hash VARCHAR PRIMARY KEY,
+		tx_hash VARCHAR,
+		tx_hashes VARCHAR[],
+		chain_id BIGINT,
+		token VARCHAR,
 		payer VARCHAR,
 		receiver VARCHAR,
 		amount NUMERIC,
 		nonce NUMERIC,
+		deadline NUMERIC,
+		valid_after NUMERIC,
+		signature BYTEA,
+		permit JSONB,
 		tx_signed BYTEA,
+		tx_permit_signed BYTEA,
+		tx_signed_raw VARCHAR,
+		tx_permit_signed_raw VARCHAR,
 		tx_nonce NUMERIC,
+		account VARCHAR,
+		retry_count INT DEFAULT 0,
+		fail_reason VARCHAR,
+		gas_estimate NUMERIC,
+		gas_used NUMERIC,
+		deferred_ms NUMERIC,
+		priority INT DEFAULT 0,
 		timestamp TIMESTAMP,
-		timestamp_fail TIMESTAMP DEFAULT NOW()
+		timestamp_fail TIMESTAMP DEFAULT NOW(),
+		retry_at TIMESTAMP,
+		terminal BOOLEAN DEFAULT FALSE
 	);`
 	_, err = t.db.Exec(createSchemaQuery)
 	if err != nil {
@@ -103,13 +281,31 @@ func (t *TxStore) prepareCreateSchama() error {
 	// tx_submitted
 	createSchemaQuery = `
 	CREATE TABLE IF NOT EXISTS tx_submitted (
-		tx_hash VARCHAR PRIMARY KEY,
+		permit_hash VARCHAR PRIMARY KEY,
+		tx_hash VARCHAR,
+		tx_hashes VARCHAR[],
+		chain_id BIGINT,
+		token VARCHAR,
 		payer VARCHAR,
 		receiver VARCHAR,
 		amount NUMERIC,
 		nonce NUMERIC,
+		deadline NUMERIC,
+		valid_after NUMERIC,
+		signature BYTEA,
+		permit JSONB,
 		tx_signed BYTEA,
+		tx_permit_signed BYTEA,
+		tx_signed_raw VARCHAR,
+		tx_permit_signed_raw VARCHAR,
 		tx_nonce NUMERIC,
+		account VARCHAR,
+		retry_count INT DEFAULT 0,
+		fail_reason VARCHAR,
+		gas_estimate NUMERIC,
+		gas_used NUMERIC,
+		deferred_ms NUMERIC,
+		priority INT DEFAULT 0,
 		timestamp TIMESTAMP,
 		timestamp_submitted TIMESTAMP DEFAULT NOW()
 	);`
@@ -121,9 +317,12 @@ func (t *TxStore) prepareCreateSchama() error {
 	// account_balance
 	createSchemaQuery = `
 	CREATE TABLE IF NOT EXISTS account_balance (
-		account VARCHAR PRIMARY KEY,
+		chain_id BIGINT,
+		account VARCHAR,
+		token VARCHAR,
 		pending_balance NUMERIC,
-		pending_txs NUMERIC
+		pending_txs NUMERIC,
+		PRIMARY KEY (chain_id, account, token)
 	);`
 	_, err = t.db.Exec(createSchemaQuery)
 	if err != nil {
@@ -133,8 +332,24 @@ func (t *TxStore) prepareCreateSchama() error {
 	// signer_config
 	createSchemaQuery = `
 	CREATE TABLE IF NOT EXISTS signer_config (
-		account VARCHAR PRIMARY KEY,
+		chain_id BIGINT,
+		account VARCHAR,
 		tx_nonce NUMERIC,
+		timestamp TIMESTAMP DEFAULT NOW(),
+		PRIMARY KEY (chain_id, account)
+	);`
+	_, err = t.db.Exec(createSchemaQuery)
+	if err != nil {
+		return err
+	}
+
+	// fee_emergency_spend, cost above the fee ceiling of permits close to their deadline
+	createSchemaQuery = `
+	CREATE TABLE IF NOT EXISTS fee_emergency_spend (
+		id BIGSERIAL PRIMARY KEY,
+		chain_id BIGINT,
+		permit_hash VARCHAR,
+		cost NUMERIC,
 		timestamp TIMESTAMP DEFAULT NOW()
 	);`
 	_, err = t.db.Exec(createSchemaQuery)
@@ -145,9 +360,11 @@ func (t *TxStore) prepareCreateSchama() error {
 	// keeper_config
 	createSchemaQuery = `
 	CREATE TABLE IF NOT EXISTS keeper_config (
-		instance_id VARCHAR PRIMARY KEY,
+		chain_id BIGINT,
+		instance_id VARCHAR,
 		block_number NUMERIC,
-		timestamp TIMESTAMP DEFAULT NOW()
+		timestamp TIMESTAMP DEFAULT NOW(),
+		PRIMARY KEY (chain_id, instance_id)
 	);`
 	_, err = t.db.Exec(createSchemaQuery)
 	if err != nil {
@@ -160,11 +377,11 @@ func (t *TxStore) prepareCreateSchama() error {
 func (t *TxStore) PrepareKeeperConfig(blockNumber int64) error {
 	// Add default value if not exist
 	createSchemaQuery := `
-	INSERT INTO keeper_config (instance_id, block_number, timestamp)
-	VALUES ($1, '0', NOW())
-	ON CONFLICT (instance_id)
+	INSERT INTO keeper_config (chain_id, instance_id, block_number, timestamp)
+	VALUES ($1, $2, '0', NOW())
+	ON CONFLICT (chain_id, instance_id)
 	DO NOTHING;`
-	_, err := t.db.Exec(createSchemaQuery, t.config.Keeper.InstanceId)
+	_, err := t.db.Exec(createSchemaQuery, t.chain.NetworkId, t.chain.Keeper.InstanceId)
 	if err != nil {
 		return err
 	}
@@ -181,11 +398,11 @@ func (t *TxStore) PrepareKeeperConfig(blockNumber int64) error {
 func (t *TxStore) PrepareSignerConfig(account string) error {
 	// Add default value if not exist
 	createSchemaQuery := `
-	INSERT INTO signer_config (account, tx_nonce, timestamp)
-	VALUES ($1, '0', NOW())
-	ON CONFLICT (account)
+	INSERT INTO signer_config (chain_id, account, tx_nonce, timestamp)
+	VALUES ($1, $2, '0', NOW())
+	ON CONFLICT (chain_id, account)
 	DO NOTHING;`
-	_, err := t.db.Exec(createSchemaQuery, account)
+	_, err := t.db.Exec(createSchemaQuery, t.chain.NetworkId, account)
 	if err != nil {
 		return err
 	}
@@ -194,28 +411,29 @@ func (t *TxStore) PrepareSignerConfig(account string) error {
 }
 
 // tx_pending
-func (t *TxStore) AddTxPending(txHash string, payer string, receiver string, amount *big.Int, nonce *big.Int, txSigned []byte, txNonce uint64) error {
+func (t *TxStore) AddTxPending(tx Tx) error {
 	// Ensure only one to read/write access
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
-	payer = strings.ToLower(payer)
-	receiver = strings.ToLower(receiver)
+	token := strings.ToLower(tx.Token)
+	payer := strings.ToLower(tx.Payer)
+	receiver := strings.ToLower(tx.Receiver)
 
-	query := "INSERT INTO tx_pending (tx_hash, payer, receiver, amount, nonce, tx_signed, tx_nonce, timestamp) VALUES ($1, $2, $3, $4, $5, $6, $7, NOW());"
-	_, err := t.db.Exec(query, txHash, payer, receiver, amount.String(), nonce.String(), txSigned, txNonce)
+	query := "INSERT INTO tx_pending (permit_hash, chain_id, token, payer, receiver, amount, nonce, deadline, valid_after, signature, permit, account, priority, timestamp) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NOW());"
+	_, err := t.db.Exec(query, tx.PermitHash, t.chain.NetworkId, token, payer, receiver, tx.Amount.String(), tx.Nonce.String(), nullBigInt(tx.Deadline), nullBigInt(tx.ValidAfter), tx.Signature, string(tx.Permit), strings.ToLower(tx.Account), tx.Priority)
 	if err != nil {
 		return err
 	}
 
 	// Update pending balance
-	err = t.updatePendingBalance(payer)
+	err = t.updatePendingBalance(token, payer)
 	if err != nil {
 		return err
 	}
 
 	// Update pending balance
-	err = t.updatePendingBalance(receiver)
+	err = t.updatePendingBalance(token, receiver)
 	if err != nil {
 		return err
 	}
@@ -223,28 +441,29 @@ func (t *TxStore) AddTxPending(txHash string, payer string, receiver string, amo
 	return nil
 }
 
-func (t *TxStore) GetPendingBalance(account string) (*big.Int, error) {
+func (t *TxStore) GetPendingBalance(token string, account string) (*big.Int, error) {
 	// Ensure only one to read/write access
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
+	token = strings.ToLower(token)
 	account = strings.ToLower(account)
 
 	// Get latest pending balance
-	query := `SELECT pending_balance FROM account_balance WHERE account = $1`
+	query := `SELECT pending_balance FROM account_balance WHERE account = $1 AND token = $2 AND chain_id = $3`
 
 	var result string
-	err := t.db.QueryRow(query, account).Scan(&result)
+	err := t.db.QueryRow(query, account, token, t.chain.NetworkId).Scan(&result)
 	// Check not exist
 	if err == sql.ErrNoRows {
 		// Update pending balance
-		err = t.updatePendingBalance(account)
+		err = t.updatePendingBalance(token, account)
 		if err != nil {
 			return nil, err
 		}
 
 		// Get latest pending balance again
-		err = t.db.QueryRow(query, account).Scan(&result)
+		err = t.db.QueryRow(query, account, token, t.chain.NetworkId).Scan(&result)
 	}
 	// final check query error
 	if err != nil {
@@ -255,28 +474,29 @@ func (t *TxStore) GetPendingBalance(account string) (*big.Int, error) {
 	return pending_balance, nil
 }
 
-func (t *TxStore) GetPendingTxs(account string) (int64, error) {
+func (t *TxStore) GetPendingTxs(token string, account string) (int64, error) {
 	// Ensure only one to read/write access
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
+	token = strings.ToLower(token)
 	account = strings.ToLower(account)
 
 	// Get latest pending txs
-	query := `SELECT pending_txs FROM account_balance WHERE account = $1`
+	query := `SELECT pending_txs FROM account_balance WHERE account = $1 AND token = $2 AND chain_id = $3`
 
 	var result int64
-	err := t.db.QueryRow(query, account).Scan(&result)
+	err := t.db.QueryRow(query, account, token, t.chain.NetworkId).Scan(&result)
 	// Check not exist
 	if err == sql.ErrNoRows {
 		// Update pending balance
-		err = t.updatePendingBalance(account)
+		err = t.updatePendingBalance(token, account)
 		if err != nil {
 			return 0, err
 		}
 
 		// Get latest pending balance again
-		err = t.db.QueryRow(query, account).Scan(&result)
+		err = t.db.QueryRow(query, account, token, t.chain.NetworkId).Scan(&result)
 	}
 	// final check query error
 	if err != nil {
@@ -286,38 +506,157 @@ func (t *TxStore) GetPendingTxs(account string) (int64, error) {
 	return result, nil
 }
 
-func (t *TxStore) GetAllTxPending(count int) ([]Tx, error) {
+// scheduleTxs orders unsigned permits of one account: permits within the urgent window of their deadline first, then by
+// priority class and round-robin across owners. Permits of one owner and token keep their nonce order and take the
+// urgency and priority of their later permits.
+func scheduleTxs(txs []Tx, urgentDeadline int64) []Tx {
+	type scheduled struct {
+		tx                Tx
+		urgent            bool
+		effectivePriority int64
+		ownerRound        int
+	}
+	nonceOrder := func(a, b Tx) bool {
+		if c := a.Nonce.Cmp(b.Nonce); c != 0 {
+			return c < 0
+		}
+		return a.Timestamp.Before(b.Timestamp)
+	}
+
+	queue := make([]*scheduled, len(txs))
+	for i, tx := range txs {
+		queue[i] = &scheduled{tx: tx, urgent: tx.Deadline != nil && tx.Deadline.Cmp(big.NewInt(urgentDeadline)) <= 0, effectivePriority: tx.Priority}
+	}
+	sort.SliceStable(queue, func(i, j int) bool { return nonceOrder(queue[i].tx, queue[j].tx) })
+
+	// Urgency and priority of the later permits of the owner and token, in nonce order
+	ownerNext := make(map[string]*scheduled)
+	for i := len(queue) - 1; i >= 0; i-- {
+		key := queue[i].tx.Payer + queue[i].tx.Token
+		if next, ok := ownerNext[key]; ok {
+			queue[i].urgent = queue[i].urgent || next.urgent
+			if next.effectivePriority > queue[i].effectivePriority {
+				queue[i].effectivePriority = next.effectivePriority
+			}
+		}
+		ownerNext[key] = queue[i]
+	}
+
+	// Round of the permit among the permits of its owner
+	ownerRounds := make(map[string]int)
+	for _, item := range queue {
+		ownerRounds[item.tx.Payer]++
+		item.ownerRound = ownerRounds[item.tx.Payer]
+	}
+
+	sort.SliceStable(queue, func(i, j int) bool {
+		a, b := queue[i], queue[j]
+		if a.urgent != b.urgent {
+			return a.urgent
+		}
+		if a.effectivePriority != b.effectivePriority {
+			return a.effectivePriority > b.effectivePriority
+		}
+		if a.ownerRound != b.ownerRound {
+			return a.ownerRound < b.ownerRound
+		}
+		return a.tx.Timestamp.Before(b.tx.Timestamp)
+	})
+
+	result := make([]Tx, len(queue))
+	for i, item := range queue {
+		result[i] = item.tx
+	}
+	return result
+}
+
+// urgentDeadline is the deadline of permits within the urgent window
+func (t *TxStore) urgentDeadline() int64 {
+	return time.Now().Add(t.chain.Signer.FeeUrgentWindow * time.Millisecond).Unix()
+}
+
+// getScheduledTxPending returns the unsigned permits of the signer account by schedule, authorizations wait for their validAfter
+func (t *TxStore) getScheduledTxPending(account string) ([]Tx, error) {
+	var txs []Tx
+	query := `SELECT ` + txColumns + ` FROM tx_pending WHERE account = $2 AND chain_id = $1 AND tx_nonce IS NULL AND (valid_after IS NULL OR valid_after <= $3)`
+	rows, err := t.db.Query(query, t.chain.NetworkId, account, time.Now().Unix())
+	if err != nil {
+		return txs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		tx, err := scanTx(rows)
+		if err != nil {
+			continue
+		}
+
+		txs = append(txs, tx)
+	}
+	if err = rows.Err(); err != nil {
+		return txs, err
+	}
+
+	return scheduleTxs(txs, t.urgentDeadline()), nil
+}
+
+// GetAllTxPending returns all signed txs of the signer account by tx nonce, then up to count permits to sign by schedule
+func (t *TxStore) GetAllTxPending(account string, count int) ([]Tx, error) {
 	// Ensure only one to read/write access
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
-	if count > 0 {
+	if count <= 0 {
 		count = 1000
 	}
 
 	var txs []Tx
-	query := `SELECT tx_hash, payer, receiver, amount, nonce, tx_signed, tx_nonce, timestamp FROM tx_pending ORDER BY tx_nonce LIMIT $1`
-	rows, err := t.db.Query(query, count)
+	// Signed txs are broadcast in tx nonce order, they do not take the signing budget
+	query := `SELECT ` + txColumns + ` FROM tx_pending WHERE account = $2 AND chain_id = $1 AND tx_nonce IS NOT NULL ORDER BY tx_nonce, timestamp`
+	rows, err := t.db.Query(query, t.chain.NetworkId, account)
 	if err != nil {
 		return txs, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var (
-			tx     Tx
-			amount string
-		)
-		err := rows.Scan(&tx.TxHash, &tx.Payer, &tx.Receiver, &amount, &tx.Nonce, &tx.TxSigned, &tx.TxNonce, &tx.Timestamp)
+		tx, err := scanTx(rows)
 		if err != nil {
 			continue
 		}
 
-		tx.Amount, _ = new(big.Int).SetString(amount, 10)
 		txs = append(txs, tx)
 	}
 
-	return txs, err
+	// Permits take the next tx nonces in schedule order
+	scheduled, err := t.getScheduledTxPending(account)
+	if err != nil {
+		return txs, err
+	}
+	if len(scheduled) > count {
+		scheduled = scheduled[:count]
+	}
+
+	return append(txs, scheduled...), nil
+}
+
+// GetTxPendingQueuePosition returns the position from 1 of the unsigned permit in the schedule of its account, 0 if signed or not pending
+func (t *TxStore) GetTxPendingQueuePosition(permitHash string, account string) (int64, error) {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	scheduled, err := t.getScheduledTxPending(strings.ToLower(account))
+	if err != nil {
+		return 0, err
+	}
+	for i, tx := range scheduled {
+		if tx.PermitHash == permitHash {
+			return int64(i + 1), nil
+		}
+	}
+
+	return 0, nil
 }
 
 func (t *TxStore) GetTxPending(txHash string) (Tx, error) {
@@ -328,189 +667,801 @@ func (t *TxStore) GetTxPending(txHash string) (Tx, error) {
 	return t.getTxPending(txHash)
 }
 
+// getTxPending finds the pending permit by its current or replaced tx hash
 func (t *TxStore) getTxPending(txHash string) (Tx, error) {
-	var (
-		tx     Tx
-		amount string
-	)
-	query := `SELECT tx_hash, payer, receiver, amount, nonce, tx_signed, tx_nonce, timestamp FROM tx_pending WHERE tx_hash = $1`
-	err := t.db.QueryRow(query, txHash).Scan(&tx.TxHash, &tx.Payer, &tx.Receiver, &amount, &tx.Nonce, &tx.TxSigned, &tx.TxNonce, &tx.Timestamp)
+	query := `SELECT ` + txColumns + ` FROM tx_pending WHERE (tx_hash = $1 OR $1 = ANY(tx_hashes)) AND chain_id = $2`
+	return scanTx(t.db.QueryRow(query, txHash, t.chain.NetworkId))
+}
+
+// HasTxPendingNonce checks the permit nonce of payer is already used by a pending tx of the tokens sharing one nonce space
+func (t *TxStore) HasTxPendingNonce(tokens []string, payer string, nonce *big.Int) (bool, error) {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// Lowercase a copy, the tokens belong to the caller
+	lowerTokens := make([]string, len(tokens))
+	for i, token := range tokens {
+		lowerTokens[i] = strings.ToLower(token)
+	}
+	payer = strings.ToLower(payer)
+
+	query := `SELECT EXISTS (SELECT 1 FROM tx_pending WHERE token = ANY($1) AND payer = $2 AND nonce = $3 AND chain_id = $4)`
+
+	var result bool
+	err := t.db.QueryRow(query, pq.Array(lowerTokens), payer, nonce.String(), t.chain.NetworkId).Scan(&result)
 	if err != nil {
-		return tx, err
+		return false, err
 	}
 
-	tx.Amount, _ = new(big.Int).SetString(amount, 10)
-	return tx, err
+	return result, nil
 }
 
-func (t *TxStore) updatePendingBalance(account string) error {
-	account = strings.ToLower(account)
+// HasTx checks the permit is already pending, submitted or failed
+func (t *TxStore) HasTx(permitHash string) (bool, error) {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
 
-	// Delete before
-	query := `DELETE FROM account_balance WHERE account = $1`
-	_, err := t.db.Exec(query, account)
+	query := `
+	SELECT EXISTS (SELECT 1 FROM tx_pending WHERE permit_hash = $1 AND chain_id = $2)
+		OR EXISTS (SELECT 1 FROM tx_submitted WHERE permit_hash = $1 AND chain_id = $2)
+		OR EXISTS (SELECT 1 FROM tx_fail WHERE permit_hash = $1 AND chain_id = $2)`
+
+	var result bool
+	err := t.db.QueryRow(query, permitHash, t.chain.NetworkId).Scan(&result)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	// Insert new pending_balance
-	query = `
-	INSERT INTO account_balance (account, pending_balance, pending_txs) 
-	SELECT
-		'` + account + `' AS account,
-		(SELECT COALESCE(SUM(amount::NUMERIC), 0) FROM tx_pending WHERE receiver = $1) -
-		(SELECT COALESCE(SUM(amount::NUMERIC), 0) FROM tx_pending WHERE payer = $1) AS pending_balance,
-		(SELECT COUNT(*) FROM tx_pending WHERE payer = $1) AS pending_txs;`
-	_, err = t.db.Exec(query, account)
+	return result, nil
+}
+
+// UpdateTxPendingSigned records the transactions the Signer signed for the permit and the gas estimate of txSigned, 0 if not estimated
+func (t *TxStore) UpdateTxPendingSigned(permitHash string, txHash string, txSigned []byte, txPermitSigned []byte, txNonce uint64, gasEstimate uint64) error {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	query := `
+	UPDATE tx_pending SET tx_hash = $2, tx_hashes = array_append(COALESCE(tx_hashes, '{}'), $2), tx_signed = $3, tx_permit_signed = $4, tx_signed_raw = $7, tx_permit_signed_raw = $8, tx_nonce = $5, gas_estimate = $9, timestamp_sent = NOW(),
+		deferred_ms = COALESCE(deferred_ms, 0) + FLOOR(EXTRACT(EPOCH FROM NOW() - COALESCE(timestamp_deferred, NOW())) * 1000), timestamp_deferred = NULL
+	WHERE permit_hash = $1 AND chain_id = $6;`
+	_, err := t.db.Exec(query, permitHash, txHash, txSigned, txPermitSigned, txNonce, t.chain.NetworkId, nullHex(txSigned), nullHex(txPermitSigned), nullGas(gasEstimate))
 	if err != nil {
 		return err
 	}
+
 	return nil
 }
 
-// tx_submitted
-func (t *TxStore) UpdateTxPendingToSubmited(txHash string) (bool, Tx, error) {
+// UpdateTxPendingDeferred adds the time the unsigned permit is held by the fee policy since it was last held
+func (t *TxStore) UpdateTxPendingDeferred(permitHash string) error {
 	// Ensure only one to read/write access
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
-	// Get payer, receiver
-	tx, err := t.getTxPending(txHash)
-	if err == sql.ErrNoRows {
-		return false, tx, nil
-	} else if err != nil {
-		return false, tx, err
-	}
-
-	// Insert tx_submitted and delete tx_pending
 	query := `
-		WITH moved_records AS (
-			INSERT INTO tx_submitted (tx_hash, payer, receiver, amount, nonce, tx_signed, tx_nonce, timestamp, timestamp_submitted)
-			SELECT tx_hash, payer, receiver, amount, nonce, tx_signed, tx_nonce, timestamp, NOW()
-			FROM tx_pending
-			WHERE tx_hash = $1
-			RETURNING tx_hash
-		)
-		DELETE FROM tx_pending
-		WHERE tx_hash IN (SELECT tx_hash FROM moved_records);`
-
-	_, err = t.db.Exec(query, txHash)
+	UPDATE tx_pending SET deferred_ms = COALESCE(deferred_ms, 0) + FLOOR(EXTRACT(EPOCH FROM NOW() - COALESCE(timestamp_deferred, NOW())) * 1000), timestamp_deferred = NOW()
+	WHERE permit_hash = $1 AND chain_id = $2;`
+	_, err := t.db.Exec(query, permitHash, t.chain.NetworkId)
 	if err != nil {
-		return false, tx, err
+		return err
 	}
 
-	// Update pending balance
-	err = t.updatePendingBalance(tx.Payer)
+	return nil
+}
+
+// GetSignedTxPending returns signed txs of the signer account from the tx nonce, by tx nonce
+func (t *TxStore) GetSignedTxPending(account string, fromNonce uint64) ([]Tx, error) {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var txs []Tx
+	query := `
+	SELECT ` + txColumns + ` FROM tx_pending
+	WHERE tx_hash IS NOT NULL AND tx_nonce >= $2 AND account = $1 AND chain_id = $3
+	ORDER BY tx_nonce, timestamp`
+	rows, err := t.db.Query(query, account, fromNonce, t.chain.NetworkId)
 	if err != nil {
-		return false, tx, err
+		return txs, err
 	}
+	defer rows.Close()
 
-	// Update pending balance
-	err = t.updatePendingBalance(tx.Receiver)
-	if err != nil {
-		return false, tx, err
+	for rows.Next() {
+		tx, err := scanTx(rows)
+		if err != nil {
+			continue
+		}
+
+		txs = append(txs, tx)
 	}
 
-	return true, tx, nil
+	return txs, err
 }
 
-// tx_fail
-func (t *TxStore) GetAllTxFail(count int) ([]Tx, error) {
+// GetAllSignedTxPending returns signed txs of all signer accounts, by account and tx nonce
+func (t *TxStore) GetAllSignedTxPending() ([]Tx, error) {
 	// Ensure only one to read/write access
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
-	if count > 0 {
-		count = 10000
-	}
-
 	var txs []Tx
-	query := `SELECT tx_hash, payer, receiver, amount, nonce, tx_signed, tx_nonce, timestamp FROM tx_fail ORDER BY payer, nonce LIMIT $1`
-	rows, err := t.db.Query(query, count)
+	query := `
+	SELECT ` + txColumns + ` FROM tx_pending
+	WHERE tx_hash IS NOT NULL AND chain_id = $1
+	ORDER BY account, tx_nonce, timestamp`
+	rows, err := t.db.Query(query, t.chain.NetworkId)
 	if err != nil {
 		return txs, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var (
-			tx     Tx
-			amount string
-		)
-		err := rows.Scan(&tx.TxHash, &tx.Payer, &tx.Receiver, &amount, &tx.Nonce, &tx.TxSigned, &tx.TxNonce, &tx.Timestamp)
+		tx, err := scanTx(rows)
 		if err != nil {
 			continue
 		}
 
-		tx.Amount, _ = new(big.Int).SetString(amount, 10)
 		txs = append(txs, tx)
 	}
 
 	return txs, err
 }
 
-func (t *TxStore) UpdateTxPendingToFail(txHash string) (bool, Tx, error) {
+// ResetTxPendingSigned returns the signed tx to the queue to sign again, previous hashes are kept for the Keeper
+func (t *TxStore) ResetTxPendingSigned(permitHash string) error {
 	// Ensure only one to read/write access
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
-	// Get payer, receiver
-	tx, err := t.getTxPending(txHash)
-	if err == sql.ErrNoRows {
-		return false, tx, nil
-	} else if err != nil {
-		return false, tx, err
+	query := `
+	UPDATE tx_pending SET tx_hash = NULL, tx_signed = NULL, tx_permit_signed = NULL, tx_signed_raw = NULL, tx_permit_signed_raw = NULL, tx_nonce = NULL, gas_estimate = NULL, timestamp_sent = NULL
+	WHERE permit_hash = $1 AND chain_id = $2;`
+	_, err := t.db.Exec(query, permitHash, t.chain.NetworkId)
+	if err != nil {
+		return err
 	}
 
-	// Insert tx_fail and delete tx_pending
-	query := `
-		WITH moved_records AS (
-			INSERT INTO tx_fail (tx_hash, payer, receiver, amount, nonce, tx_signed, tx_nonce, timestamp, timestamp_fail)
-			SELECT tx_hash, payer, receiver, amount, nonce, tx_signed, tx_nonce, timestamp, NOW()
-			FROM tx_pending
-			WHERE tx_hash = $1
-			RETURNING tx_hash
-		)
-		DELETE FROM tx_pending
-		WHERE tx_hash IN (SELECT tx_hash FROM moved_records);`
+	return nil
+}
+
+// GetStuckTxPending returns signed txs of the signer account broadcast before the age, by tx nonce
+func (t *TxStore) GetStuckTxPending(account string, age time.Duration, count int) ([]Tx, error) {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
 
-	_, err = t.db.Exec(query, txHash)
+	var txs []Tx
+	query := `
+	SELECT ` + txColumns + ` FROM tx_pending
+	WHERE tx_hash IS NOT NULL AND COALESCE(timestamp_sent, timestamp) < NOW() - $2 * INTERVAL '1 millisecond' AND account = $4 AND chain_id = $3
+	ORDER BY tx_nonce LIMIT $1`
+	rows, err := t.db.Query(query, count, age.Milliseconds(), t.chain.NetworkId, account)
 	if err != nil {
-		return false, tx, err
+		return txs, err
 	}
+	defer rows.Close()
 
-	// Update pending balance
-	err = t.updatePendingBalance(tx.Payer)
-	if err != nil {
-		return false, tx, err
+	for rows.Next() {
+		tx, err := scanTx(rows)
+		if err != nil {
+			continue
+		}
+
+		txs = append(txs, tx)
 	}
 
-	// Update pending balance
-	err = t.updatePendingBalance(tx.Receiver)
+	return txs, err
+}
+
+// UpdateTxPendingReplaced records the fee-bumped replacement with the same tx nonce of all permits sent by the replaced tx,
+// previous hashes are kept for the Keeper
+func (t *TxStore) UpdateTxPendingReplaced(replacedTxHash string, txHash string, txSigned []byte, txPermitSigned []byte) error {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	query := `
+	UPDATE tx_pending SET tx_hashes = array_append(COALESCE(tx_hashes, ARRAY[tx_hash]), $2), tx_hash = $2, tx_signed = $3, tx_permit_signed = $4, tx_signed_raw = $6, tx_permit_signed_raw = $7, timestamp_sent = NOW()
+	WHERE tx_hash = $1 AND chain_id = $5;`
+	_, err := t.db.Exec(query, replacedTxHash, txHash, txSigned, txPermitSigned, t.chain.NetworkId, nullHex(txSigned), nullHex(txPermitSigned))
 	if err != nil {
-		return false, tx, err
+		return err
 	}
 
-	return true, tx, nil
+	return nil
 }
 
-// signer_config
-func (t *TxStore) GetSignerTxNonce(account string) (uint64, error) {
+// GetUnassignedTxPending returns pending txs without signer account and unsigned txs of accounts not in the pool
+func (t *TxStore) GetUnassignedTxPending(accounts []string) ([]Tx, error) {
 	// Ensure only one to read/write access
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
-	account = strings.ToLower(account)
+	var txs []Tx
+	query := `
+	SELECT ` + txColumns + ` FROM tx_pending
+	WHERE (account IS NULL OR (tx_hash IS NULL AND account <> ALL($1))) AND chain_id = $2
+	ORDER BY timestamp`
+	rows, err := t.db.Query(query, pq.Array(accounts), t.chain.NetworkId)
+	if err != nil {
+		return txs, err
+	}
+	defer rows.Close()
 
-	query := `SELECT tx_nonce FROM signer_config WHERE account = $1`
+	for rows.Next() {
+		tx, err := scanTx(rows)
+		if err != nil {
+			continue
+		}
 
-	var result int64
-	err := t.db.QueryRow(query, account).Scan(&result)
-	if err != nil {
-		return 0, err
+		txs = append(txs, tx)
 	}
 
-	return uint64(result), nil
+	return txs, err
+}
+
+// UpdateTxPendingAccount assigns the pending tx to the signer account
+func (t *TxStore) UpdateTxPendingAccount(permitHash string, account string) error {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	query := `UPDATE tx_pending SET account = $2 WHERE permit_hash = $1 AND chain_id = $3`
+	_, err := t.db.Exec(query, permitHash, strings.ToLower(account), t.chain.NetworkId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetPendingAccount returns the signer account of pending txs of the payer, empty if none
+func (t *TxStore) GetPendingAccount(payer string) (string, error) {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var account string
+	query := `SELECT account FROM tx_pending WHERE payer = $1 AND account IS NOT NULL AND chain_id = $2 ORDER BY timestamp DESC LIMIT 1`
+	err := t.db.QueryRow(query, strings.ToLower(payer), t.chain.NetworkId).Scan(&account)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return account, nil
+}
+
+// GetPendingTxsByAccount returns the number of pending txs of each signer account
+func (t *TxStore) GetPendingTxsByAccount() (map[string]int64, error) {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	result := make(map[string]int64)
+	query := `SELECT account, COUNT(*) FROM tx_pending WHERE account IS NOT NULL AND chain_id = $1 GROUP BY account`
+	rows, err := t.db.Query(query, t.chain.NetworkId)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var account string
+		var count int64
+		if err := rows.Scan(&account, &count); err != nil {
+			return result, err
+		}
+		result[account] = count
+	}
+
+	return result, rows.Err()
+}
+
+func (t *TxStore) updatePendingBalance(token string, account string) error {
+	return t.updateChainPendingBalance(t.chain.NetworkId, token, account)
+}
+
+// updateChainPendingBalance recomputes the pending balance of the account on the chain
+func (t *TxStore) updateChainPendingBalance(chainId int64, token string, account string) error {
+	token = strings.ToLower(token)
+	account = strings.ToLower(account)
+
+	// Delete before
+	query := `DELETE FROM account_balance WHERE account = $1 AND token = $2 AND chain_id = $3`
+	_, err := t.db.Exec(query, account, token, chainId)
+	if err != nil {
+		return err
+	}
+
+	// Insert new pending_balance
+	query = `
+	INSERT INTO account_balance (chain_id, account, token, pending_balance, pending_txs) 
+	SELECT
+		$3 AS chain_id,
+		$1 AS account,
+		$2 AS token,
+		(SELECT COALESCE(SUM(amount::NUMERIC), 0) FROM tx_pending WHERE receiver = $1 AND token = $2 AND chain_id = $3) -
+		(SELECT COALESCE(SUM(amount::NUMERIC), 0) FROM tx_pending WHERE payer = $1 AND token = $2 AND chain_id = $3) AS pending_balance,
+		(SELECT COUNT(*) FROM tx_pending WHERE payer = $1 AND token = $2 AND chain_id = $3) AS pending_txs;`
+	_, err = t.db.Exec(query, account, token, chainId)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetBatchTxPending returns the pending permits sent by the tx hash, current or replaced
+func (t *TxStore) GetBatchTxPending(txHash string) ([]Tx, error) {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var txs []Tx
+	query := `SELECT ` + txColumns + ` FROM tx_pending WHERE (tx_hash = $1 OR $1 = ANY(tx_hashes)) AND chain_id = $2 ORDER BY timestamp`
+	rows, err := t.db.Query(query, txHash, t.chain.NetworkId)
+	if err != nil {
+		return txs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		tx, err := scanTx(rows)
+		if err != nil {
+			continue
+		}
+
+		txs = append(txs, tx)
+	}
+
+	return txs, err
+}
+
+// tx_submitted
+func (t *TxStore) UpdateTxPendingToSubmited(txHash string, gasUsed uint64) (bool, Tx, error) {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// Get payer, receiver
+	tx, err := t.getTxPending(txHash)
+	if err == sql.ErrNoRows {
+		return false, tx, nil
+	} else if err != nil {
+		return false, tx, err
+	}
+
+	err = t.moveTxPendingToSubmitted(tx, txHash, gasUsed)
+	if err != nil {
+		return false, tx, err
+	}
+	return true, tx, nil
+}
+
+// UpdatePermitPendingToSubmitted moves one permit of a batch tx to tx_submitted
+func (t *TxStore) UpdatePermitPendingToSubmitted(tx Tx, txHash string, gasUsed uint64) error {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.moveTxPendingToSubmitted(tx, txHash, gasUsed)
+}
+
+func (t *TxStore) moveTxPendingToSubmitted(tx Tx, txHash string, gasUsed uint64) error {
+	// The mined tx may be a replacement
+	query := `UPDATE tx_pending SET tx_hash = $1, gas_used = $4 WHERE permit_hash = $2 AND chain_id = $3`
+	_, err := t.db.Exec(query, txHash, tx.PermitHash, t.chain.NetworkId, nullGas(gasUsed))
+	if err != nil {
+		return err
+	}
+
+	// Delete tx_pending and insert tx_submitted, a previous row of the permit is replaced
+	query = `
+		WITH moved_records AS (
+			DELETE FROM tx_pending
+			WHERE permit_hash = $1 AND chain_id = $2
+			RETURNING *
+		)
+		INSERT INTO tx_submitted (chain_id, ` + txColumns + `, timestamp_submitted)
+		SELECT chain_id, ` + txColumns + `, NOW()
+		FROM moved_records
+		` + upsertColumns(txColumns, "timestamp_submitted") + `;`
+
+	_, err = t.db.Exec(query, tx.PermitHash, t.chain.NetworkId)
+	if err != nil {
+		return err
+	}
+
+	// Update pending balance
+	err = t.updatePendingBalance(tx.Token, tx.Payer)
+	if err != nil {
+		return err
+	}
+
+	// Update pending balance
+	err = t.updatePendingBalance(tx.Token, tx.Receiver)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// tx_fail
+// GetRetryTxFail returns failed txs due to retry, by retry time
+func (t *TxStore) GetRetryTxFail(count int) ([]Tx, error) {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var txs []Tx
+	query := `
+	SELECT ` + txColumns + ` FROM tx_fail
+	WHERE NOT COALESCE(terminal, FALSE) AND COALESCE(retry_at, timestamp_fail) <= NOW() AND chain_id = $2
+	ORDER BY COALESCE(retry_at, timestamp_fail) LIMIT $1`
+	rows, err := t.db.Query(query, count, t.chain.NetworkId)
+	if err != nil {
+		return txs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		tx, err := scanTx(rows)
+		if err != nil {
+			continue
+		}
+
+		txs = append(txs, tx)
+	}
+
+	return txs, err
+}
+
+// UpdateTxPendingToFail moves the reverted tx to tx_fail, the retry is due after the backoff doubled by each attempt
+func (t *TxStore) UpdateTxPendingToFail(txHash string, reason string, gasUsed uint64) (bool, Tx, error) {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// Get payer, receiver
+	tx, err := t.getTxPending(txHash)
+	if err == sql.ErrNoRows {
+		return false, tx, nil
+	} else if err != nil {
+		return false, tx, err
+	}
+
+	err = t.moveTxPendingToFail(tx, txHash, reason, gasUsed)
+	if err != nil {
+		return false, tx, err
+	}
+	return true, tx, nil
+}
+
+// UpdatePermitPendingToFail moves one failed permit of a batch tx to tx_fail
+func (t *TxStore) UpdatePermitPendingToFail(tx Tx, txHash string, reason string, gasUsed uint64) error {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.moveTxPendingToFail(tx, txHash, reason, gasUsed)
+}
+
+func (t *TxStore) moveTxPendingToFail(tx Tx, txHash string, reason string, gasUsed uint64) error {
+	// The mined tx may be a replacement
+	query := `UPDATE tx_pending SET tx_hash = $1, fail_reason = $4, gas_used = $5 WHERE permit_hash = $2 AND chain_id = $3`
+	_, err := t.db.Exec(query, txHash, tx.PermitHash, t.chain.NetworkId, reason, nullGas(gasUsed))
+	if err != nil {
+		return err
+	}
+
+	// Delete tx_pending and insert tx_fail, a previous row of the permit is replaced
+	query = `
+		WITH moved_records AS (
+			DELETE FROM tx_pending
+			WHERE permit_hash = $1 AND chain_id = $2
+			RETURNING *
+		)
+		INSERT INTO tx_fail (chain_id, ` + txColumns + `, timestamp_fail, retry_at, terminal)
+		SELECT chain_id, ` + txColumns + `, NOW(), NOW() + $3 * POWER(2, COALESCE(retry_count, 0)) * INTERVAL '1 millisecond', FALSE
+		FROM moved_records
+		` + upsertColumns(txColumns, "timestamp_fail", "retry_at", "terminal") + `;`
+
+	_, err = t.db.Exec(query, tx.PermitHash, t.chain.NetworkId, t.chain.Signer.RetryBackoff.Milliseconds())
+	if err != nil {
+		return err
+	}
+
+	// Update pending balance
+	err = t.updatePendingBalance(tx.Token, tx.Payer)
+	if err != nil {
+		return err
+	}
+
+	// Update pending balance
+	err = t.updatePendingBalance(tx.Token, tx.Receiver)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateTxPendingToRejected moves the unsigned permit that would revert to tx_fail, it is not retried
+func (t *TxStore) UpdateTxPendingToRejected(permitHash string, reason string) error {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// Delete tx_pending and insert tx_fail, a previous row of the permit is replaced
+	query := `
+		WITH moved_records AS (
+			DELETE FROM tx_pending
+			WHERE permit_hash = $1 AND chain_id = $2
+			RETURNING *
+		), inserted_records AS (
+			INSERT INTO tx_fail (chain_id, ` + txColumns + `, timestamp_fail, retry_at, terminal)
+			SELECT chain_id, permit_hash, tx_hash, tx_hashes, token, payer, receiver, amount, nonce, deadline, valid_after, signature, permit, tx_signed, tx_permit_signed, tx_signed_raw, tx_permit_signed_raw, tx_nonce, account, retry_count, $3, gas_estimate, gas_used, deferred_ms, priority, timestamp, NOW(), NULL, TRUE
+			FROM moved_records
+			` + upsertColumns(txColumns, "timestamp_fail", "retry_at", "terminal") + `
+		)
+		SELECT token, payer, receiver FROM moved_records;`
+
+	var token, payer, receiver string
+	err := t.db.QueryRow(query, permitHash, t.chain.NetworkId, reason).Scan(&token, &payer, &receiver)
+	if err != nil {
+		return err
+	}
+
+	// Update pending balance
+	err = t.updatePendingBalance(token, payer)
+	if err != nil {
+		return err
+	}
+
+	// Update pending balance
+	err = t.updatePendingBalance(token, receiver)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateTxFailToPending requeues the failed permit unsigned to the signer account, a new tx nonce is taken when signed
+func (t *TxStore) UpdateTxFailToPending(permitHash string, account string) error {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// Hashes of the failed tx nonce can not be mined anymore, a permit already pending keeps its row
+	query := `
+		WITH moved_records AS (
+			DELETE FROM tx_fail
+			WHERE permit_hash = $1 AND chain_id = $2
+			RETURNING *
+		), inserted_records AS (
+			INSERT INTO tx_pending (chain_id, permit_hash, token, payer, receiver, amount, nonce, deadline, valid_after, signature, permit, account, retry_count, fail_reason, deferred_ms, priority, timestamp)
+			SELECT chain_id, permit_hash, token, payer, receiver, amount, nonce, deadline, valid_after, signature, permit, $3, COALESCE(retry_count, 0) + 1, fail_reason, deferred_ms, priority, timestamp
+			FROM moved_records
+			ON CONFLICT (permit_hash) DO NOTHING
+		)
+		SELECT token, payer, receiver FROM moved_records;`
+
+	var token, payer, receiver string
+	err := t.db.QueryRow(query, permitHash, t.chain.NetworkId, strings.ToLower(account)).Scan(&token, &payer, &receiver)
+	if err != nil {
+		return err
+	}
+
+	// Update pending balance
+	err = t.updatePendingBalance(token, payer)
+	if err != nil {
+		return err
+	}
+
+	// Update pending balance
+	err = t.updatePendingBalance(token, receiver)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateTxFailRetry records the reason the failed permit can not be sent yet and delays the next check,
+// waiting is not an attempt, only requeues count
+func (t *TxStore) UpdateTxFailRetry(permitHash string, reason string) error {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	query := `
+	UPDATE tx_fail SET fail_reason = $2, retry_at = NOW() + $3 * POWER(2, COALESCE(retry_count, 0)) * INTERVAL '1 millisecond'
+	WHERE permit_hash = $1 AND chain_id = $4;`
+	_, err := t.db.Exec(query, permitHash, reason, t.chain.Signer.RetryBackoff.Milliseconds(), t.chain.NetworkId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateTxFailTerminal stops retrying the failed permit with the reason
+func (t *TxStore) UpdateTxFailTerminal(permitHash string, reason string) error {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	query := `UPDATE tx_fail SET fail_reason = $2, terminal = TRUE, retry_at = NULL WHERE permit_hash = $1 AND chain_id = $3`
+	_, err := t.db.Exec(query, permitHash, reason, t.chain.NetworkId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SpendEmergencyBudget records the cost of the permit when the costs of the period stay within the budget, false otherwise
+func (t *TxStore) SpendEmergencyBudget(permitHash string, cost *big.Int, budget *big.Int, period time.Duration) (bool, error) {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	query := `
+	INSERT INTO fee_emergency_spend (chain_id, permit_hash, cost, timestamp)
+	SELECT $1, $2, $3, NOW()
+	WHERE (
+		SELECT COALESCE(SUM(cost), 0) FROM fee_emergency_spend
+		WHERE chain_id = $1 AND timestamp > NOW() - $5 * INTERVAL '1 millisecond'
+	) + $3 <= $4;`
+	result, err := t.db.Exec(query, t.chain.NetworkId, permitHash, cost.String(), budget.String(), period.Milliseconds())
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// Tx status of the permit
+const (
+	TxStatusPending   = "pending"
+	TxStatusSubmitted = "submitted"
+	TxStatusFailed    = "failed"   // retried after the backoff
+	TxStatusRejected  = "rejected" // permanently invalid, not retried
+)
+
+// GetTxStatus finds the permit in tx_pending, tx_submitted or tx_fail, in this order
+func (t *TxStore) GetTxStatus(permitHash string) (string, Tx, error) {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	tables := []struct {
+		table  string
+		status string
+	}{
+		{"tx_pending", TxStatusPending},
+		{"tx_submitted", TxStatusSubmitted},
+		{"tx_fail", TxStatusFailed},
+	}
+	for _, item := range tables {
+		table, status := item.table, item.status
+		query := `SELECT ` + txColumns + ` FROM ` + table + ` WHERE permit_hash = $1 AND chain_id = $2`
+		tx, err := scanTx(t.db.QueryRow(query, permitHash, t.chain.NetworkId))
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return "", tx, err
+		}
+
+		// Terminal failed permit
+		if table == "tx_fail" {
+			var terminal sql.NullBool
+			query = `SELECT terminal FROM tx_fail WHERE permit_hash = $1 AND chain_id = $2`
+			err = t.db.QueryRow(query, permitHash, t.chain.NetworkId).Scan(&terminal)
+			if err != nil {
+				return "", tx, err
+			}
+			if terminal.Bool {
+				status = TxStatusRejected
+			}
+		}
+		return status, tx, nil
+	}
+
+	return "", Tx{}, sql.ErrNoRows
+}
+
+// GetSignerAccounts returns the lowercase signer accounts of the chain in signer_config
+func (t *TxStore) GetSignerAccounts() (map[string]bool, error) {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	accounts := make(map[string]bool)
+	query := `SELECT account FROM signer_config WHERE chain_id = $1`
+	rows, err := t.db.Query(query, t.chain.NetworkId)
+	if err != nil {
+		return accounts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var account string
+		err = rows.Scan(&account)
+		if err != nil {
+			return accounts, err
+		}
+		accounts[strings.ToLower(account)] = true
+	}
+
+	return accounts, rows.Err()
+}
+
+// GetAverageGasEstimate returns the average gas estimate of the last submitted txs of the signer account, 0 if none
+func (t *TxStore) GetAverageGasEstimate(account string) (uint64, error) {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var estimate sql.NullFloat64
+	query := `
+	SELECT AVG(gas_estimate) FROM (
+		SELECT gas_estimate FROM tx_submitted
+		WHERE account = $1 AND chain_id = $2 AND gas_estimate IS NOT NULL
+		ORDER BY timestamp_submitted DESC LIMIT 100
+	) AS recent`
+	err := t.db.QueryRow(query, strings.ToLower(account), t.chain.NetworkId).Scan(&estimate)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(estimate.Float64), nil
+}
+
+// signer_config
+func (t *TxStore) GetSignerTxNonce(account string) (uint64, error) {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	account = strings.ToLower(account)
+
+	query := `SELECT tx_nonce FROM signer_config WHERE account = $1 AND chain_id = $2`
+
+	var result int64
+	err := t.db.QueryRow(query, account, t.chain.NetworkId).Scan(&result)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(result), nil
+}
+
+// ResetSignerTxNonce sets the next tx nonce, lower than the current one when trailing nonces are not used
+func (t *TxStore) ResetSignerTxNonce(account string, txNonce uint64) error {
+	// Ensure only one to read/write access
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	query := `
+	UPDATE signer_config SET tx_nonce = $2, timestamp = NOW()
+	WHERE account = $1 AND chain_id = $3;`
+	_, err := t.db.Exec(query, strings.ToLower(account), txNonce, t.chain.NetworkId)
+	if err != nil {
+		return err
+	}
+
+	return nil
 }
 
 func (t *TxStore) UpdateSignerTxNonce(account string, txNonce uint64) error {
@@ -522,8 +1473,8 @@ func (t *TxStore) UpdateSignerTxNonce(account string, txNonce uint64) error {
 
 	query := `
 	UPDATE signer_config SET tx_nonce = $2, timestamp = NOW()
-	WHERE account = $1 AND tx_nonce < $2;`
-	_, err := t.db.Exec(query, account, txNonce)
+	WHERE account = $1 AND chain_id = $3 AND tx_nonce < $2;`
+	_, err := t.db.Exec(query, account, txNonce, t.chain.NetworkId)
 	if err != nil {
 		return err
 	}
@@ -535,10 +1486,10 @@ func (t *TxStore) UpdateSignerTxNonce(account string, txNonce uint64) error {
 func (t *TxStore) GetKeeperBlockNumber() (int64, error) {
 	// Do not t.mutex.Lock()
 
-	query := `SELECT block_number FROM keeper_config WHERE instance_id = $1`
+	query := `SELECT block_number FROM keeper_config WHERE instance_id = $1 AND chain_id = $2`
 
 	var result int64
-	err := t.db.QueryRow(query, t.config.Keeper.InstanceId).Scan(&result)
+	err := t.db.QueryRow(query, t.chain.Keeper.InstanceId, t.chain.NetworkId).Scan(&result)
 	if err != nil {
 		return 0, err
 	}
@@ -551,8 +1502,8 @@ func (t *TxStore) UpdateKeeperBlockNumber(blockNumber int64) error {
 
 	query := `
 	UPDATE keeper_config SET block_number = $2, timestamp = NOW()
-	WHERE instance_id = $1 AND block_number < $2;`
-	_, err := t.db.Exec(query, t.config.Keeper.InstanceId, blockNumber)
+	WHERE instance_id = $1 AND chain_id = $3 AND block_number < $2;`
+	_, err := t.db.Exec(query, t.chain.Keeper.InstanceId, blockNumber, t.chain.NetworkId)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScheduleTxs(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tx := func(permitHash string, payer string, nonce int64, deadline int64, priority int64, age time.Duration) Tx {
+		return Tx{PermitHash: permitHash, Payer: payer, Token: "t", Nonce: big.NewInt(nonce), Deadline: big.NewInt(deadline), Priority: priority, Timestamp: now.Add(-age)}
+	}
+	txs := []Tx{
+		tx("a1", "a", 1, 9000, 0, 10*time.Minute),
+		tx("a2", "a", 2, 9000, 0, 9*time.Minute),
+		tx("a3", "a", 3, 9000, 0, 8*time.Minute),
+		tx("b1", "b", 1, 9000, 0, 7*time.Minute),
+		tx("c2", "c", 2, 9000, 2, 6*time.Minute), // later nonce of c with priority
+		tx("c1", "c", 1, 9000, 0, 5*time.Minute), // takes the priority of c2
+		tx("d1", "d", 1, 1000, 0, time.Minute),   // urgent
+		tx("e1", "e", 1, 9000, 1, 2*time.Minute),
+	}
+
+	var order []string
+	for _, tx := range scheduleTxs(txs, 2000) {
+		order = append(order, tx.PermitHash)
+	}
+	expected := []string{"d1", "c1", "c2", "e1", "a1", "b1", "a2", "a3"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("scheduleTxs returned %v, expected %v", order, expected)
+	}
+
+	// Earlier permits of the owner take the urgency of a later one
+	txs = append(txs, tx("a4", "a", 4, 1000, 0, 0))
+	order = nil
+	for _, tx := range scheduleTxs(txs, 2000) {
+		order = append(order, tx.PermitHash)
+	}
+	expected = []string{"a1", "d1", "a2", "a3", "a4", "c1", "c2", "e1", "b1"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("scheduleTxs returned %v, expected %v", order, expected)
+	}
+}